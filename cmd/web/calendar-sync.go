@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/calsync"
+	"github.com/tsawler/bookings-app/internal/handlers"
+)
+
+func scheduleCalendarSync(w *workers) {
+	syncer := calsync.New(handlers.Repo.DB)
+
+	// Execute a function in the background
+	w.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(app.CalendarSyncInterval)
+		defer ticker.Stop()
+
+		for {
+			err := syncer.SyncAll()
+			if err != nil {
+				errorLog.Println(err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/handlers"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func scheduleDigest(w *workers) {
+	// Execute a function in the background
+	w.Go(func(ctx context.Context) {
+		for {
+			// the digest goes out at the hour on the property's clock
+			next := nextDigestTime(clock.Now(app.Timezone), app.DigestHour)
+			timer := time.NewTimer(time.Until(next))
+
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+
+			sendDigest(next)
+		}
+	})
+}
+
+// nextDigestTime returns the next time after now at which the digest is due
+func nextDigestTime(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// sendDigest collects the last day's reservation activity and mails it to staff
+func sendDigest(now time.Time) {
+	if len(app.StaffEmails) == 0 {
+		return
+	}
+
+	today := clock.Date(now, app.Timezone)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	digest, err := handlers.Repo.DB.GetReservationDigest(now.AddDate(0, 0, -1), tomorrow)
+	if err != nil {
+		errorLog.Println(err)
+		return
+	}
+
+	content := buildDigest(digest)
+
+	for _, to := range app.StaffEmails {
+		app.MailChan <- models.MailData{
+			To:       to,
+			From:     app.MailFrom,
+			Subject:  fmt.Sprintf("Reservation Digest for %s", today.Format("2006-01-02")),
+			Content:  content,
+			Template: "base.html",
+		}
+	}
+}
+
+// buildDigest renders the digest as the html body of an email
+func buildDigest(d models.Digest) string {
+	var b strings.Builder
+
+	b.WriteString(fmt.Sprintf("<strong>Reservation Digest</strong><br>Activity since %s<br><br>", d.Since.Format("2006-01-02 15:04")))
+
+	writeDigestSection(&b, "New reservations", d.New)
+	writeDigestSection(&b, "Modified reservations", d.Modified)
+	writeDigestSection(&b, "Cancelled reservations", d.Cancelled)
+	writeDigestSection(&b, fmt.Sprintf("Arrivals on %s", d.Day.Format("2006-01-02")), d.Arrivals)
+	writeDigestSection(&b, fmt.Sprintf("Departures on %s", d.Day.Format("2006-01-02")), d.Departures)
+
+	return b.String()
+}
+
+func writeDigestSection(b *strings.Builder, title string, reservations []models.Reservation) {
+	b.WriteString(fmt.Sprintf("<strong>%s (%d)</strong><br>", title, len(reservations)))
+
+	if len(reservations) == 0 {
+		b.WriteString("None<br><br>")
+		return
+	}
+
+	b.WriteString("<ul>")
+	for _, r := range reservations {
+		b.WriteString(fmt.Sprintf("<li>#%d %s %s - %s, %s to %s</li>",
+			r.ID,
+			r.FirstName,
+			r.LastName,
+			r.Room.RoomName,
+			r.StartDate.Format("2006-01-02"),
+			r.EndDate.Format("2006-01-02"),
+		))
+	}
+	b.WriteString("</ul><br>")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func TestNextDigestTime(t *testing.T) {
+	now := time.Date(2050, 1, 1, 6, 30, 0, 0, time.UTC)
+
+	next := nextDigestTime(now, 7)
+	if !next.Equal(time.Date(2050, 1, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected digest later today but got %s", next)
+	}
+
+	next = nextDigestTime(now, 6)
+	if !next.Equal(time.Date(2050, 1, 2, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected digest tomorrow but got %s", next)
+	}
+}
+
+func TestBuildDigest(t *testing.T) {
+	d := models.Digest{
+		Day: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		New: []models.Reservation{
+			{ID: 1, FirstName: "John", LastName: "Smith", Room: models.Room{RoomName: "General's Quarters"}},
+		},
+	}
+
+	content := buildDigest(d)
+
+	if !strings.Contains(content, "New reservations (1)") {
+		t.Error("digest does not list new reservations")
+	}
+
+	if !strings.Contains(content, "#1 John Smith") {
+		t.Error("digest does not contain reservation details")
+	}
+
+	if !strings.Contains(content, "Arrivals on 2050-01-02 (0)") {
+		t.Error("digest does not contain arrivals section")
+	}
+}
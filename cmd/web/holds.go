@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/handlers"
+)
+
+// holdSweepInterval is how often expired room holds are removed
+const holdSweepInterval = time.Minute
+
+func scheduleHoldSweeper(w *workers) {
+	// Execute a function in the background
+	w.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(holdSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			n, err := handlers.Repo.DB.DeleteExpiredHolds(time.Now())
+			if err != nil {
+				errorLog.Println(err)
+				continue
+			}
+
+			if n > 0 {
+				infoLog.Printf("Removed %d expired room holds", n)
+			}
+		}
+	})
+}
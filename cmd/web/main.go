@@ -1,25 +1,33 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
-	"flag"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
+	_ "time/tzdata" // so -timezone works on hosts without a timezone database
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/tsawler/bookings-app/internal/clock"
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/currency"
 	"github.com/tsawler/bookings-app/internal/driver"
 	"github.com/tsawler/bookings-app/internal/handlers"
+	"github.com/tsawler/bookings-app/internal/health"
 	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
 	"github.com/tsawler/bookings-app/internal/render"
 )
 
-const portNumber = ":8080"
-
 var app config.AppConfig
 var session *scs.SessionManager
 var infoLog *log.Logger
@@ -27,16 +35,35 @@ var errorLog *log.Logger
 
 // main is the main function
 func main() {
-	db, err := run()
+	db, err := run(os.Args)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.SQL.Close()
 
-	defer close(app.MailChan)
-	listenForMail()
+	mailer := newWorkers()
+	listenForMail(mailer)
 
 	fmt.Println("Starting mail listener...")
+
+	schedulers := newWorkers()
+	listenForEvents(schedulers)
+
+	if app.CalendarSyncInterval > 0 {
+		scheduleCalendarSync(schedulers)
+		fmt.Println(fmt.Sprintf("Syncing external calendars every %s", app.CalendarSyncInterval))
+	}
+
+	if app.HoldDuration > 0 {
+		scheduleHoldSweeper(schedulers)
+		fmt.Println(fmt.Sprintf("Holding chosen rooms for %s", app.HoldDuration))
+	}
+
+	scheduleWaitlistReoffer(schedulers)
+
+	if app.SendDigest {
+		scheduleDigest(schedulers)
+		fmt.Println(fmt.Sprintf("Daily digest scheduled for %02d:00", app.DigestHour))
+	}
 	// Send email
 	// msg := models.MailData{
 	// 	To:      "john@smith.com",
@@ -56,50 +83,176 @@ func main() {
 	// 	log.Printf("Error")
 	// }
 
-	fmt.Println(fmt.Sprintf("Staring application on port %s", portNumber))
+	fmt.Println(fmt.Sprintf("Staring application on port %d", app.Port))
 
 	srv := &http.Server{
-		Addr:    portNumber,
+		Addr:    fmt.Sprintf(":%d", app.Port),
 		Handler: routes(&app),
 	}
 
-	err = srv.ListenAndServe()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	failed := false
+	select {
+	case err = <-serverErr:
+		errorLog.Println(err)
+		failed = true
+	case sig := <-quit:
+		infoLog.Printf("Received %s, shutting down...", sig)
+	}
+
+	if !shutdown(srv, schedulers, mailer, db) || failed {
+		os.Exit(1)
+	}
+
+	infoLog.Println("Stopped")
+}
+
+// shutdown stops the application in order: the web server stops taking connections and lets
+// requests in flight finish, then the schedulers stop, as they send email and webhook events,
+// then the email still waiting is sent and the database pool is closed. It all has to happen
+// within the shutdown timeout, and it returns false when it didn't.
+func shutdown(srv *http.Server, schedulers, mailer *workers, db *driver.DB) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	defer cancel()
+
+	ok := true
+
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		errorLog.Println("requests still running at shutdown:", err)
+		ok = false
+	}
+
+	err = schedulers.Stop(ctx)
 	if err != nil {
-		log.Fatal(err)
+		errorLog.Println("schedulers still running at shutdown:", err)
+		ok = false
 	}
+
+	err = mailer.Stop(ctx)
+	if err != nil {
+		errorLog.Println("email still being sent at shutdown:", err)
+		ok = false
+	}
+
+	err = db.SQL.Close()
+	if err != nil {
+		errorLog.Println(err)
+		ok = false
+	}
+
+	return ok
 }
 
-func run() (*driver.DB, error) {
+func run(args []string) (*driver.DB, error) {
 	// what am I going to put in the session
 	gob.Register(models.Reservation{})
 	gob.Register(models.User{})
 	gob.Register(models.Room{})
 	gob.Register(models.RoomRestriction{})
 	gob.Register(map[string]int{})
+	gob.Register(models.Booking{})
+	gob.Register([]int{})
 
-	// read flags
-	inProduction := flag.Bool("production", true, "Application is in production")
-	UseCache := flag.Bool("cache", true, "Using template cache")
-	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
-	dbUser := flag.String("dbuser", "", "Database user")
-	dbPass := flag.String("dbpass", "", "Database password")
-	dbPort := flag.String("dbport", "5432", "Database port")
-	dbSSL := flag.String("dbssl", "", "Database ssl settings (disable, prefer, require)")
-
-	flag.Parse()
-
-	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Missing required flags")
-		os.Exit(1)
+	// settings come from their defaults, a config file, the environment and flags
+	settings, err := config.LoadSettings(args[0], args[1:])
+	if err != nil {
+		return nil, err
 	}
 
-	mailChan := make(chan models.MailData)
+	// email is queued so requests don't wait on the mail server
+	mailChan := make(chan models.MailData, 100)
 	app.MailChan = mailChan
 
+	app.EventChan = make(chan models.WebhookEvent, 100)
+
 	// change this to true when in production
-	app.InProduction = *inProduction
-	app.UseCache = *UseCache
+	app.InProduction = settings.Production
+	app.UseCache = settings.UseCache
+	app.Port = settings.Port
+	app.SessionLifetime = settings.SessionLifetime
+	app.ShutdownTimeout = settings.ShutdownTimeout
+	app.BaseURL = strings.TrimSuffix(settings.BaseURL, "/")
+
+	// mail server
+	app.MailHost = settings.MailHost
+	app.MailPort = settings.MailPort
+	app.MailUsername = settings.MailUsername
+	app.MailPassword = settings.MailPassword
+	app.MailEncryption = settings.MailEncryption
+	app.MailFrom = settings.MailFrom
+
+	// staff notifications
+	app.StaffEmails = settings.StaffEmails
+	app.SendDigest = settings.SendDigest
+	app.DigestHour = settings.DigestHour
+	app.CalendarSyncInterval = settings.CalendarSync
+	app.HoldDuration = time.Duration(settings.HoldMinutes) * time.Minute
+	app.WaitlistOfferTTL = time.Duration(settings.WaitlistHours) * time.Hour
+
+	// property details for invoices
+	app.PropertyName = settings.PropertyName
+	app.PropertyAddress = settings.PropertyAddress
+	app.PropertyEmail = settings.PropertyEmail
+	app.PropertyPhone = settings.PropertyPhone
+
+	// "today" is the date where the property is, not where the server is
+	app.Timezone, err = time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", settings.Timezone)
+	}
+	app.CheckInTime, err = clock.ParseTimeOfDay(settings.CheckIn)
+	if err != nil {
+		return nil, fmt.Errorf("check-in: %w", err)
+	}
+	app.CheckOutTime, err = clock.ParseTimeOfDay(settings.CheckOut)
+	if err != nil {
+		return nil, fmt.Errorf("check-out: %w", err)
+	}
+
+	// prices are charged in the base currency and can be shown in others
+	base, ok := currency.Lookup(settings.Currency)
+	if !ok || base.Decimals != 2 {
+		return nil, fmt.Errorf("can't charge in currency %q", settings.Currency)
+	}
+	app.Currencies = currency.NewTable(base.Code)
+
+	// the database has to be migrated to the newest migration to be ready
+	app.SchemaVersion, err = health.LatestMigration("./migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	// guest pages, form errors and emails are translated with the catalogs in ./locales
+	err = i18n.Load("./locales")
+	if err != nil {
+		return nil, err
+	}
+
+	// deposits
+	deposit, err := payments.NewDepositRule(settings.Deposit, settings.DepositAmount)
+	if err != nil {
+		return nil, err
+	}
+	app.Deposit = deposit
+
+	switch settings.Payments {
+	case "fake":
+		// the fake provider accepts any card, so it must never take real bookings
+		if app.InProduction {
+			return nil, errors.New("the fake payment provider can't be used in production")
+		}
+		app.Payments = payments.NewFake()
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", settings.Payments)
+	}
 
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	app.InfoLog = infoLog
@@ -109,7 +262,7 @@ func run() (*driver.DB, error) {
 
 	// set up the session
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Lifetime = app.SessionLifetime
 	session.Cookie.Persist = true
 	session.Cookie.SameSite = http.SameSiteLaxMode
 	session.Cookie.Secure = app.InProduction
@@ -118,10 +271,10 @@ func run() (*driver.DB, error) {
 
 	// connect to database
 	log.Println("Connecting to database...")
-	connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
+	connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", settings.DBHost, settings.DBPort, settings.DBName, settings.DBUser, settings.DBPass, settings.DBSSL)
 	db, err := driver.ConnectSQL(connectionString)
 	if err != nil {
-		log.Fatal("Cannot connect to database! Dying...")
+		return nil, fmt.Errorf("cannot connect to database: %w", err)
 	}
 
 	log.Println("Connected to database!")
@@ -136,6 +289,11 @@ func run() (*driver.DB, error) {
 
 	repo := handlers.NewRepo(&app, db)
 	handlers.NewHandlers(repo)
+
+	err = repo.LoadExchangeRates()
+	if err != nil {
+		return nil, err
+	}
 	render.NewRenderer(&app)
 	helpers.NewHelpers(&app)
 
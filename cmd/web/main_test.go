@@ -1,10 +1,43 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"strings"
+	"testing"
+)
 
 func TestRun(t *testing.T) {
-	_, err := run()
+	// run reads the migrations, catalogs and templates from the root of the repository
+	wd, err := os.Getwd()
 	if err != nil {
-		t.Error("failed run")
+		t.Fatal(err)
+	}
+	err = os.Chdir("../..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// nothing listens on port 1, so the database can't be reached
+	db := []string{"-dbname=bookings", "-dbuser=bookings", "-dbhost=127.0.0.1", "-dbport=1"}
+
+	var tests = []struct {
+		name          string
+		args          []string
+		expectedError string
+	}{
+		{"unknown flag", []string{"-nosuchflag"}, "flag provided but not defined"},
+		{"missing database", nil, "dbname"},
+		{"unknown timezone", append([]string{"-timezone=Mars/Olympus"}, db...), `unknown timezone "Mars/Olympus"`},
+		{"unknown currency", append([]string{"-currency=XYZ"}, db...), `can't charge in currency "XYZ"`},
+		{"fake payments in production", append([]string{"-production=true", "-payments=fake"}, db...), "fake payment provider"},
+		{"no database", db, "cannot connect to database"},
+	}
+
+	for _, e := range tests {
+		_, err := run(append([]string{"bookings"}, e.args...))
+		if err == nil || !strings.Contains(err.Error(), e.expectedError) {
+			t.Errorf("for %s expected an error about %s but got %v", e.name, e.expectedError, err)
+		}
 	}
 }
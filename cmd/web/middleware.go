@@ -2,9 +2,15 @@ package main
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/justinas/nosurf"
+	"github.com/tsawler/bookings-app/internal/handlers"
 	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/ratelimit"
 )
 
 // NoSurf is the csrf protection middleware
@@ -17,6 +23,13 @@ func NoSurf(next http.Handler) http.Handler {
 		Secure:   app.InProduction,
 		SameSite: http.SameSiteLaxMode,
 	})
+
+	// the API authenticates with bearer tokens, never the session cookie, so a forged
+	// request can't act as anyone
+	csrfHandler.ExemptFunc(func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, "/api/")
+	})
+
 	return csrfHandler
 }
 
@@ -25,6 +38,28 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
+// Localize negotiates the language of each request, remembering a choice made with ?lang=
+// in a cookie
+func Localize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := i18n.Negotiate(r)
+
+		if i18n.Match(r.URL.Query().Get(i18n.Query)) != "" {
+			http.SetCookie(w, &http.Cookie{
+				Name:     i18n.Cookie,
+				Value:    locale,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+				Secure:   app.InProduction,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
 // Auth
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -37,3 +72,67 @@ func Auth(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// apiLimiter enforces the per token request limits, counted per minute
+var apiLimiter = ratelimit.New(time.Minute)
+
+// APIBearer authenticates API requests that carry an Authorization: Bearer token
+func APIBearer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := helpers.BearerToken(r)
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t, err := handlers.Repo.DB.GetAPITokenByHash(helpers.HashToken(token))
+		if err != nil {
+			handlers.Repo.APIUnauthorized(w, r)
+			return
+		}
+
+		if !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt) {
+			handlers.Repo.APIUnauthorized(w, r)
+			return
+		}
+
+		if !apiLimiter.Allow(strconv.Itoa(t.ID), t.RateLimit) {
+			w.Header().Set("Retry-After", "60")
+			handlers.Repo.APIRateLimited(w, r)
+			return
+		}
+
+		err = handlers.Repo.DB.UpdateAPITokenLastUsed(t.ID, time.Now())
+		if err != nil {
+			app.ErrorLog.Println(err)
+		}
+
+		next.ServeHTTP(w, r.WithContext(helpers.WithAPIToken(r.Context(), t)))
+	})
+}
+
+// APIScope requires an api token with the given scope. When anonymous is true, requests
+// without a token are let through as well. Logged in users need a token too, as the API
+// skips the csrf check and so can't trust the session cookie.
+func APIScope(scope string, anonymous bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if t, ok := helpers.APIToken(r); ok {
+				if t.Scope != scope && t.Scope != "write" {
+					handlers.Repo.APIForbidden(w, r)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !anonymous {
+				handlers.Repo.APIUnauthorized(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
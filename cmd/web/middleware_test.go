@@ -2,8 +2,16 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"testing"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/tsawler/bookings-app/internal/handlers"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -29,3 +37,142 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not http.Handler but is %T", v))
 	}
 }
+
+func TestAPIBearer(t *testing.T) {
+	session = scs.New()
+	app.Session = session
+	app.ErrorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime)
+	app.InfoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	helpers.NewHelpers(&app)
+	handlers.NewHandlers(handlers.NewTestRepo(&app))
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	var tests = []struct {
+		name               string
+		token              string
+		scope              string
+		anonymous          bool
+		expectedStatusCode int
+	}{
+		{"no token", "", "read", false, http.StatusUnauthorized},
+		{"no token public", "", "write", true, http.StatusOK},
+		{"unknown token", "nope", "read", true, http.StatusUnauthorized},
+		{"expired token", "expired-token", "read", false, http.StatusUnauthorized},
+		{"read token", "read-token", "read", false, http.StatusOK},
+		{"read token writing", "read-token", "write", false, http.StatusForbidden},
+		{"read token writing public", "read-token", "write", true, http.StatusForbidden},
+		{"write token", "write-token", "write", false, http.StatusOK},
+		{"write token reading", "write-token", "read", false, http.StatusOK},
+	}
+
+	for _, e := range tests {
+		h := SessionLoad(APIBearer(APIScope(e.scope, e.anonymous)(ok)))
+
+		req := httptest.NewRequest("GET", "/api/v1/reservations/1", nil)
+		if e.token != "" {
+			req.Header.Set("Authorization", "Bearer "+e.token)
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+
+	// the limited token allows one request per minute
+	h := SessionLoad(APIBearer(APIScope("read", false)(ok)))
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/api/v1/reservations/1", nil)
+		req.Header.Set("Authorization", "Bearer limited-token")
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		codes = append(codes, rr.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Errorf("expected rate limit to reject the second request, got %v", codes)
+	}
+}
+
+func TestNoSurfExemptsAPIRequests(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := NoSurf(ok)
+
+	var tests = []struct {
+		name               string
+		url                string
+		bearer             bool
+		expectedStatusCode int
+	}{
+		{"api with bearer", "/api/v1/reservations", true, http.StatusOK},
+		{"api without bearer", "/api/v1/reservations", false, http.StatusOK},
+		{"site with bearer", "/make-reservation", true, http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", e.url, nil)
+		if e.bearer {
+			req.Header.Set("Authorization", "Bearer write-token")
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	err := i18n.Load("./../../locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got string
+	h := Localize(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = i18n.FromContext(r.Context())
+	}))
+
+	var tests = []struct {
+		name     string
+		url      string
+		header   string
+		expected string
+		cookie   bool
+	}{
+		{"default", "/", "", "en", false},
+		{"browser", "/", "de-DE,de;q=0.9", "de", false},
+		{"chosen", "/?lang=fr", "de", "fr", true},
+		{"unknown", "/?lang=xx", "", "en", false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		req.Header.Set("Accept-Language", e.header)
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		if got != e.expected {
+			t.Errorf("for %s expected %s but got %s", e.name, e.expected, got)
+		}
+
+		// only a choice made on the site is remembered
+		cookies := rr.Result().Cookies()
+		if e.cookie && (len(cookies) != 1 || cookies[0].Name != i18n.Cookie || cookies[0].Value != e.expected) {
+			t.Errorf("for %s expected the choice to be kept in a cookie but got %v", e.name, cookies)
+		} else if !e.cookie && len(cookies) != 0 {
+			t.Errorf("for %s expected no cookie but got %v", e.name, cookies)
+		}
+	}
+}
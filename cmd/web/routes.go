@@ -13,8 +13,25 @@ func routes(app *config.AppConfig) http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Use(middleware.Recoverer)
+
+	// probes and build info skip the session and csrf middleware, so load balancers polling
+	// them don't create sessions
+	mux.Get("/healthz", handlers.Repo.Healthz)
+	mux.Get("/readyz", handlers.Repo.Readyz)
+	mux.Get("/version", handlers.Repo.Version)
+
+	mux.Mount("/", siteRoutes(app))
+
+	return mux
+}
+
+// siteRoutes are the pages and the API, which use sessions
+func siteRoutes(app *config.AppConfig) http.Handler {
+	mux := chi.NewRouter()
+
 	mux.Use(NoSurf)
 	mux.Use(SessionLoad)
+	mux.Use(Localize)
 
 	mux.Get("/", handlers.Repo.Home)
 	mux.Get("/about", handlers.Repo.About)
@@ -28,10 +45,34 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/book-room", handlers.Repo.BookRoom)
 
 	mux.Get("/contact", handlers.Repo.Contact)
+	mux.Post("/currency", handlers.Repo.PostCurrency)
 
 	mux.Get("/make-reservation", handlers.Repo.Reservation)
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+	mux.Post("/choose-rooms", handlers.Repo.ChooseRooms)
+	mux.Get("/make-booking", handlers.Repo.MakeBooking)
+	mux.Post("/make-booking", handlers.Repo.PostMakeBooking)
+	mux.Get("/booking-summary", handlers.Repo.BookingSummary)
+	mux.Get("/waitlist", handlers.Repo.Waitlist)
+	mux.Post("/waitlist", handlers.Repo.PostWaitlist)
+	mux.Get("/waitlist/{token}", handlers.Repo.ClaimWaitlistOffer)
+
+	mux.Get("/ical/{token}.ics", handlers.Repo.RoomCalendarFeed)
+
+	mux.Get("/api/openapi.json", handlers.Repo.OpenAPI)
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.Use(APIBearer)
+		mux.NotFound(handlers.Repo.APINotFound)
+		mux.MethodNotAllowed(handlers.Repo.APIMethodNotAllowed)
+
+		mux.Get("/rooms", handlers.Repo.APIListRooms)
+		mux.Get("/rooms/{id}", handlers.Repo.APIGetRoom)
+		mux.Get("/availability", handlers.Repo.APIAvailability)
+		mux.With(APIScope("write", true)).Post("/reservations", handlers.Repo.APICreateReservation)
+		mux.With(APIScope("read", false)).Get("/reservations/{id}", handlers.Repo.APIGetReservation)
+		mux.With(APIScope("write", false)).Post("/reservations/{id}/cancel", handlers.Repo.APICancelReservation)
+	})
 
 	mux.Get("/user/login", handlers.Repo.ShowLogin)
 	mux.Post("/user/login", handlers.Repo.PostShowLogin)
@@ -48,9 +89,71 @@ func routes(app *config.AppConfig) http.Handler {
 		mux.Post("/reservations-calendar", handlers.Repo.AdminPostCalendarReservations)
 		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
 		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+		mux.Get("/cancel-reservation/{src}/{id}/do", handlers.Repo.AdminCancelReservation)
 
 		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+
+		mux.Get("/calendar-feeds", handlers.Repo.AdminCalendarFeeds)
+		mux.Post("/calendar-feeds/{id}/rotate", handlers.Repo.AdminRotateCalendarFeed)
+
+		mux.Get("/external-calendars", handlers.Repo.AdminExternalCalendars)
+		mux.Post("/external-calendars", handlers.Repo.AdminPostExternalCalendar)
+		mux.Post("/external-calendars/{id}/sync", handlers.Repo.AdminSyncExternalCalendar)
+		mux.Post("/external-calendars/{id}/delete", handlers.Repo.AdminDeleteExternalCalendar)
+
+		mux.Get("/api-tokens", handlers.Repo.AdminAPITokens)
+		mux.Post("/api-tokens", handlers.Repo.AdminPostAPIToken)
+		mux.Post("/api-tokens/{id}/delete", handlers.Repo.AdminDeleteAPIToken)
+
+		mux.Get("/bookings", handlers.Repo.AdminBookings)
+		mux.Get("/bookings/{id}", handlers.Repo.AdminShowBooking)
+		mux.Post("/bookings/{id}/cancel", handlers.Repo.AdminCancelBooking)
+		mux.Post("/bookings/{id}/rooms/{reservation_id}/cancel", handlers.Repo.AdminCancelBookingRoom)
+
+		mux.Get("/waitlist", handlers.Repo.AdminWaitlist)
+		mux.Post("/waitlist/{id}/delete", handlers.Repo.AdminDeleteWaitlistEntry)
+
+		mux.Get("/rooms", handlers.Repo.AdminRooms)
+		mux.Post("/rooms/{id}/rate", handlers.Repo.AdminPostRoomRate)
+		mux.Post("/rooms/{id}/occupancy", handlers.Repo.AdminPostRoomOccupancy)
+		mux.Post("/rooms/{id}/cancellation-policy", handlers.Repo.AdminPostRoomCancellationPolicy)
+
+		mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+		mux.Post("/cancellation-policies", handlers.Repo.AdminPostCancellationPolicy)
+
+		mux.Post("/reservations/{id}/folio/charges", handlers.Repo.AdminPostFolioCharge)
+		mux.Post("/reservations/{id}/folio/payments", handlers.Repo.AdminPostFolioPayment)
+		mux.Get("/balances", handlers.Repo.AdminBalances)
+		mux.Get("/reservations/{id}/invoice.pdf", handlers.Repo.AdminReservationInvoice)
+		mux.Post("/reservations/{id}/checkout-email", handlers.Repo.AdminPostCheckoutEmail)
+
+		mux.Post("/payments/{id}/capture", handlers.Repo.AdminPostPaymentCapture)
+		mux.Post("/payments/{id}/void", handlers.Repo.AdminPostPaymentVoid)
+		mux.Post("/payments/{id}/refund", handlers.Repo.AdminPostPaymentRefund)
+
+		mux.Get("/taxes", handlers.Repo.AdminTaxes)
+		mux.Post("/taxes", handlers.Repo.AdminPostTax)
+		mux.Post("/taxes/{id}/active", handlers.Repo.AdminPostTaxActive)
+
+		mux.Get("/currencies", handlers.Repo.AdminCurrencies)
+		mux.Post("/currencies", handlers.Repo.AdminPostExchangeRate)
+		mux.Post("/currencies/import", handlers.Repo.AdminPostImportExchangeRates)
+		mux.Post("/currencies/{id}/delete", handlers.Repo.AdminPostDeleteExchangeRate)
+
+		mux.Get("/promo-codes", handlers.Repo.AdminPromoCodes)
+		mux.Post("/promo-codes", handlers.Repo.AdminPostPromoCode)
+		mux.Get("/promo-codes/{id}", handlers.Repo.AdminShowPromoCode)
+		mux.Post("/promo-codes/{id}/active", handlers.Repo.AdminPostPromoCodeActive)
+
+		mux.Get("/stay-rules", handlers.Repo.AdminStayRules)
+		mux.Post("/stay-rules", handlers.Repo.AdminPostStayRule)
+		mux.Post("/stay-rules/{id}/delete", handlers.Repo.AdminDeleteStayRule)
+
+		mux.Get("/webhooks", handlers.Repo.AdminWebhooks)
+		mux.Post("/webhooks", handlers.Repo.AdminPostWebhook)
+		mux.Post("/webhooks/{id}/delete", handlers.Repo.AdminDeleteWebhook)
+		mux.Get("/webhooks/{id}/deliveries", handlers.Repo.AdminWebhookDeliveries)
 	})
 
 	fileServer := http.FileServer(http.Dir("./static/"))
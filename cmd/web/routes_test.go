@@ -2,9 +2,15 @@ package main
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi"
 	"github.com/tsawler/bookings-app/internal/config"
-	"testing"
+	"github.com/tsawler/bookings-app/internal/handlers"
 )
 
 func TestRoutes(t *testing.T) {
@@ -19,3 +25,91 @@ func TestRoutes(t *testing.T) {
 		t.Error(fmt.Sprintf("type is not *chi.Mux, but is %T", v))
 	}
 }
+
+func TestAPIRoutesDocumented(t *testing.T) {
+	var app config.AppConfig
+
+	spec := handlers.OpenAPISpec()
+	mux := routes(&app).(*chi.Mux)
+
+	found := 0
+	err := chi.Walk(mux, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, "/api/") && !strings.HasSuffix(route, "-json") {
+			return nil
+		}
+
+		found++
+		if spec.Operation(route, method) == nil {
+			t.Errorf("%s %s is not documented in the OpenAPI spec", method, route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if found == 0 {
+		t.Error("no API routes found")
+	}
+}
+
+func TestProbesSkipSessionAndCSRF(t *testing.T) {
+	var app config.AppConfig
+
+	mux := routes(&app)
+
+	for _, path := range []string{"/healthz", "/version"} {
+		req := httptest.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected %d but got %d", path, http.StatusOK, rr.Code)
+		}
+		if cookies := rr.Header().Values("Set-Cookie"); len(cookies) > 0 {
+			t.Errorf("%s: expected no cookies but got %v", path, cookies)
+		}
+	}
+}
+
+func TestAPIRoutesSkipCSRF(t *testing.T) {
+	session = scs.New()
+	app.Session = session
+	handlers.NewHandlers(handlers.NewTestRepo(&app))
+
+	mux := routes(&app)
+
+	var tests = []struct {
+		name               string
+		url                string
+		expectedStatusCode int
+		expectedCode       string
+	}{
+		// reaches the handler, which rejects the body, rather than failing the csrf check
+		{"anonymous create", "/api/v1/reservations", http.StatusBadRequest, "invalid_json"},
+		{"anonymous cancel", "/api/v1/reservations/1/cancel", http.StatusUnauthorized, "unauthorized"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", e.url, strings.NewReader("not json"))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), `"code": "`+e.expectedCode+`"`) {
+			t.Errorf("%s: expected a %s error in the JSON envelope but got %s", e.name, e.expectedCode, rr.Body.String())
+		}
+	}
+
+	// a page still needs the csrf token
+	req := httptest.NewRequest("POST", "/make-reservation", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected the csrf check to reject a page post but got %d", rr.Code)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -11,23 +12,49 @@ import (
 	mail "github.com/xhit/go-simple-mail/v2"
 )
 
-func listenForMail() {
+func listenForMail(w *workers) {
 	// Execute a function in the background
-	go func() {
+	w.Go(func(ctx context.Context) {
 		// Keep Listening
 		for {
 			// Get and listen from the channel (<-)
-			msg := <-app.MailChan
-			sendMsg(msg)
+			select {
+			case msg := <-app.MailChan:
+				sendMsg(msg)
+			case <-ctx.Done():
+				flushMail()
+				return
+			}
 		}
-	}()
+	})
+}
 
+// flushMail sends the email still waiting in the channel when the listener is stopped
+func flushMail() {
+	for {
+		select {
+		case msg := <-app.MailChan:
+			sendMsg(msg)
+		default:
+			return
+		}
+	}
 }
 
 func sendMsg(m models.MailData) {
 	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
+	server.Host = app.MailHost
+	server.Port = app.MailPort
+	server.Username = app.MailUsername
+	server.Password = app.MailPassword
+	switch app.MailEncryption {
+	case "ssl":
+		server.Encryption = mail.EncryptionSSLTLS
+	case "starttls":
+		server.Encryption = mail.EncryptionSTARTTLS
+	default:
+		server.Encryption = mail.EncryptionNone
+	}
 	server.KeepAlive = false
 	server.ConnectTimeout = 10 * time.Second
 	server.SendTimeout = 10 * time.Second
@@ -35,6 +62,7 @@ func sendMsg(m models.MailData) {
 	client, err := server.Connect()
 	if err != nil {
 		errorLog.Println(err)
+		return
 	}
 
 	email := mail.NewMSG()
@@ -52,6 +80,10 @@ func sendMsg(m models.MailData) {
 		email.SetBody(mail.TextHTML, msgToSend)
 	}
 
+	for _, a := range m.Attachments {
+		email.Attach(&mail.File{Name: a.Name, MimeType: a.ContentType, Data: a.Data})
+	}
+
 	err = email.Send(client)
 	if err != nil {
 		log.Println(err)
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/handlers"
+)
+
+// waitlistSweepInterval is how often expired waitlist offers are passed on to the next guest
+const waitlistSweepInterval = time.Minute
+
+func scheduleWaitlistReoffer(w *workers) {
+	// Execute a function in the background
+	w.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(waitlistSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			handlers.Repo.ReofferExpiredWaitlistOffers()
+		}
+	})
+}
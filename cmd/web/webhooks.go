@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/handlers"
+	"github.com/tsawler/bookings-app/internal/webhooks"
+)
+
+// webhookRetryInterval is how often failed webhook deliveries are checked for a retry
+const webhookRetryInterval = 30 * time.Second
+
+func listenForEvents(w *workers) {
+	dispatcher := webhooks.New(handlers.Repo.DB)
+
+	// due wakes the deliverer when an event has been stored
+	due := make(chan struct{}, 1)
+
+	// Execute a function in the background. It only stores events, so request handlers
+	// sending them never wait on a slow webhook endpoint.
+	w.Go(func(ctx context.Context) {
+		for {
+			select {
+			case e := <-app.EventChan:
+				err := dispatcher.Enqueue(e)
+				if err != nil {
+					errorLog.Println(err)
+					continue
+				}
+
+				select {
+				case due <- struct{}{}:
+				default:
+				}
+			case <-ctx.Done():
+				// keep events still waiting, so they are delivered after a restart
+				for {
+					select {
+					case e := <-app.EventChan:
+						err := dispatcher.Enqueue(e)
+						if err != nil {
+							errorLog.Println(err)
+						}
+					default:
+						return
+					}
+				}
+			}
+		}
+	})
+
+	// deliveries are posted in their own goroutine, when events are stored and to retry failures
+	w.Go(func(ctx context.Context) {
+		ticker := time.NewTicker(webhookRetryInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-due:
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			err := dispatcher.DeliverDue()
+			if err != nil {
+				errorLog.Println(err)
+			}
+		}
+	})
+}
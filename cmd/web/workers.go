@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// workers keeps track of goroutines running in the background, so they can be told to stop
+// and waited for together when the application shuts down
+type workers struct {
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+func newWorkers() *workers {
+	ctx, stop := context.WithCancel(context.Background())
+	return &workers{ctx: ctx, stop: stop}
+}
+
+// Go runs f in the background. f should return soon after its context is done.
+func (w *workers) Go(f func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		f(w.ctx)
+	}()
+}
+
+// Stop tells the workers to stop and waits for them to finish, or until ctx is done
+func (w *workers) Stop(ctx context.Context) error {
+	w.stop()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWorkers_Stop(t *testing.T) {
+	w := newWorkers()
+
+	stopped := make(chan struct{})
+	w.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := w.Stop(ctx)
+	if err != nil {
+		t.Fatalf("expected workers to stop but got %s", err)
+	}
+
+	select {
+	case <-stopped:
+	default:
+		t.Error("Stop returned before the worker finished")
+	}
+}
+
+func TestWorkers_StopDeadline(t *testing.T) {
+	w := newWorkers()
+
+	release := make(chan struct{})
+	defer close(release)
+	w.Go(func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := w.Stop(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to pass but got %v", err)
+	}
+}
+
+func TestSchedulers_Stop(t *testing.T) {
+	app.Timezone = time.UTC
+	app.DigestHour = time.Now().UTC().Hour()
+
+	w := newWorkers()
+	scheduleDigest(w)
+	scheduleHoldSweeper(w)
+	scheduleWaitlistReoffer(w)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := w.Stop(ctx)
+	if err != nil {
+		t.Errorf("expected schedulers to stop but got %s", err)
+	}
+}
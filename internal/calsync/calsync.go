@@ -0,0 +1,114 @@
+package calsync
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/ical"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// blockRestrictionID is the restriction type used for imported events
+const blockRestrictionID = 2
+
+// Syncer imports external iCalendar feeds as room blocks
+type Syncer struct {
+	DB     repository.DatabaseRepo
+	Client *http.Client
+}
+
+// New creates a syncer with a default http client
+func New(db repository.DatabaseRepo) *Syncer {
+	return &Syncer{
+		DB:     db,
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SyncAll syncs every configured external calendar, recording the outcome of each
+func (s *Syncer) SyncAll() error {
+	calendars, err := s.DB.AllExternalCalendars()
+	if err != nil {
+		return err
+	}
+
+	for _, c := range calendars {
+		_ = s.Sync(c)
+	}
+
+	return nil
+}
+
+// Sync imports a single external calendar and records the outcome on it
+func (s *Syncer) Sync(c models.ExternalCalendar) error {
+	err := s.sync(c)
+
+	syncError := ""
+	if err != nil {
+		syncError = err.Error()
+	}
+
+	updateErr := s.DB.UpdateExternalCalendarSync(c.ID, time.Now(), syncError)
+	if err != nil {
+		return err
+	}
+
+	return updateErr
+}
+
+func (s *Syncer) sync(c models.ExternalCalendar) error {
+	resp, err := s.Client.Get(c.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching feed returned %s", resp.Status)
+	}
+
+	events, err := ical.Parse(resp.Body)
+	if err != nil {
+		return fmt.Errorf("parsing feed: %w", err)
+	}
+
+	existing, err := s.DB.GetBlocksForExternalCalendar(c.ID)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+
+	for _, e := range events {
+		if e.UID == "" || seen[e.UID] {
+			continue
+		}
+		seen[e.UID] = true
+
+		err := s.DB.UpsertExternalBlock(models.RoomRestriction{
+			StartDate:          e.Start,
+			EndDate:            e.End,
+			RoomID:             c.RoomID,
+			RestrictionID:      blockRestrictionID,
+			ExternalCalendarID: c.ID,
+			ExternalUID:        e.UID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// remove blocks for events that are no longer in the feed
+	for _, x := range existing {
+		if !seen[x.ExternalUID] {
+			err := s.DB.DeleteBlockById(x.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
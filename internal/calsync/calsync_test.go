@@ -0,0 +1,136 @@
+package calsync
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// fakeRepo keeps imported blocks in memory
+type fakeRepo struct {
+	repository.DatabaseRepo
+	blocks    map[string]models.RoomRestriction
+	deleted   []int
+	syncError string
+}
+
+func (f *fakeRepo) GetBlocksForExternalCalendar(calendarId int) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+	for _, b := range f.blocks {
+		restrictions = append(restrictions, b)
+	}
+	return restrictions, nil
+}
+
+func (f *fakeRepo) UpsertExternalBlock(r models.RoomRestriction) error {
+	if existing, ok := f.blocks[r.ExternalUID]; ok {
+		r.ID = existing.ID
+	} else {
+		r.ID = len(f.blocks) + 100
+	}
+	f.blocks[r.ExternalUID] = r
+	return nil
+}
+
+func (f *fakeRepo) DeleteBlockById(id int) error {
+	f.deleted = append(f.deleted, id)
+	for uid, b := range f.blocks {
+		if b.ID == id {
+			delete(f.blocks, uid)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRepo) UpdateExternalCalendarSync(id int, syncedAt time.Time, syncError string) error {
+	f.syncError = syncError
+	return nil
+}
+
+func TestSync(t *testing.T) {
+	feed := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:booking-1\r\n" +
+		"DTSTART;VALUE=DATE:20500101\r\n" +
+		"DTEND;VALUE=DATE:20500103\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/calendar")
+		w.Write([]byte(feed))
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{
+		blocks: map[string]models.RoomRestriction{
+			"stale": {ID: 1, RoomID: 1, ExternalCalendarID: 1, ExternalUID: "stale"},
+		},
+	}
+	s := New(repo)
+
+	cal := models.ExternalCalendar{ID: 1, RoomID: 1, URL: srv.URL}
+
+	err := s.Sync(cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, ok := repo.blocks["booking-1"]
+	if !ok {
+		t.Fatal("event was not imported as a block")
+	}
+
+	if b.RestrictionID != blockRestrictionID || b.RoomID != 1 || b.ExternalCalendarID != 1 {
+		t.Errorf("imported block has unexpected values %+v", b)
+	}
+
+	if _, ok := repo.blocks["stale"]; ok {
+		t.Error("block removed from the feed was not deleted")
+	}
+
+	// feed changes the dates of the booking
+	feed = "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:booking-1\r\n" +
+		"DTSTART;VALUE=DATE:20500105\r\n" +
+		"DTEND;VALUE=DATE:20500106\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	err = s.Sync(cal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !repo.blocks["booking-1"].StartDate.Equal(time.Date(2050, 1, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("block was not updated, got %s", repo.blocks["booking-1"].StartDate)
+	}
+
+	if len(repo.blocks) != 1 {
+		t.Errorf("expected 1 block but have %d", len(repo.blocks))
+	}
+}
+
+func TestSyncError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{blocks: map[string]models.RoomRestriction{}}
+	s := New(repo)
+
+	err := s.Sync(models.ExternalCalendar{ID: 1, RoomID: 1, URL: srv.URL})
+	if err == nil {
+		t.Fatal("expected an error for a missing feed")
+	}
+
+	if repo.syncError == "" {
+		t.Error("sync error was not recorded on the calendar")
+	}
+}
@@ -0,0 +1,93 @@
+package cancellation
+
+import (
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/currency"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Penalty types
+const (
+	Percent    = "percent"
+	FirstNight = "first_night"
+	FullStay   = "full"
+)
+
+// Penalty returns what a guest is charged, in cents, for cancelling a reservation
+// under a policy at the given time. Without a policy cancelling is free.
+func Penalty(p models.CancellationPolicy, res models.Reservation, now time.Time) int {
+	if p.ID == 0 {
+		return 0
+	}
+
+	total := res.Total()
+
+	if !p.NonRefundable && clock.DaysBetween(now, res.StartDate) >= p.FreeDays {
+		return 0
+	}
+
+	var penalty int
+
+	switch p.PenaltyType {
+	case Percent:
+		penalty = currency.Percent(total, p.PenaltyPercent)
+	case FirstNight:
+		if nights := res.Nights(); nights > 0 {
+			penalty = total / nights
+		}
+	default:
+		penalty = total
+	}
+
+	if penalty > total {
+		penalty = total
+	}
+	if penalty < 0 {
+		penalty = 0
+	}
+
+	return penalty
+}
+
+// Refund returns what a guest gets back, in cents, of what they have paid once the
+// penalty is kept
+func Refund(paid, penalty int) int {
+	if refund := paid - penalty; refund > 0 {
+		return refund
+	}
+	return 0
+}
+
+// Terms explains a policy to guests
+func Terms(p models.CancellationPolicy) i18n.Message {
+	if p.ID == 0 {
+		return i18n.M("Free cancellation until arrival.")
+	}
+
+	var charge i18n.Message
+	switch p.PenaltyType {
+	case Percent:
+		charge = i18n.M("%d%% of the price", p.PenaltyPercent)
+	case FirstNight:
+		charge = i18n.M("the first night")
+	default:
+		charge = i18n.M("the full price")
+	}
+
+	if p.NonRefundable {
+		return i18n.M("Non-refundable: cancelling costs %s.", charge)
+	}
+
+	if p.FreeDays == 0 {
+		return i18n.M("Free cancellation until the day of arrival, then %s is charged.", charge)
+	}
+
+	if p.FreeDays == 1 {
+		return i18n.M("Free cancellation until 1 day before arrival, then %s is charged.", charge)
+	}
+
+	return i18n.M("Free cancellation until %d days before arrival, then %s is charged.", p.FreeDays, charge)
+}
@@ -0,0 +1,82 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+// three nights from 2050-07-10 at 30000, less a 3000 discount
+var stay = models.Reservation{
+	StartDate: date("2050-07-10"),
+	EndDate:   date("2050-07-13"),
+	Subtotal:  30000,
+	Discount:  3000,
+}
+
+var penaltyTests = []struct {
+	name     string
+	policy   models.CancellationPolicy
+	now      string
+	expected int
+}{
+	{"no policy", models.CancellationPolicy{}, "2050-07-10", 0},
+	{"inside the free window", models.CancellationPolicy{ID: 1, FreeDays: 7, PenaltyType: Percent, PenaltyPercent: 50}, "2050-07-01", 0},
+	{"last free day", models.CancellationPolicy{ID: 1, FreeDays: 7, PenaltyType: Percent, PenaltyPercent: 50}, "2050-07-03", 0},
+	{"percentage", models.CancellationPolicy{ID: 1, FreeDays: 7, PenaltyType: Percent, PenaltyPercent: 50}, "2050-07-04", 13500},
+	{"first night", models.CancellationPolicy{ID: 1, FreeDays: 2, PenaltyType: FirstNight}, "2050-07-09", 9000},
+	{"full stay", models.CancellationPolicy{ID: 1, FreeDays: 2, PenaltyType: FullStay}, "2050-07-09", 27000},
+	{"free until arrival", models.CancellationPolicy{ID: 1, PenaltyType: FullStay}, "2050-07-10", 0},
+	{"after arrival", models.CancellationPolicy{ID: 1, PenaltyType: FullStay}, "2050-07-11", 27000},
+	{"non-refundable", models.CancellationPolicy{ID: 1, FreeDays: 30, PenaltyType: FullStay, NonRefundable: true}, "2050-01-01", 27000},
+	{"percentage over 100", models.CancellationPolicy{ID: 1, PenaltyType: Percent, PenaltyPercent: 150, NonRefundable: true}, "2050-01-01", 27000},
+}
+
+func TestPenalty(t *testing.T) {
+	for _, e := range penaltyTests {
+		got := Penalty(e.policy, stay, date(e.now).Add(15*time.Hour))
+		if got != e.expected {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestRefund(t *testing.T) {
+	if got := Refund(27000, 9000); got != 18000 {
+		t.Errorf("expected 18000 but got %d", got)
+	}
+
+	// only a deposit was paid, which the penalty keeps part of
+	if got := Refund(9000, 4500); got != 4500 {
+		t.Errorf("expected 4500 but got %d", got)
+	}
+
+	if got := Refund(9000, 27000); got != 0 {
+		t.Errorf("expected no refund for a penalty above what was paid but got %d", got)
+	}
+}
+
+var termsTests = []struct {
+	policy   models.CancellationPolicy
+	expected string
+}{
+	{models.CancellationPolicy{}, "Free cancellation until arrival."},
+	{models.CancellationPolicy{ID: 1, FreeDays: 7, PenaltyType: Percent, PenaltyPercent: 50}, "Free cancellation until 7 days before arrival, then 50% of the price is charged."},
+	{models.CancellationPolicy{ID: 1, FreeDays: 1, PenaltyType: FirstNight}, "Free cancellation until 1 day before arrival, then the first night is charged."},
+	{models.CancellationPolicy{ID: 1, PenaltyType: FullStay}, "Free cancellation until the day of arrival, then the full price is charged."},
+	{models.CancellationPolicy{ID: 1, PenaltyType: FullStay, NonRefundable: true}, "Non-refundable: cancelling costs the full price."},
+}
+
+func TestTerms(t *testing.T) {
+	for _, e := range termsTests {
+		if got := Terms(e.policy).String(); got != e.expected {
+			t.Errorf("expected %q but got %q", e.expected, got)
+		}
+	}
+}
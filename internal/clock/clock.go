@@ -0,0 +1,64 @@
+// Package clock tells the time where the property is. The dates of a stay are calendar
+// dates, kept as midnight UTC whatever the timezone, so "today" has to be worked out in the
+// property's timezone rather than the server's before it is compared with them.
+package clock
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeOfDay is a time on the property's clock, such as check-in at 14:00
+type TimeOfDay struct {
+	Hour   int
+	Minute int
+}
+
+// ParseTimeOfDay reads a time of day written as 15:04, such as 14:00 or 9:30
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return TimeOfDay{}, fmt.Errorf("%q is not a time such as 14:00", s)
+	}
+	return TimeOfDay{Hour: t.Hour(), Minute: t.Minute()}, nil
+}
+
+// String writes the time of day as 14:00
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
+}
+
+// Now returns the current time on the property's clock
+func Now(loc *time.Location) time.Time {
+	return time.Now().In(loc)
+}
+
+// Date returns the calendar date at the property when something happened, as midnight UTC
+// like the dates of a stay
+func Date(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Day drops the time of day from a date of a stay, keeping its calendar date as midnight UTC.
+// Unlike Date it doesn't move t to the property's timezone first.
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// DaysBetween returns how many whole days there are from one calendar date to another,
+// negative when to is before from
+func DaysBetween(from, to time.Time) int {
+	return int(Day(to).Sub(Day(from)).Hours() / 24)
+}
+
+// Today returns the calendar date at the property, as midnight UTC like the dates of a stay
+func Today(loc *time.Location) time.Time {
+	return Date(time.Now(), loc)
+}
+
+// At returns when a time of day happens at the property on a calendar date, such as the
+// check-in time on the arrival date
+func At(date time.Time, t TimeOfDay, loc *time.Location) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour, t.Minute, 0, 0, loc)
+}
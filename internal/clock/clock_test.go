@@ -0,0 +1,96 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeOfDay(t *testing.T) {
+	var tests = []struct {
+		s        string
+		expected string
+		ok       bool
+	}{
+		{"14:00", "14:00", true},
+		{"9:30", "09:30", true},
+		{"23:59", "23:59", true},
+		{"24:00", "", false},
+		{"2pm", "", false},
+		{"", "", false},
+	}
+
+	for _, e := range tests {
+		got, err := ParseTimeOfDay(e.s)
+		if (err == nil) != e.ok {
+			t.Errorf("%q: expected ok %v but got error %v", e.s, e.ok, err)
+			continue
+		}
+		if e.ok && got.String() != e.expected {
+			t.Errorf("%q: expected %s but got %s", e.s, e.expected, got)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	brisbane := time.FixedZone("AEST", 10*60*60)
+	honolulu := time.FixedZone("HST", -10*60*60)
+
+	// late evening UTC is already the next morning in Brisbane, and still the same day in Honolulu
+	now := time.Date(2050, 1, 31, 22, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		loc      *time.Location
+		expected time.Time
+	}{
+		{time.UTC, time.Date(2050, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{brisbane, time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{honolulu, time.Date(2050, 1, 31, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, e := range tests {
+		if got := Date(now, e.loc); !got.Equal(e.expected) || got.Location() != time.UTC {
+			t.Errorf("%s: expected %s but got %s", e.loc, e.expected, got)
+		}
+	}
+
+	if got := Today(brisbane); !got.Equal(Date(time.Now(), brisbane)) {
+		t.Errorf("expected today in Brisbane but got %s", got)
+	}
+}
+
+func TestAt(t *testing.T) {
+	brisbane := time.FixedZone("AEST", 10*60*60)
+	arrival := time.Date(2050, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	got := At(arrival, TimeOfDay{Hour: 14}, brisbane)
+	if !got.Equal(time.Date(2050, 1, 31, 4, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 14:00 in Brisbane but got %s", got)
+	}
+}
+
+func TestDay(t *testing.T) {
+	brisbane := time.FixedZone("AEST", 10*60*60)
+
+	// the calendar date is kept as written, not moved to UTC
+	got := Day(time.Date(2050, 2, 1, 7, 30, 0, 0, brisbane))
+	if expected := time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC); !got.Equal(expected) {
+		t.Errorf("expected %s but got %s", expected, got)
+	}
+
+	var tests = []struct {
+		from     time.Time
+		to       time.Time
+		expected int
+	}{
+		{time.Date(2050, 1, 30, 0, 0, 0, 0, time.UTC), time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC), 2},
+		{time.Date(2050, 1, 30, 23, 0, 0, 0, time.UTC), time.Date(2050, 1, 31, 1, 0, 0, 0, time.UTC), 1},
+		{time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2050, 1, 30, 0, 0, 0, 0, time.UTC), -2},
+		{time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2050, 2, 1, 12, 0, 0, 0, time.UTC), 0},
+	}
+
+	for _, e := range tests {
+		if got := DaysBetween(e.from, e.to); got != e.expected {
+			t.Errorf("%s to %s: expected %d but got %d", e.from, e.to, e.expected, got)
+		}
+	}
+}
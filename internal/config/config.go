@@ -3,18 +3,50 @@ package config
 import (
 	"html/template"
 	"log"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/currency"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
 )
 
 // AppConfig holds the application config
 type AppConfig struct {
-	UseCache      bool
-	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
-	InProduction  bool
-	Session       *scs.SessionManager
-	MailChan      chan models.MailData
+	UseCache             bool
+	TemplateCache        map[string]*template.Template
+	SchemaVersion        string
+	InfoLog              *log.Logger
+	ErrorLog             *log.Logger
+	InProduction         bool
+	Port                 int
+	SessionLifetime      time.Duration
+	ShutdownTimeout      time.Duration
+	BaseURL              string
+	Session              *scs.SessionManager
+	MailChan             chan models.MailData
+	MailHost             string
+	MailPort             int
+	MailUsername         string
+	MailPassword         string
+	MailEncryption       string
+	MailFrom             string
+	EventChan            chan models.WebhookEvent
+	StaffEmails          []string
+	SendDigest           bool
+	DigestHour           int
+	CalendarSyncInterval time.Duration
+	HoldDuration         time.Duration
+	WaitlistOfferTTL     time.Duration
+	Payments             payments.Provider
+	Deposit              payments.DepositRule
+	PropertyName         string
+	PropertyAddress      string
+	PropertyEmail        string
+	PropertyPhone        string
+	Timezone             *time.Location
+	CheckInTime          clock.TimeOfDay
+	CheckOutTime         clock.TimeOfDay
+	Currencies           *currency.Table
 }
@@ -0,0 +1,330 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the name of the environment variable for each setting, such as BOOKINGS_DBNAME
+const EnvPrefix = "BOOKINGS_"
+
+// Settings holds what the application is configured with at startup. Each setting has a name,
+// used as its flag (-dbname), its key in the config file (dbname: bookings) and, upper cased
+// after EnvPrefix, its environment variable (BOOKINGS_DBNAME).
+type Settings struct {
+	Production      bool          `setting:"production" default:"false" usage:"Application is in production, so cookies are only sent over https"`
+	UseCache        bool          `setting:"cache" default:"true" usage:"Using template cache"`
+	Port            int           `setting:"port" default:"8080" usage:"Port the web server listens on"`
+	SessionLifetime time.Duration `setting:"sessionlifetime" default:"24h" usage:"How long a session lasts"`
+	ShutdownTimeout time.Duration `setting:"shutdowntimeout" default:"30s" usage:"How long to wait on requests, background work and email when shutting down"`
+	BaseURL         string        `setting:"baseurl" default:"http://localhost:8080" usage:"Public address of the site, such as https://bookings.example.com, used in links sent by email"`
+
+	DBHost string `setting:"dbhost" default:"localhost" usage:"Database host"`
+	DBPort string `setting:"dbport" default:"5432" usage:"Database port"`
+	DBName string `setting:"dbname" required:"true" usage:"Database name"`
+	DBUser string `setting:"dbuser" required:"true" usage:"Database user"`
+	DBPass string `setting:"dbpass" usage:"Database password"`
+	DBSSL  string `setting:"dbssl" default:"prefer" usage:"Database ssl settings (disable, prefer, require)"`
+
+	MailHost       string `setting:"mailhost" default:"localhost" usage:"SMTP server email is sent through"`
+	MailPort       int    `setting:"mailport" default:"1025" usage:"SMTP server port"`
+	MailUsername   string `setting:"mailusername" usage:"SMTP user name, if the server needs one"`
+	MailPassword   string `setting:"mailpassword" usage:"SMTP password"`
+	MailEncryption string `setting:"mailencryption" default:"none" usage:"SMTP encryption: none, ssl or starttls"`
+	MailFrom       string `setting:"mailfrom" default:"me@helloworld.com" usage:"Address email to guests and staff is sent from"`
+
+	StaffEmails   []string      `setting:"staffemails" usage:"Comma separated staff emails notified of new reservations"`
+	SendDigest    bool          `setting:"digest" default:"false" usage:"Send a daily reservation digest to staff"`
+	DigestHour    int           `setting:"digesthour" default:"7" usage:"Hour of the day (0-23) the digest is sent"`
+	HoldMinutes   int           `setting:"holdminutes" default:"15" usage:"Minutes a chosen room is held while the guest books (0 disables)"`
+	WaitlistHours int           `setting:"waitlisthours" default:"24" usage:"Hours a waitlist booking link stays valid"`
+	CalendarSync  time.Duration `setting:"calendarsync" default:"15m" usage:"Interval between external calendar imports (0 disables)"`
+
+	Payments      string `setting:"payments" default:"fake" usage:"Payment provider taking deposits (fake)"`
+	Deposit       string `setting:"deposit" default:"first_night" usage:"Deposit taken when booking: none, fixed, percent or first_night"`
+	DepositAmount int    `setting:"depositamount" default:"0" usage:"Deposit in cents when fixed, or the percentage when percent"`
+
+	PropertyName    string `setting:"propertyname" default:"Five Star Best breakfast hostel" usage:"Property name printed on invoices"`
+	PropertyAddress string `setting:"propertyaddress" default:"Brisbane, Australia" usage:"Property address printed on invoices"`
+	PropertyEmail   string `setting:"propertyemail" default:"me@helloworld.com" usage:"Property email printed on invoices and sending checkout emails"`
+	PropertyPhone   string `setting:"propertyphone" usage:"Property phone number printed on invoices"`
+	Currency        string `setting:"currency" default:"AUD" usage:"Currency prices are set and charged in"`
+	Timezone        string `setting:"timezone" default:"Australia/Brisbane" usage:"Timezone of the property, such as Europe/Berlin, deciding what day it is"`
+	CheckIn         string `setting:"checkin" default:"14:00" usage:"Time guests can check in from, on the property's clock"`
+	CheckOut        string `setting:"checkout" default:"10:00" usage:"Time guests must check out by, on the property's clock"`
+}
+
+// LoadSettings reads the settings from, in increasing precedence: their defaults, the YAML
+// file named by -config or BOOKINGS_CONFIG, environment variables, including any in a .env
+// file in the working directory, and the flags in args. Variables already in the environment
+// win over those in .env.
+func LoadSettings(name string, args []string) (Settings, error) {
+	var s Settings
+
+	fields := settingFields(&s)
+
+	// flags are read first, to find the config file, but applied last
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := flags.String("config", "", "YAML file to read settings from")
+	given := make(map[string]string)
+	for _, f := range fields {
+		flags.Var(&flagValue{field: f, given: given}, f.name, f.usage)
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return s, err
+	}
+
+	for _, f := range fields {
+		if f.def != "" {
+			err = f.set(f.def)
+			if err != nil {
+				return s, fmt.Errorf("default for %s: %w", f.name, err)
+			}
+		}
+	}
+
+	err = godotenv.Load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return s, fmt.Errorf(".env: %w", err)
+	}
+
+	if *configFile == "" {
+		*configFile = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	if *configFile != "" {
+		err = readSettingsFile(*configFile, fields)
+		if err != nil {
+			return s, err
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.env()); ok {
+			err = f.set(v)
+			if err != nil {
+				return s, fmt.Errorf("%s: %w", f.env(), err)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := given[f.name]; ok {
+			err = f.set(v)
+			if err != nil {
+				return s, fmt.Errorf("-%s: %w", f.name, err)
+			}
+		}
+	}
+
+	return s, s.Validate()
+}
+
+// Validate checks that the required settings are given and the others make sense
+func (s Settings) Validate() error {
+	var problems []string
+
+	for _, f := range settingFields(&s) {
+		if f.required && f.value.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s is required", f.name))
+		}
+	}
+
+	if s.Port < 1 || s.Port > 65535 {
+		problems = append(problems, "port must be between 1 and 65535")
+	}
+	if s.MailPort < 1 || s.MailPort > 65535 {
+		problems = append(problems, "mailport must be between 1 and 65535")
+	}
+	if s.SessionLifetime <= 0 {
+		problems = append(problems, "sessionlifetime must be more than 0")
+	}
+	if s.ShutdownTimeout <= 0 {
+		problems = append(problems, "shutdowntimeout must be more than 0")
+	}
+	if u, err := url.Parse(s.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "baseurl must be an http or https address, such as https://bookings.example.com")
+	}
+	if s.DigestHour < 0 || s.DigestHour > 23 {
+		problems = append(problems, "digesthour must be between 0 and 23")
+	}
+	if s.HoldMinutes < 0 {
+		problems = append(problems, "holdminutes can't be negative")
+	}
+	if s.WaitlistHours < 1 {
+		problems = append(problems, "waitlisthours must be at least 1")
+	}
+	if s.CalendarSync < 0 {
+		problems = append(problems, "calendarsync can't be negative")
+	}
+
+	switch s.MailEncryption {
+	case "none", "ssl", "starttls":
+	default:
+		problems = append(problems, "mailencryption must be none, ssl or starttls")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid settings: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// readSettingsFile sets the settings given in a YAML file. Keys that aren't settings are an
+// error, so a misspelt one isn't silently ignored.
+func readSettingsFile(path string, fields []settingField) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]interface{}
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	byName := make(map[string]settingField)
+	for _, f := range fields {
+		byName[f.name] = f
+	}
+
+	for key, v := range values {
+		f, ok := byName[key]
+		if !ok {
+			return fmt.Errorf("%s: unknown setting %q", path, key)
+		}
+
+		// lists, such as staff emails, may be written as YAML lists
+		s := fmt.Sprint(v)
+		if list, ok := v.([]interface{}); ok {
+			var items []string
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			s = strings.Join(items, ",")
+		}
+
+		err = f.set(s)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+
+	return nil
+}
+
+// settingField is one field of Settings, with what its tags say about it
+type settingField struct {
+	name     string
+	def      string
+	usage    string
+	required bool
+	value    reflect.Value
+}
+
+func settingFields(s *Settings) []settingField {
+	v := reflect.ValueOf(s).Elem()
+	t := v.Type()
+
+	var fields []settingField
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag
+		fields = append(fields, settingField{
+			name:     tag.Get("setting"),
+			def:      tag.Get("default"),
+			usage:    tag.Get("usage"),
+			required: tag.Get("required") == "true",
+			value:    v.Field(i),
+		})
+	}
+
+	return fields
+}
+
+// env returns the name of the environment variable for the setting
+func (f settingField) env() string {
+	return EnvPrefix + strings.ToUpper(f.name)
+}
+
+// set parses a value written as text, as it is in flags and environment variables
+func (f settingField) set(s string) error {
+	s = strings.TrimSpace(s)
+
+	switch f.value.Interface().(type) {
+	case string:
+		f.value.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", s)
+		}
+		f.value.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		f.value.SetInt(int64(n))
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 15m", s)
+		}
+		f.value.SetInt(int64(d))
+	case []string:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.value.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("can't set a %s", f.value.Type())
+	}
+
+	return nil
+}
+
+// flagValue keeps what a flag was given, so flags can be applied after the other sources
+type flagValue struct {
+	field settingField
+	given map[string]string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.field.def
+}
+
+func (v *flagValue) Set(s string) error {
+	// parse it now, so a bad flag is reported like any other
+	probe := reflect.New(v.field.value.Type()).Elem()
+	err := settingField{value: probe}.set(s)
+	if err != nil {
+		return err
+	}
+
+	v.given[v.field.name] = s
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given as just -production
+func (v *flagValue) IsBoolFlag() bool {
+	return v.field.value.Kind() == reflect.Bool
+}
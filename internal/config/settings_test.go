@@ -0,0 +1,173 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSettingsFile(t *testing.T, s string) string {
+	path := filepath.Join(t.TempDir(), "bookings.yml")
+	err := os.WriteFile(path, []byte(s), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSettings_Defaults(t *testing.T) {
+	s, err := LoadSettings("bookings", []string{"-dbname=bookings", "-dbuser=postgres"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Production {
+		t.Error("expected production to be off by default")
+	}
+	if s.Port != 8080 || s.SessionLifetime != 24*time.Hour || s.MailPort != 1025 || s.MailFrom != "me@helloworld.com" {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+	if s.BaseURL != "http://localhost:8080" {
+		t.Errorf("unexpected base url %s", s.BaseURL)
+	}
+	if s.CalendarSync != 15*time.Minute || !s.UseCache || s.StaffEmails != nil {
+		t.Errorf("unexpected defaults %+v", s)
+	}
+}
+
+func TestLoadSettings_Precedence(t *testing.T) {
+	path := writeSettingsFile(t, `
+dbname: from_file
+dbuser: postgres
+port: 9000
+mailhost: smtp.example.com
+mailport: 587
+staffemails:
+  - one@example.com
+  - two@example.com
+production: true
+`)
+
+	t.Setenv("BOOKINGS_CONFIG", path)
+	t.Setenv("BOOKINGS_PORT", "9100")
+	t.Setenv("BOOKINGS_MAILPORT", "2525")
+	t.Setenv("BOOKINGS_SESSIONLIFETIME", "2h")
+
+	s, err := LoadSettings("bookings", []string{"-port", "9200", "-production=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name     string
+		got      interface{}
+		expected interface{}
+	}{
+		{"file over default", s.DBName, "from_file"},
+		{"file over default", s.MailHost, "smtp.example.com"},
+		{"env over file", s.MailPort, 2525},
+		{"env over default", s.SessionLifetime, 2 * time.Hour},
+		{"flag over env", s.Port, 9200},
+		{"flag over file", s.Production, false},
+		{"list from file", strings.Join(s.StaffEmails, ","), "one@example.com,two@example.com"},
+	}
+
+	for _, e := range tests {
+		if e.got != e.expected {
+			t.Errorf("%s: expected %v but got %v", e.name, e.expected, e.got)
+		}
+	}
+
+	// a config file given as a flag wins over the environment
+	other := writeSettingsFile(t, "dbname: other\ndbuser: postgres\n")
+	s, err = LoadSettings("bookings", []string{"-config", other})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.DBName != "other" || s.MailHost != "localhost" {
+		t.Errorf("expected settings from %s but got %+v", other, s)
+	}
+}
+
+func TestLoadSettings_Errors(t *testing.T) {
+	var tests = []struct {
+		name string
+		file string
+		env  string
+		args []string
+	}{
+		{"missing required", "", "", nil},
+		{"unknown flag", "", "", []string{"-dbname=b", "-dbuser=u", "-nope"}},
+		{"bad flag", "", "", []string{"-dbname=b", "-dbuser=u", "-port=http"}},
+		{"bad env", "", "soon", []string{"-dbname=b", "-dbuser=u"}},
+		{"unknown file key", "dbname: b\ndbuser: u\ndbnmae: c\n", "", nil},
+		{"bad file value", "dbname: b\ndbuser: u\nport: [1, 2]\n", "", nil},
+		{"broken file", "dbname: [", "", nil},
+		{"invalid value", "", "", []string{"-dbname=b", "-dbuser=u", "-digesthour=24"}},
+	}
+
+	for _, e := range tests {
+		t.Run(e.name, func(t *testing.T) {
+			if e.file != "" {
+				t.Setenv("BOOKINGS_CONFIG", writeSettingsFile(t, e.file))
+			}
+			if e.env != "" {
+				t.Setenv("BOOKINGS_CALENDARSYNC", e.env)
+			}
+
+			_, err := LoadSettings("bookings", e.args)
+			if err == nil {
+				t.Error("expected an error but got none")
+			}
+		})
+	}
+}
+
+func TestSettings_Validate(t *testing.T) {
+	valid := func() Settings {
+		return Settings{
+			DBName:          "bookings",
+			DBUser:          "postgres",
+			Port:            8080,
+			SessionLifetime: time.Hour,
+			ShutdownTimeout: time.Second,
+			BaseURL:         "https://bookings.example.com",
+			MailPort:        25,
+			MailEncryption:  "starttls",
+			DigestHour:      7,
+			WaitlistHours:   24,
+		}
+	}
+
+	if err := valid().Validate(); err != nil {
+		t.Errorf("expected valid settings but got %s", err)
+	}
+
+	var tests = []struct {
+		name   string
+		change func(s *Settings)
+	}{
+		{"no database name", func(s *Settings) { s.DBName = "" }},
+		{"no database user", func(s *Settings) { s.DBUser = "" }},
+		{"port too high", func(s *Settings) { s.Port = 70000 }},
+		{"no mail port", func(s *Settings) { s.MailPort = 0 }},
+		{"no session lifetime", func(s *Settings) { s.SessionLifetime = 0 }},
+		{"no shutdown timeout", func(s *Settings) { s.ShutdownTimeout = 0 }},
+		{"base url without scheme", func(s *Settings) { s.BaseURL = "bookings.example.com" }},
+		{"digest hour", func(s *Settings) { s.DigestHour = -1 }},
+		{"negative hold", func(s *Settings) { s.HoldMinutes = -5 }},
+		{"no waitlist hours", func(s *Settings) { s.WaitlistHours = 0 }},
+		{"negative calendar sync", func(s *Settings) { s.CalendarSync = -time.Minute }},
+		{"mail encryption", func(s *Settings) { s.MailEncryption = "tls" }},
+	}
+
+	for _, e := range tests {
+		s := valid()
+		e.change(&s)
+		if err := s.Validate(); err == nil {
+			t.Errorf("%s: expected an error but got none", e.name)
+		}
+	}
+}
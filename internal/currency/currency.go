@@ -0,0 +1,265 @@
+// Package currency shows prices in the currency a guest chooses, converted from the base
+// currency with the exchange rates staff keep. Conversions are for display only; charges
+// are always made in the base currency.
+package currency
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Currency is a currency prices can be shown in
+type Currency struct {
+	Code     string
+	Symbol   string
+	Decimals int
+}
+
+var known = map[string]Currency{
+	"AUD": {"AUD", "A$", 2},
+	"CAD": {"CAD", "CA$", 2},
+	"CHF": {"CHF", "CHF", 2},
+	"CNY": {"CNY", "CN¥", 2},
+	"EUR": {"EUR", "€", 2},
+	"GBP": {"GBP", "£", 2},
+	"HKD": {"HKD", "HK$", 2},
+	"INR": {"INR", "₹", 2},
+	"JPY": {"JPY", "¥", 0},
+	"KRW": {"KRW", "₩", 0},
+	"NZD": {"NZD", "NZ$", 2},
+	"SGD": {"SGD", "S$", 2},
+	"USD": {"USD", "US$", 2},
+}
+
+// Lookup returns a currency by its ISO 4217 code, such as EUR
+func Lookup(code string) (Currency, bool) {
+	c, ok := known[strings.ToUpper(code)]
+	return c, ok
+}
+
+// Codes returns the codes of every currency prices can be shown in, sorted
+func Codes() []string {
+	var codes []string
+	for code := range known {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// style is how a locale writes amounts of money
+type style struct {
+	group   string
+	decimal string
+	after   bool
+}
+
+var styles = map[string]style{
+	"en": {",", ".", false},
+	"ja": {",", ".", false},
+	"zh": {",", ".", false},
+	"de": {".", ",", true},
+	"es": {".", ",", true},
+	"it": {".", ",", true},
+	"pt": {".", ",", true},
+	"fr": {"\u202f", ",", true},
+}
+
+// Format writes an amount in the smallest unit of a currency, such as cents, the way a
+// locale such as en-AU or de writes it: A$1,234.50 or 1.234,50 €. Locales not known are
+// written as in English.
+func Format(amount int, code, locale string) string {
+	c, ok := Lookup(code)
+	if !ok {
+		c = Currency{Code: code, Symbol: code, Decimals: 2}
+	}
+
+	lang := strings.ToLower(strings.SplitN(strings.Replace(locale, "_", "-", 1), "-", 2)[0])
+	st, ok := styles[lang]
+	if !ok {
+		st = styles["en"]
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	unit := int(math.Pow10(c.Decimals))
+	whole := strconv.Itoa(amount / unit)
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + st.group + whole[i:]
+	}
+
+	number := whole
+	if c.Decimals > 0 {
+		number += st.decimal + fmt.Sprintf("%0*d", c.Decimals, amount%unit)
+	}
+
+	if st.after {
+		return sign + number + "\u00a0" + c.Symbol
+	}
+
+	// a symbol that is letters, such as CHF, is kept apart from the number
+	last := c.Symbol[len(c.Symbol)-1]
+	if last >= 'A' && last <= 'Z' {
+		return sign + c.Symbol + "\u00a0" + number
+	}
+	return sign + c.Symbol + number
+}
+
+// Percent returns a whole-number percentage of an amount in cents, rounded to the nearest cent
+func Percent(cents, percent int) int {
+	return (cents*percent + 50) / 100
+}
+
+// Table holds the exchange rates from the base currency. It is safe to use from many
+// requests while staff update the rates.
+type Table struct {
+	mu    sync.RWMutex
+	base  string
+	rates map[string]float64
+}
+
+// NewTable returns a table converting from the base currency, with no other rates yet
+func NewTable(base string) *Table {
+	return &Table{
+		base:  strings.ToUpper(base),
+		rates: make(map[string]float64),
+	}
+}
+
+// Base returns the code of the currency prices are set and charged in
+func (t *Table) Base() string {
+	return t.base
+}
+
+// Load replaces the exchange rates with those given
+func (t *Table) Load(rates []models.ExchangeRate) {
+	m := make(map[string]float64)
+	for _, r := range rates {
+		if r.Rate > 0 && r.Currency != t.base {
+			m[r.Currency] = r.Rate
+		}
+	}
+
+	t.mu.Lock()
+	t.rates = m
+	t.mu.Unlock()
+}
+
+// Has reports whether prices can be shown in a currency
+func (t *Table) Has(code string) bool {
+	_, ok := t.rate(code)
+	return ok
+}
+
+// Codes returns the currencies prices can be shown in, the base currency first
+func (t *Table) Codes() []string {
+	t.mu.RLock()
+	var codes []string
+	for code := range t.rates {
+		codes = append(codes, code)
+	}
+	t.mu.RUnlock()
+
+	sort.Strings(codes)
+	return append([]string{t.base}, codes...)
+}
+
+// Convert returns an amount in cents of the base currency in the smallest unit of another
+// currency, rounded. Currencies without a rate are left in the base currency, so the code
+// of the currency the amount ends up in is returned with it.
+func (t *Table) Convert(cents int, code string) (int, string) {
+	rate, ok := t.rate(code)
+	c, known := Lookup(code)
+	if !ok || !known || c.Code == t.base {
+		return cents, t.base
+	}
+
+	amount := float64(cents) / 100 * rate * math.Pow10(c.Decimals)
+	return int(math.Round(amount)), c.Code
+}
+
+// Format converts an amount in cents of the base currency and writes it for a locale
+func (t *Table) Format(cents int, code, locale string) string {
+	amount, code := t.Convert(cents, strings.ToUpper(code))
+	return Format(amount, code, locale)
+}
+
+// rate returns the rate from the base currency to another, which is 1 for the base itself
+func (t *Table) rate(code string) (float64, bool) {
+	code = strings.ToUpper(code)
+	if code == t.base {
+		return 1, true
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	rate, ok := t.rates[code]
+	return rate, ok
+}
+
+// ParseRates reads exchange rates from a CSV file with the currency code and how much of it
+// one unit of the base currency buys on each line, such as "EUR,0.61". A header line and
+// blank lines are skipped.
+func ParseRates(r io.Reader, base string) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rates []models.ExchangeRate
+	line := 0
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line++
+
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected a currency and a rate", line)
+		}
+
+		code := strings.ToUpper(strings.TrimSpace(record[0]))
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %q is not a rate", line, record[1])
+		}
+
+		if _, ok := Lookup(code); !ok {
+			return nil, fmt.Errorf("line %d: %q is not a currency we can show", line, record[0])
+		}
+		if code == strings.ToUpper(base) {
+			return nil, fmt.Errorf("line %d: %s is the base currency", line, code)
+		}
+		if rate <= 0 {
+			return nil, fmt.Errorf("line %d: the rate must be more than 0", line)
+		}
+
+		rates = append(rates, models.ExchangeRate{Currency: code, Rate: rate})
+	}
+
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no rates found")
+	}
+
+	return rates, nil
+}
@@ -0,0 +1,124 @@
+package currency
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func TestFormat(t *testing.T) {
+	var tests = []struct {
+		amount   int
+		code     string
+		locale   string
+		expected string
+	}{
+		{123450, "AUD", "en-AU", "A$1,234.50"},
+		{5, "USD", "en", "US$0.05"},
+		{-2500, "GBP", "en", "-£25.00"},
+		{123450, "EUR", "de", "1.234,50\u00a0€"},
+		{123450, "EUR", "fr_FR", "1\u202f234,50\u00a0€"},
+		{1234567, "JPY", "ja", "¥1,234,567"},
+		{1000, "CHF", "en", "CHF\u00a010.00"},
+		{1000, "EUR", "xx", "€10.00"},
+		{1000, "XYZ", "en", "XYZ\u00a010.00"},
+	}
+
+	for _, e := range tests {
+		if got := Format(e.amount, e.code, e.locale); got != e.expected {
+			t.Errorf("%d %s %s: expected %q but got %q", e.amount, e.code, e.locale, e.expected, got)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	table := NewTable("aud")
+	table.Load([]models.ExchangeRate{
+		{Currency: "EUR", Rate: 0.61},
+		{Currency: "JPY", Rate: 97.5},
+		{Currency: "AUD", Rate: 2},
+	})
+
+	codes := table.Codes()
+	if strings.Join(codes, ",") != "AUD,EUR,JPY" {
+		t.Errorf("expected AUD,EUR,JPY but got %v", codes)
+	}
+
+	if !table.Has("eur") || table.Has("USD") {
+		t.Error("expected rates for EUR only")
+	}
+
+	var tests = []struct {
+		code     string
+		amount   int
+		currency string
+	}{
+		{"AUD", 10050, "AUD"},
+		{"EUR", 6131, "EUR"},
+		{"JPY", 9799, "JPY"},
+		{"USD", 10050, "AUD"},
+	}
+
+	for _, e := range tests {
+		amount, code := table.Convert(10050, e.code)
+		if amount != e.amount || code != e.currency {
+			t.Errorf("%s: expected %d %s but got %d %s", e.code, e.amount, e.currency, amount, code)
+		}
+	}
+
+	if got := table.Format(10050, "eur", "de"); got != "61,31\u00a0€" {
+		t.Errorf("expected 61,31 € but got %q", got)
+	}
+
+	table.Load(nil)
+	if table.Has("EUR") {
+		t.Error("expected the rates to be replaced")
+	}
+}
+
+func TestParseRates(t *testing.T) {
+	rates, err := ParseRates(strings.NewReader("currency,rate\neur, 0.61\n\nUSD,0.66\n"), "AUD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rates) != 2 || rates[0].Currency != "EUR" || rates[0].Rate != 0.61 || rates[1].Currency != "USD" {
+		t.Errorf("unexpected rates %v", rates)
+	}
+
+	var bad = []string{
+		"",
+		"EUR",
+		"EUR,0.61\nUSD,lots",
+		"XYZ,1.5",
+		"AUD,1",
+		"EUR,0",
+	}
+
+	for _, s := range bad {
+		_, err := ParseRates(strings.NewReader(s), "AUD")
+		if err == nil {
+			t.Errorf("expected %q to fail", s)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	var tests = []struct {
+		cents    int
+		percent  int
+		expected int
+	}{
+		{10000, 10, 1000},
+		{999, 15, 150},
+		{333, 10, 33},
+		{0, 50, 0},
+	}
+
+	for _, e := range tests {
+		if got := Percent(e.cents, e.percent); got != e.expected {
+			t.Errorf("%d%% of %d: expected %d but got %d", e.percent, e.cents, e.expected, got)
+		}
+	}
+}
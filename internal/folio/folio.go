@@ -0,0 +1,188 @@
+package folio
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+	"github.com/tsawler/bookings-app/internal/taxes"
+)
+
+// Line kinds
+const (
+	Charge  = "charge"
+	Tax     = "tax"
+	Payment = "payment"
+	Refund  = "refund"
+)
+
+// Line is an entry on a folio. Amount is in cents and adds to what the guest owes, so
+// payments are negative; Balance is what is owed after the line.
+type Line struct {
+	Date        time.Time
+	Kind        string
+	Description string
+	Amount      int
+	Balance     int
+}
+
+// Folio is the account of a reservation: the room, the extras posted to it and what the
+// guest has paid. Paid is net of refunds. Included is the tax already part of the room
+// price, which isn't a line of its own.
+type Folio struct {
+	Lines    []Line
+	Charges  int
+	Taxes    int
+	Included int
+	Paid     int
+	Balance  int
+}
+
+// Build puts together the folio of a reservation from the items posted to it and the
+// payments taken through the payment provider. A cancelled reservation only charges the
+// cancellation penalty for the room.
+func Build(res models.Reservation, items []models.FolioItem, paid []models.Payment) Folio {
+	var lines []Line
+
+	nights := res.Nights()
+	lines = append(lines, Line{
+		Date:        res.CreatedAt,
+		Kind:        Charge,
+		Description: fmt.Sprintf("%s, %d %s", res.Room.RoomName, nights, plural(nights, "night")),
+		Amount:      res.Subtotal,
+	})
+
+	if res.Discount > 0 {
+		lines = append(lines, Line{
+			Date:        res.CreatedAt,
+			Kind:        Charge,
+			Description: "Promo code " + res.PromoCode,
+			Amount:      -res.Discount,
+		})
+	}
+
+	var f Folio
+
+	for _, t := range res.TaxLines {
+		if t.Inclusive {
+			f.Included += t.Amount
+			continue
+		}
+
+		kind := Tax
+		if t.Kind == taxes.Fee {
+			kind = Charge
+		}
+
+		lines = append(lines, Line{
+			Date:        res.CreatedAt,
+			Kind:        kind,
+			Description: t.Name,
+			Amount:      t.Amount,
+		})
+	}
+
+	if !res.CancelledAt.IsZero() {
+		lines = append(lines, Line{
+			Date:        res.CancelledAt,
+			Kind:        Charge,
+			Description: "Cancelled, less the cancellation penalty",
+			Amount:      res.CancellationPenalty - res.Total(),
+		})
+	}
+
+	for _, item := range items {
+		amount := item.Amount
+		if item.Kind == Payment {
+			amount = -amount
+		}
+
+		lines = append(lines, Line{
+			Date:        item.CreatedAt,
+			Kind:        item.Kind,
+			Description: item.Description,
+			Amount:      amount,
+		})
+	}
+
+	for _, p := range paid {
+		if p.Status != payments.Captured && p.Status != payments.Refunded {
+			continue
+		}
+
+		lines = append(lines, Line{
+			Date:        p.CreatedAt,
+			Kind:        Payment,
+			Description: "Card payment " + p.Reference,
+			Amount:      -p.Amount,
+		})
+
+		if p.Refunded > 0 {
+			lines = append(lines, Line{
+				Date:        p.UpdatedAt,
+				Kind:        Refund,
+				Description: "Card refund " + p.Reference,
+				Amount:      p.Refunded,
+			})
+		}
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Date.Before(lines[j].Date)
+	})
+
+	for _, line := range lines {
+		switch line.Kind {
+		case Charge:
+			f.Charges += line.Amount
+		case Tax:
+			f.Taxes += line.Amount
+		default:
+			f.Paid -= line.Amount
+		}
+
+		f.Balance += line.Amount
+		line.Balance = f.Balance
+		f.Lines = append(f.Lines, line)
+	}
+
+	return f
+}
+
+// Nightly breaks the room charge of a reservation down by night. The price was fixed when
+// booking, so it is spread evenly over the nights, with any odd cents on the last night.
+func Nightly(res models.Reservation) []Line {
+	nights := res.Nights()
+	if nights < 1 {
+		return nil
+	}
+
+	rate := res.Subtotal / nights
+
+	var lines []Line
+	for i := 0; i < nights; i++ {
+		amount := rate
+		if i == nights-1 {
+			amount = res.Subtotal - rate*(nights-1)
+		}
+
+		lines = append(lines, Line{
+			Date:        res.StartDate.AddDate(0, 0, i),
+			Kind:        Charge,
+			Description: res.Room.RoomName,
+			Amount:      amount,
+			Balance:     rate*i + amount,
+		})
+	}
+
+	return lines
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
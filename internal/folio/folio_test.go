@@ -0,0 +1,134 @@
+package folio
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func at(day, hour int) time.Time {
+	return time.Date(2050, 1, day, hour, 0, 0, 0, time.UTC)
+}
+
+// stay is 2 nights at $100 with $20 off, booked on the 1st
+var stay = models.Reservation{
+	StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+	Subtotal:  20000,
+	Discount:  2000,
+	PromoCode: "SAVE10",
+	Room:      models.Room{RoomName: "General's Quarters"},
+	CreatedAt: at(1, 9),
+}
+
+var items = []models.FolioItem{
+	{Kind: Charge, Description: "Breakfast", Amount: 2500, CreatedAt: at(11, 8)},
+	{Kind: Tax, Description: "Tax on Breakfast", Amount: 250, CreatedAt: at(11, 8)},
+	{Kind: Payment, Description: "Cash", Amount: 10000, CreatedAt: at(12, 10)},
+}
+
+var paid = []models.Payment{
+	{Reference: "fake_1", Status: "captured", Amount: 9000, Refunded: 1000, CreatedAt: at(1, 9), UpdatedAt: at(12, 11)},
+	{Reference: "fake_2", Status: "voided", Amount: 9000, CreatedAt: at(1, 10)},
+}
+
+func TestBuild(t *testing.T) {
+	f := Build(stay, items, paid)
+
+	expected := []struct {
+		kind    string
+		amount  int
+		balance int
+	}{
+		{Charge, 20000, 20000},
+		{Charge, -2000, 18000},
+		{Payment, -9000, 9000},
+		{Charge, 2500, 11500},
+		{Tax, 250, 11750},
+		{Payment, -10000, 1750},
+		{Refund, 1000, 2750},
+	}
+
+	if len(f.Lines) != len(expected) {
+		t.Fatalf("expected %d lines but got %d", len(expected), len(f.Lines))
+	}
+
+	for i, e := range expected {
+		line := f.Lines[i]
+		if line.Kind != e.kind || line.Amount != e.amount || line.Balance != e.balance {
+			t.Errorf("line %d: expected %s %d leaving %d but got %s %d leaving %d",
+				i, e.kind, e.amount, e.balance, line.Kind, line.Amount, line.Balance)
+		}
+	}
+
+	if f.Charges != 20500 || f.Taxes != 250 || f.Paid != 18000 || f.Balance != 2750 {
+		t.Errorf("expected charges 20500, taxes 250, paid 18000 and balance 2750 but got %d, %d, %d and %d",
+			f.Charges, f.Taxes, f.Paid, f.Balance)
+	}
+
+	if f.Lines[0].Description != "General's Quarters, 2 nights" {
+		t.Errorf("unexpected room line %q", f.Lines[0].Description)
+	}
+}
+
+func TestBuild_Taxes(t *testing.T) {
+	res := stay
+	res.TaxLines = []models.ReservationTax{
+		{Name: "GST", Kind: "tax", Inclusive: true, Amount: 1636},
+		{Name: "Cleaning", Kind: "fee", Amount: 4000},
+		{Name: "City tax", Kind: "tax", Amount: 600},
+	}
+	res.Taxes = 4600
+
+	f := Build(res, nil, nil)
+
+	if len(f.Lines) != 4 {
+		t.Fatalf("expected the room, promo, fee and tax lines but got %d lines", len(f.Lines))
+	}
+
+	if f.Lines[2].Kind != Charge || f.Lines[2].Description != "Cleaning" || f.Lines[3].Kind != Tax {
+		t.Errorf("expected the fee as a charge and the tax as a tax but got %v", f.Lines[2:])
+	}
+
+	if f.Charges != 22000 || f.Taxes != 600 || f.Included != 1636 || f.Balance != res.Total() {
+		t.Errorf("expected charges 22000, taxes 600, included 1636 and balance %d but got %d, %d, %d and %d",
+			res.Total(), f.Charges, f.Taxes, f.Included, f.Balance)
+	}
+}
+
+func TestNightly(t *testing.T) {
+	res := stay
+	res.EndDate = res.StartDate.AddDate(0, 0, 3)
+	res.Subtotal = 10000
+
+	lines := Nightly(res)
+
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 nights but got %d", len(lines))
+	}
+
+	for i, amount := range []int{3333, 3333, 3334} {
+		if lines[i].Amount != amount || !lines[i].Date.Equal(res.StartDate.AddDate(0, 0, i)) {
+			t.Errorf("night %d: expected %d on %s but got %d on %s", i, amount,
+				res.StartDate.AddDate(0, 0, i).Format("2006-01-02"), lines[i].Amount, lines[i].Date.Format("2006-01-02"))
+		}
+	}
+
+	if lines[2].Balance != 10000 {
+		t.Errorf("expected the nights to add up to 10000 but got %d", lines[2].Balance)
+	}
+}
+
+func TestBuild_Cancelled(t *testing.T) {
+	res := stay
+	res.CancelledAt = at(5, 12)
+	res.CancellationPenalty = 9000
+
+	f := Build(res, nil, paid[:1])
+
+	// the penalty is covered by the deposit, less what was refunded
+	if f.Charges != 9000 || f.Balance != 1000 {
+		t.Errorf("expected charges of 9000 and a balance of 1000 but got %d and %d", f.Charges, f.Balance)
+	}
+}
@@ -1,16 +1,18 @@
 package forms
 
 import (
-	"fmt"
 	"github.com/asaskevich/govalidator"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"net/url"
 	"strings"
 )
 
 // Form creates a custom form struct and embeds a url.Values object
+// Locale: the language of the validation messages, English when empty
 type Form struct {
 	url.Values
 	Errors errors
+	Locale string
 }
 
 // Valid returns true if there are no errors, otherwise false
@@ -21,17 +23,29 @@ func (f *Form) Valid() bool {
 // New initializes a form struct
 func New(data url.Values) *Form {
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]string{}),
 	}
 }
 
+// NewLocalized initializes a form whose validation messages are in a locale, such as de
+func NewLocalized(data url.Values, locale string) *Form {
+	f := New(data)
+	f.Locale = locale
+	return f
+}
+
+// T translates a message into the language of the form, formatting it with any arguments
+func (f *Form) T(message string, args ...interface{}) string {
+	return i18n.T(f.Locale, message, args...)
+}
+
 // Required checks for required fields
 func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field cannot be blank")
+			f.Errors.Add(field, f.T("This field cannot be blank"))
 		}
 	}
 }
@@ -49,7 +63,7 @@ func (f *Form) Has(field string) bool {
 func (f *Form) MinLength(field string, length int) bool {
 	x := f.Get(field)
 	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+		f.Errors.Add(field, f.T("This field must be at least %d characters long", length))
 		return false
 	}
 	return true
@@ -58,6 +72,13 @@ func (f *Form) MinLength(field string, length int) bool {
 // IsEmail checks for a valid email address
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "Invalid email address")
+		f.Errors.Add(field, f.T("Invalid email address"))
+	}
+}
+
+// IsURL checks for a valid http or https url
+func (f *Form) IsURL(field string) {
+	if !govalidator.IsRequestURL(f.Get(field)) {
+		f.Errors.Add(field, f.T("Invalid URL"))
 	}
 }
@@ -5,6 +5,8 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+
+	"github.com/tsawler/bookings-app/internal/i18n"
 )
 
 func TestForm_Valid(t *testing.T) {
@@ -128,3 +130,45 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_IsURL(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("url", "https://example.com/calendar.ics")
+	form := New(postedValues)
+
+	form.IsURL("url")
+	if !form.Valid() {
+		t.Error("got an invalid url when we should not have")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("url", "not a url")
+	form = New(postedValues)
+
+	form.IsURL("url")
+	if form.Valid() {
+		t.Error("got valid for invalid url")
+	}
+}
+
+func TestForm_NewLocalized(t *testing.T) {
+	err := i18n.Load("./../../locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form := NewLocalized(url.Values{}, "de")
+	form.Required("a")
+	form.MinLength("a", 3)
+
+	if got := form.Errors.Get("a"); got != "Dieses Feld darf nicht leer sein" {
+		t.Errorf("expected the German message but got %q", got)
+	}
+
+	form = New(url.Values{})
+	form.Required("a")
+
+	if got := form.Errors.Get("a"); got != "This field cannot be blank" {
+		t.Errorf("expected the English message but got %q", got)
+	}
+}
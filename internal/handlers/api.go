@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+	"github.com/tsawler/bookings-app/internal/render"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+const apiDateLayout = "2006-01-02"
+
+// maxAPIBodySize limits the size of JSON request bodies
+const maxAPIBodySize = 1 << 20
+
+// apiEnvelope wraps every successful API response
+type apiEnvelope struct {
+	Data interface{} `json:"data"`
+}
+
+// apiErrorEnvelope wraps every failed API response
+type apiErrorEnvelope struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields,omitempty"`
+}
+
+type apiRoom struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	MaxOccupancy int    `json:"max_occupancy"`
+}
+
+type apiAvailability struct {
+	StartDate  string              `json:"start_date"`
+	EndDate    string              `json:"end_date"`
+	Available  bool                `json:"available"`
+	Rooms      []apiRoom           `json:"rooms"`
+	Restricted []apiRestrictedRoom `json:"restricted,omitempty"`
+}
+
+// apiRestrictedRoom is a free room the stay rules don't allow for the dates
+type apiRestrictedRoom struct {
+	Room    apiRoom  `json:"room"`
+	Reasons []string `json:"reasons"`
+}
+
+type apiReservation struct {
+	ID        int        `json:"id"`
+	Room      apiRoom    `json:"room"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Email     string     `json:"email"`
+	Phone     string     `json:"phone"`
+	StartDate string     `json:"start_date"`
+	EndDate   string     `json:"end_date"`
+	Adults    int        `json:"adults"`
+	Children  int        `json:"children"`
+	Processed bool       `json:"processed"`
+	Cancelled bool       `json:"cancelled"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// apiReservationRequest is the body accepted when creating a reservation
+type apiReservationRequest struct {
+	RoomID       int    `json:"room_id"`
+	StartDate    string `json:"start_date"`
+	EndDate      string `json:"end_date"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`
+	Adults       int    `json:"adults"`
+	Children     int    `json:"children"`
+	PaymentToken string `json:"payment_token,omitempty"`
+}
+
+func toAPIRoom(r models.Room) apiRoom {
+	return apiRoom{
+		ID:           r.ID,
+		Name:         r.RoomName,
+		MaxOccupancy: r.MaxOccupancy,
+	}
+}
+
+func toAPIReservation(r models.Reservation) apiReservation {
+	res := apiReservation{
+		ID:        r.ID,
+		Room:      apiRoom{ID: r.RoomID, Name: r.Room.RoomName, MaxOccupancy: r.Room.MaxOccupancy},
+		FirstName: r.FirstName,
+		LastName:  r.LastName,
+		Email:     r.Email,
+		Phone:     r.Phone,
+		StartDate: r.StartDate.Format(apiDateLayout),
+		EndDate:   r.EndDate.Format(apiDateLayout),
+		Adults:    r.Adults,
+		Children:  r.Children,
+		Processed: r.Processed == 1,
+		Cancelled: !r.CancelledAt.IsZero(),
+	}
+
+	if !r.CreatedAt.IsZero() {
+		createdAt := r.CreatedAt
+		res.CreatedAt = &createdAt
+	}
+
+	return res
+}
+
+// writeJSON writes v wrapped in the success envelope
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, _ := json.MarshalIndent(apiEnvelope{Data: v}, "", "     ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// writeAPIError writes an error envelope with the given status code
+func writeAPIError(w http.ResponseWriter, status int, code, message string, fields map[string][]string) {
+	resp := apiErrorEnvelope{
+		Error: apiErrorBody{
+			Code:    code,
+			Message: message,
+			Fields:  fields,
+		},
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "     ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// parseDateRange validates a start and end date in the form, adding errors for the given fields
+func parseDateRange(form *forms.Form, startField, endField string) (time.Time, time.Time) {
+	startDate, err := time.Parse(apiDateLayout, form.Get(startField))
+	if err != nil {
+		form.Errors.Add(startField, form.T("Must be a date in YYYY-MM-DD format"))
+	}
+
+	endDate, err2 := time.Parse(apiDateLayout, form.Get(endField))
+	if err2 != nil {
+		form.Errors.Add(endField, form.T("Must be a date in YYYY-MM-DD format"))
+	}
+
+	if err == nil && err2 == nil && !endDate.After(startDate) {
+		form.Errors.Add(endField, form.T("Must be after the start date"))
+	}
+
+	return startDate, endDate
+}
+
+// parseStayDates validates the dates of a stay like parseDateRange, also refusing arrivals
+// before today at the property
+func (m *Repository) parseStayDates(form *forms.Form, startField, endField string) (time.Time, time.Time) {
+	startDate, endDate := parseDateRange(form, startField, endField)
+
+	if form.Errors.Get(startField) == "" && form.Errors.Get(endField) == "" && startDate.Before(m.today()) {
+		form.Errors.Add(startField, form.T("Must not be in the past"))
+	}
+
+	return startDate, endDate
+}
+
+// APINotFound returns the error envelope for unknown API routes
+func (m *Repository) APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "not_found", "The requested resource does not exist", nil)
+}
+
+// APIMethodNotAllowed returns the error envelope for unsupported methods on API routes
+func (m *Repository) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed", nil)
+}
+
+// APIUnauthorized returns the error envelope for requests that need authentication
+func (m *Repository) APIUnauthorized(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Authentication required", nil)
+}
+
+// APIForbidden returns the error envelope for tokens without the required scope
+func (m *Repository) APIForbidden(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusForbidden, "forbidden", "The token does not have the required scope", nil)
+}
+
+// APIRateLimited returns the error envelope for tokens over their request limit
+func (m *Repository) APIRateLimited(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusTooManyRequests, "rate_limited", "Too many requests", nil)
+}
+
+// APIListRooms returns all rooms
+func (m *Repository) APIListRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	out := []apiRoom{}
+	for _, x := range rooms {
+		out = append(out, toAPIRoom(x))
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// APIGetRoom returns one room by id
+func (m *Repository) APIGetRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Room not found", nil)
+		return
+	}
+
+	room, err := m.DB.GetRoomById(id)
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Room not found", nil)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIRoom(room))
+}
+
+// APIAvailability returns the rooms available between two dates, optionally for a single room
+func (m *Repository) APIAvailability(w http.ResponseWriter, r *http.Request) {
+	form := forms.New(r.URL.Query())
+	form.Required("start", "end")
+
+	startDate, endDate := m.parseStayDates(form, "start", "end")
+	adults, children := parseGuests(form)
+
+	roomId := 0
+	if form.Has("room_id") {
+		id, err := strconv.Atoi(form.Get("room_id"))
+		if err != nil || id < 1 {
+			form.Errors.Add("room_id", "Must be a room id")
+		}
+		roomId = id
+	}
+
+	if !form.Valid() {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "The request is invalid", map[string][]string(form.Errors))
+		return
+	}
+
+	resp := apiAvailability{
+		StartDate: startDate.Format(apiDateLayout),
+		EndDate:   endDate.Format(apiDateLayout),
+		Rooms:     []apiRoom{},
+	}
+
+	var rooms []models.Room
+	var err error
+
+	if roomId > 0 {
+		room, err := m.DB.GetRoomById(roomId)
+		if err != nil {
+			writeAPIError(w, http.StatusNotFound, "not_found", "Room not found", nil)
+			return
+		}
+
+		available, err := m.DB.SearchAvailabilityByDatesByRoomId(startDate, endDate, roomId)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+			return
+		}
+
+		if available && (room.MaxOccupancy == 0 || adults+children <= room.MaxOccupancy) {
+			rooms = append(rooms, room)
+		}
+	} else {
+		rooms, err = m.DB.SearchAvailabilityForAllRooms(startDate, endDate, adults+children)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+			return
+		}
+	}
+
+	rooms, restricted, err := m.applyStayRules(rooms, startDate, endDate)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	for _, x := range rooms {
+		resp.Rooms = append(resp.Rooms, toAPIRoom(x))
+	}
+	for _, x := range restricted {
+		resp.Restricted = append(resp.Restricted, apiRestrictedRoom{Room: toAPIRoom(x.Room), Reasons: messagesIn(x.Reasons, i18n.Default)})
+	}
+
+	resp.Available = len(resp.Rooms) > 0
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// APICreateReservation books a room for a guest
+func (m *Repository) APICreateReservation(w http.ResponseWriter, r *http.Request) {
+	var req apiReservationRequest
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodySize)
+	body, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", "The request body must be a JSON object", nil)
+		return
+	}
+
+	// a retried request returns the reservation created the first time
+	idempotencyKey := ""
+	if header := r.Header.Get("Idempotency-Key"); header != "" {
+		if len(header) > maxIdempotencyKeyLength {
+			writeAPIError(w, http.StatusBadRequest, "invalid_idempotency_key", "The Idempotency-Key header is too long", nil)
+			return
+		}
+
+		idempotencyKey = apiIdempotencyKey(r, header)
+		requestHash := helpers.HashToken(string(body))
+
+		key, claimed, err := m.DB.ClaimIdempotencyKey(idempotencyKey, requestHash)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+			return
+		}
+
+		if !claimed {
+			m.replayAPIReservation(w, key, requestHash)
+			return
+		}
+
+		// frees the key unless a reservation was stored for it
+		defer m.releaseIdempotencyKey(idempotencyKey)
+	}
+
+	// reuse the form validators used by the reservation page
+	values := url.Values{}
+	values.Set("room_id", strconv.Itoa(req.RoomID))
+	values.Set("start_date", req.StartDate)
+	values.Set("end_date", req.EndDate)
+	values.Set("first_name", req.FirstName)
+	values.Set("last_name", req.LastName)
+	values.Set("email", req.Email)
+	values.Set("phone", req.Phone)
+	if req.Adults != 0 {
+		values.Set("adults", strconv.Itoa(req.Adults))
+	}
+	values.Set("children", strconv.Itoa(req.Children))
+
+	form := forms.New(values)
+	form.Required("start_date", "end_date", "first_name", "last_name", "email")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+
+	startDate, endDate := m.parseStayDates(form, "start_date", "end_date")
+	adults, children := parseGuests(form)
+
+	if req.RoomID < 1 {
+		form.Errors.Add("room_id", "Must be a room id")
+	}
+
+	if !form.Valid() {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "The request is invalid", map[string][]string(form.Errors))
+		return
+	}
+
+	room, err := m.DB.GetRoomById(req.RoomID)
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "The request is invalid", map[string][]string{
+			"room_id": {"Room does not exist"},
+		})
+		return
+	}
+
+	checkOccupancy(form, room, adults, children)
+	if !form.Valid() {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "The request is invalid", map[string][]string(form.Errors))
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomId(startDate, endDate, req.RoomID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	if !available {
+		writeAPIError(w, http.StatusConflict, "unavailable", "The room is not available for the requested dates", nil)
+		return
+	}
+
+	reasons, err := m.stayRuleReasons(req.RoomID, startDate, endDate)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	if len(reasons) > 0 {
+		writeAPIError(w, http.StatusConflict, "restricted", stayRulesMessage(room.RoomName, reasons, i18n.Default), nil)
+		return
+	}
+
+	reservation := models.Reservation{
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+		Email:        req.Email,
+		Phone:        req.Phone,
+		StartDate:    startDate,
+		EndDate:      endDate,
+		RoomID:       req.RoomID,
+		Adults:       adults,
+		Children:     children,
+		Room:         room,
+		Locale:       i18n.FromContext(r.Context()),
+		CheckInTime:  m.App.CheckInTime.String(),
+		CheckOutTime: m.App.CheckOutTime.String(),
+	}
+	reservation.Subtotal = reservation.Nights() * room.NightlyRate
+	reservation.CancellationPolicyID = room.CancellationPolicyID
+
+	err = m.applyTaxes(&reservation)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	// like the reservation form, the reservation is only made once the deposit is authorized
+	deposit := m.App.Deposit.For(reservation)
+	depositRef := ""
+	if deposit > 0 {
+		if req.PaymentToken == "" {
+			writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "The request is invalid", map[string][]string{
+				"payment_token": {fmt.Sprintf("A card is needed for the deposit of %s", render.Money(deposit, i18n.Default))},
+			})
+			return
+		}
+
+		depositRef, err = m.App.Payments.Authorize(req.PaymentToken, deposit,
+			fmt.Sprintf("Deposit for %s from %s", room.RoomName, req.StartDate))
+		if errors.Is(err, payments.ErrDeclined) {
+			writeAPIError(w, http.StatusPaymentRequired, "payment_declined", "The card was declined", nil)
+			return
+		}
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			writeAPIError(w, http.StatusBadGateway, "payment_failed", "The deposit could not be taken", nil)
+			return
+		}
+	}
+
+	reservation.ID, err = m.DB.InsertReservation(reservation, 0)
+	if err != nil {
+		if depositRef != "" {
+			m.voidDeposits([]string{depositRef})
+		}
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			writeAPIError(w, http.StatusConflict, "unavailable", "The room is not available for the requested dates", nil)
+			return
+		}
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	if depositRef != "" {
+		m.captureDeposit(reservation.ID, depositRef, deposit)
+	}
+
+	if idempotencyKey != "" {
+		m.completeIdempotencyKey(idempotencyKey, reservation.ID)
+	}
+
+	m.sendConfirmation(reservation)
+	m.notifyStaff(reservation)
+	m.fireEvent("reservation.created", toAPIReservation(reservation))
+
+	w.Header().Set("Location", "/api/v1/reservations/"+strconv.Itoa(reservation.ID))
+	writeJSON(w, http.StatusCreated, toAPIReservation(reservation))
+}
+
+// APIGetReservation returns one reservation by id
+func (m *Repository) APIGetReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, toAPIReservation(res))
+}
+
+// APICancelReservation cancels a reservation and frees its dates
+func (m *Repository) APICancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.apiReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	if !res.CancelledAt.IsZero() {
+		writeAPIError(w, http.StatusConflict, "already_cancelled", "The reservation is already cancelled", nil)
+		return
+	}
+
+	penalty, refund, err := m.cancellationCharges(res)
+	if err == nil {
+		err = m.DB.CancelReservation(res.ID, penalty, refund)
+	}
+	if errors.Is(err, repository.ErrAlreadyCancelled) {
+		writeAPIError(w, http.StatusConflict, "already_cancelled", "The reservation is already cancelled", nil)
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	m.settleCancellation(res.ID, refund)
+
+	res.CancelledAt = time.Now()
+	m.fireEvent("reservation.cancelled", toAPIReservation(res))
+	m.offerWaitlistForReservation(res)
+
+	writeJSON(w, http.StatusOK, toAPIReservation(res))
+}
+
+// apiReservationFromURL loads the reservation named by the id url parameter,
+// writing the error response when it cannot
+func (m *Repository) apiReservationFromURL(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Reservation not found", nil)
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Reservation not found", nil)
+		return res, false
+	} else if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return res, false
+	}
+
+	return res, true
+}
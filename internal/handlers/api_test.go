@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var apiTests = []struct {
+	name               string
+	method             string
+	url                string
+	body               string
+	expectedStatusCode int
+	expectedErrorCode  string
+}{
+	{"rooms", "GET", "/api/v1/rooms", "", http.StatusOK, ""},
+	{"room", "GET", "/api/v1/rooms/1", "", http.StatusOK, ""},
+	{"unknown room", "GET", "/api/v1/rooms/100", "", http.StatusNotFound, "not_found"},
+	{"availability", "GET", "/api/v1/availability?start=2050-01-01&end=2050-01-02", "", http.StatusOK, ""},
+	{"availability for room", "GET", "/api/v1/availability?start=2050-01-01&end=2050-01-02&room_id=1", "", http.StatusOK, ""},
+	{"availability bad dates", "GET", "/api/v1/availability?start=2050-01-02&end=2050-01-01", "", http.StatusUnprocessableEntity, "validation_failed"},
+	{"availability missing dates", "GET", "/api/v1/availability", "", http.StatusUnprocessableEntity, "validation_failed"},
+	{"availability for party", "GET", "/api/v1/availability?start=2050-01-01&end=2050-01-02&room_id=1&adults=2&children=1", "", http.StatusOK, ""},
+	{"availability with stay rules", "GET", "/api/v1/availability?start=2060-01-10&end=2060-01-11", "", http.StatusOK, ""},
+	{"availability for restricted room", "GET", "/api/v1/availability?start=2060-01-10&end=2060-01-11&room_id=1", "", http.StatusOK, ""},
+	{"availability in the past", "GET", "/api/v1/availability?start=2000-01-01&end=2000-01-02", "", http.StatusUnprocessableEntity, "validation_failed"},
+	{"availability no adults", "GET", "/api/v1/availability?start=2050-01-01&end=2050-01-02&adults=0", "", http.StatusUnprocessableEntity, "validation_failed"},
+	{"create reservation", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com","payment_token":"tok_visa"}`,
+		http.StatusCreated, ""},
+	{"create reservation without a card", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com"}`,
+		http.StatusUnprocessableEntity, "validation_failed"},
+	{"create reservation card declined", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com","payment_token":"tok_declined"}`,
+		http.StatusPaymentRequired, "payment_declined"},
+	{"create reservation unavailable", "POST", "/api/v1/reservations",
+		`{"room_id":2,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com"}`,
+		http.StatusConflict, "unavailable"},
+	{"create reservation taken while booking", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"slow@guest.com","payment_token":"tok_visa"}`,
+		http.StatusConflict, "unavailable"},
+	{"create reservation unknown room", "POST", "/api/v1/reservations",
+		`{"room_id":100,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com"}`,
+		http.StatusUnprocessableEntity, "validation_failed"},
+	{"create reservation invalid", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"Jo","email":"x"}`,
+		http.StatusUnprocessableEntity, "validation_failed"},
+	{"create reservation restricted", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2060-01-10","end_date":"2060-01-11","first_name":"John","last_name":"Smith","email":"john@smith.com"}`,
+		http.StatusConflict, "restricted"},
+	{"create reservation over capacity", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com","adults":2,"children":1}`,
+		http.StatusUnprocessableEntity, "validation_failed"},
+	{"create reservation in the past", "POST", "/api/v1/reservations",
+		`{"room_id":1,"start_date":"2000-01-01","end_date":"2000-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com"}`,
+		http.StatusUnprocessableEntity, "validation_failed"},
+	{"create reservation bad json", "POST", "/api/v1/reservations", `{`, http.StatusBadRequest, "invalid_json"},
+	{"reservation", "GET", "/api/v1/reservations/1", "", http.StatusOK, ""},
+	{"unknown reservation", "GET", "/api/v1/reservations/100", "", http.StatusNotFound, "not_found"},
+	{"cancel reservation", "POST", "/api/v1/reservations/1/cancel", "", http.StatusOK, ""},
+	{"cancel reservation cancelled meanwhile", "POST", "/api/v1/reservations/2/cancel", "", http.StatusConflict, "already_cancelled"},
+	{"unknown route", "GET", "/api/v1/nothing", "", http.StatusNotFound, "not_found"},
+	{"wrong method", "DELETE", "/api/v1/rooms", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+}
+
+func TestAPI(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range apiTests {
+		req := httptest.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("for %s expected json but got %s", e.name, rr.Header().Get("Content-Type"))
+		}
+
+		if e.expectedErrorCode != "" {
+			var resp apiErrorEnvelope
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			if err != nil {
+				t.Errorf("for %s failed to parse error envelope: %s", e.name, err)
+				continue
+			}
+
+			if resp.Error.Code != e.expectedErrorCode {
+				t.Errorf("for %s expected error code %s but got %s", e.name, e.expectedErrorCode, resp.Error.Code)
+			}
+		}
+	}
+}
+
+func TestAPIValidationFields(t *testing.T) {
+	routes := getRoutes()
+
+	body := `{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"Jo","last_name":"Smith","email":"x"}`
+	req := httptest.NewRequest("POST", "/api/v1/reservations", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	var resp apiErrorEnvelope
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Error.Fields["first_name"]) == 0 || len(resp.Error.Fields["email"]) == 0 {
+		t.Errorf("expected field errors for first_name and email but got %v", resp.Error.Fields)
+	}
+}
+
+func TestAPIIdempotencyKey(t *testing.T) {
+	routes := getRoutes()
+
+	body := `{"room_id":1,"start_date":"2050-01-01","end_date":"2050-01-02","first_name":"John","last_name":"Smith","email":"john@smith.com","payment_token":"tok_visa"}`
+
+	var tests = []struct {
+		name               string
+		key                string
+		expectedStatusCode int
+		expectedErrorCode  string
+		replayed           bool
+	}{
+		{"new key", "new-key", http.StatusCreated, "", false},
+		{"completed key", "key-used", http.StatusCreated, "", true},
+		{"key for another request", "key-other", http.StatusUnprocessableEntity, "idempotency_key_reused", false},
+		{"key in progress", "key-pending", http.StatusConflict, "request_in_progress", false},
+		{"key too long", strings.Repeat("k", 256), http.StatusBadRequest, "invalid_idempotency_key", false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("POST", "/api/v1/reservations", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", e.key)
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if (rr.Header().Get("Idempotent-Replayed") == "true") != e.replayed {
+			t.Errorf("for %s expected replayed to be %t", e.name, e.replayed)
+		}
+
+		if e.expectedErrorCode != "" {
+			var resp apiErrorEnvelope
+			_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+			if resp.Error.Code != e.expectedErrorCode {
+				t.Errorf("for %s expected error code %s but got %s", e.name, e.expectedErrorCode, resp.Error.Code)
+			}
+		}
+	}
+}
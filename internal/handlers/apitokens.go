@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// AdminAPITokens lists the api tokens, showing a newly created token once
+func (m *Repository) AdminAPITokens(w http.ResponseWriter, r *http.Request) {
+	m.renderAPITokens(w, r, forms.New(nil))
+}
+
+// AdminPostAPIToken creates an api token
+func (m *Repository) AdminPostAPIToken(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "scope", "rate_limit")
+
+	scope := r.Form.Get("scope")
+	if scope != "read" && scope != "write" {
+		form.Errors.Add("scope", "Scope must be read or write")
+	}
+
+	rateLimit, err := strconv.Atoi(r.Form.Get("rate_limit"))
+	if err != nil || rateLimit < 0 {
+		form.Errors.Add("rate_limit", "Enter the number of requests allowed per minute, or 0 for no limit")
+	}
+
+	var expiresAt time.Time
+	if form.Has("expires_days") {
+		days, err := strconv.Atoi(r.Form.Get("expires_days"))
+		if err != nil || days < 1 {
+			form.Errors.Add("expires_days", "Enter a number of days, or leave blank for no expiry")
+		} else {
+			expiresAt = time.Now().AddDate(0, 0, days)
+		}
+	}
+
+	if !form.Valid() {
+		m.renderAPITokens(w, r, form)
+		return
+	}
+
+	token, err := helpers.GenerateToken(32)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	token = "bk_" + token
+
+	_, err = m.DB.InsertAPIToken(models.APIToken{
+		Name:      r.Form.Get("name"),
+		TokenHash: helpers.HashToken(token),
+		Scope:     scope,
+		RateLimit: rateLimit,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	// the token itself is never stored, so this is the only time it can be shown
+	m.App.Session.Put(r.Context(), "new_api_token", token)
+	m.App.Session.Put(r.Context(), "flash", "API token created")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
+
+// AdminDeleteAPIToken revokes an api token
+func (m *Repository) AdminDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteAPIToken(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "API token revoked")
+	http.Redirect(w, r, "/admin/api-tokens", http.StatusSeeOther)
+}
+
+func (m *Repository) renderAPITokens(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	tokens, err := m.DB.AllAPITokens()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["tokens"] = tokens
+
+	stringMap := make(map[string]string)
+	stringMap["new_token"] = m.App.Session.PopString(r.Context(), "new_api_token")
+
+	render.Template(w, r, "admin-api-tokens.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+	"github.com/tsawler/bookings-app/internal/render"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// confirmationCodeLength is the number of characters in a booking's confirmation code
+const confirmationCodeLength = 8
+
+// ChooseRooms takes the rooms ticked on the choose room page; a single room is
+// booked as before, several rooms go to the booking form
+func (m *Repository) ChooseRooms(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if _, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation); !ok {
+		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	var roomIds []int
+	seen := make(map[int]bool)
+	for _, x := range r.Form["room_id"] {
+		id, err := strconv.Atoi(x)
+		if err != nil || id < 1 {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			roomIds = append(roomIds, id)
+		}
+	}
+
+	switch len(roomIds) {
+	case 0:
+		m.App.Session.Put(r.Context(), "error", "Choose at least one room")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+	case 1:
+		http.Redirect(w, r, fmt.Sprintf("/choose-room/%d", roomIds[0]), http.StatusSeeOther)
+	default:
+		// the rooms are checked and taken together when the booking is stored
+		m.releaseHold(r)
+		m.App.Session.Put(r.Context(), "booking_rooms", roomIds)
+		http.Redirect(w, r, "/make-booking", http.StatusSeeOther)
+	}
+}
+
+// MakeBooking shows the guest form for a booking of several rooms
+func (m *Repository) MakeBooking(w http.ResponseWriter, r *http.Request) {
+	res, rooms, ok := m.bookingFromSession(w, r)
+	if !ok {
+		return
+	}
+
+	if res.Adults == 0 {
+		res.Adults = len(rooms)
+	}
+
+	m.renderMakeBooking(w, r, res, rooms, forms.New(nil), http.StatusOK)
+}
+
+// PostMakeBooking stores a booking of several rooms for one guest, all rooms or none
+func (m *Repository) PostMakeBooking(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't parse form!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	res, rooms, ok := m.bookingFromSession(w, r)
+	if !ok {
+		return
+	}
+
+	res.FirstName = r.Form.Get("first_name")
+	res.LastName = r.Form.Get("last_name")
+	res.Email = r.Form.Get("email")
+	res.Phone = r.Form.Get("phone")
+
+	form := forms.NewLocalized(r.PostForm, i18n.FromContext(r.Context()))
+	form.Required("first_name", "last_name", "email")
+	form.MinLength("first_name", 3)
+	form.IsEmail("email")
+
+	res.Adults, res.Children = parseGuests(form)
+	lines := splitParty(form, rooms, res.Adults, res.Children)
+
+	if !form.Valid() {
+		m.renderMakeBooking(w, r, res, rooms, form, http.StatusSeeOther)
+		return
+	}
+
+	for _, room := range rooms {
+		reasons, err := m.stayRuleReasons(room.ID, res.StartDate, res.EndDate)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't check the booking rules!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+		if len(reasons) > 0 {
+			m.App.Session.Put(r.Context(), "error", i18n.T(form.Locale, "Sorry, %s", stayRulesMessage(room.RoomName, reasons, form.Locale)))
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+	}
+
+	code, err := helpers.GenerateCode(confirmationCodeLength)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	booking := models.Booking{
+		ConfirmationCode: code,
+		FirstName:        res.FirstName,
+		LastName:         res.LastName,
+		Email:            res.Email,
+		Phone:            res.Phone,
+	}
+
+	nights := res.Nights()
+	for i, room := range rooms {
+		line := models.Reservation{
+			StartDate:            res.StartDate,
+			EndDate:              res.EndDate,
+			RoomID:               room.ID,
+			Room:                 room,
+			Adults:               lines[i][0],
+			Children:             lines[i][1],
+			Subtotal:             nights * room.NightlyRate,
+			CancellationPolicyID: room.CancellationPolicyID,
+			Locale:               form.Locale,
+			CheckInTime:          m.App.CheckInTime.String(),
+			CheckOutTime:         m.App.CheckOutTime.String(),
+		}
+
+		err = m.applyTaxes(&line)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		booking.Reservations = append(booking.Reservations, line)
+	}
+
+	// each room's deposit is authorized on its own, so it is recorded on that room's
+	// reservation, and the booking is only stored once all of them are
+	deposits := make([]int, len(booking.Reservations))
+	for i, line := range booking.Reservations {
+		deposits[i] = m.App.Deposit.For(line)
+		if deposits[i] > 0 {
+			form.Required("payment_token")
+		}
+	}
+	if !form.Valid() {
+		m.renderMakeBooking(w, r, res, rooms, form, http.StatusSeeOther)
+		return
+	}
+
+	refs := make([]string, len(booking.Reservations))
+	for i, line := range booking.Reservations {
+		if deposits[i] == 0 {
+			continue
+		}
+
+		refs[i], err = m.App.Payments.Authorize(form.Get("payment_token"), deposits[i],
+			fmt.Sprintf("Deposit for %s from %s", line.Room.RoomName, line.StartDate.Format("2006-01-02")))
+		if errors.Is(err, payments.ErrDeclined) {
+			m.voidDeposits(refs)
+			form.Errors.Add("payment_token", form.T("Your card was declined"))
+			m.renderMakeBooking(w, r, res, rooms, form, http.StatusSeeOther)
+			return
+		}
+		if err != nil {
+			m.voidDeposits(refs)
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", "Can't take the deposit!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+	}
+
+	booking, err = m.DB.InsertBooking(booking)
+	if err != nil {
+		m.voidDeposits(refs)
+	}
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, one of the rooms was booked by someone else in the meantime. Please search again")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't insert the booking into database!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	for i, line := range booking.Reservations {
+		if refs[i] != "" {
+			m.captureDeposit(line.ID, refs[i], deposits[i])
+		}
+	}
+
+	m.App.Session.Remove(r.Context(), "booking_rooms")
+	m.App.Session.Remove(r.Context(), "reservation")
+	m.App.Session.Put(r.Context(), "booking", booking)
+
+	m.sendBookingConfirmation(booking)
+	for _, line := range booking.Reservations {
+		m.notifyStaff(line)
+		m.fireReservationEvent("reservation.created", line.ID)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Booking made successfully")
+	http.Redirect(w, r, "/booking-summary", http.StatusSeeOther)
+}
+
+// BookingSummary shows the guest their confirmation code and the rooms they booked
+func (m *Repository) BookingSummary(w http.ResponseWriter, r *http.Request) {
+	booking, ok := m.App.Session.Get(r.Context(), "booking").(models.Booking)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "Can't get booking from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	m.App.Session.Remove(r.Context(), "booking")
+
+	data := make(map[string]interface{})
+	data["booking"] = booking
+
+	render.Template(w, r, "booking-summary.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// bookingFromSession returns the dates and chosen rooms of a booking in progress,
+// redirecting the guest when there is none
+func (m *Repository) bookingFromSession(w http.ResponseWriter, r *http.Request) (models.Reservation, []models.Room, bool) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	roomIds, ok2 := m.App.Session.Get(r.Context(), "booking_rooms").([]int)
+	if !ok || !ok2 || len(roomIds) == 0 {
+		m.App.Session.Put(r.Context(), "error", "Can't get booking from session")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return res, nil, false
+	}
+
+	var rooms []models.Room
+	for _, id := range roomIds {
+		room, err := m.DB.GetRoomById(id)
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't find room!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return res, nil, false
+		}
+		rooms = append(rooms, room)
+	}
+
+	return res, rooms, true
+}
+
+func (m *Repository) renderMakeBooking(w http.ResponseWriter, r *http.Request, res models.Reservation, rooms []models.Room, form *forms.Form, status int) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["rooms"] = rooms
+	data["deposit"] = m.App.Deposit.Type != "" && m.App.Deposit.Type != payments.NoDeposit
+
+	stringMap := make(map[string]string)
+	stringMap["start_date"] = res.StartDate.Format("2006-01-02")
+	stringMap["end_date"] = res.EndDate.Format("2006-01-02")
+
+	// like the reservation form, an invalid post re-renders with a 303 status
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	render.Template(w, r, "make-booking.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// splitParty shares the guests out over the rooms, at least one adult in each,
+// returning the adults and children for every room in order
+func splitParty(form *forms.Form, rooms []models.Room, adults, children int) [][2]int {
+	lines := make([][2]int, len(rooms))
+
+	if adults < len(rooms) {
+		form.Errors.Add("adults", form.T("Each room needs at least one adult"))
+		return lines
+	}
+
+	capacity := 0
+	for _, room := range rooms {
+		if room.MaxOccupancy == 0 {
+			capacity = -1
+			break
+		}
+		capacity += room.MaxOccupancy
+	}
+	if capacity >= 0 && adults+children > capacity {
+		form.Errors.Add("adults", form.T("These rooms sleep at most %d guests", capacity))
+		return lines
+	}
+
+	for i := range rooms {
+		lines[i][0] = 1
+	}
+	adults -= len(rooms)
+
+	// fill the rooms in order; a room without a limit takes everyone left
+	for i, room := range rooms {
+		free := room.MaxOccupancy - 1
+		if room.MaxOccupancy == 0 {
+			free = adults + children
+		}
+
+		n := min(adults, free)
+		lines[i][0] += n
+		adults -= n
+		free -= n
+
+		n = min(children, free)
+		lines[i][1] += n
+		children -= n
+	}
+
+	return lines
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// sendBookingConfirmation emails the guest the confirmation code and rooms of their booking
+func (m *Repository) sendBookingConfirmation(booking models.Booking) {
+	first := booking.Reservations[0]
+	l := first.Locale
+
+	var rooms []string
+	for _, res := range booking.Reservations {
+		rooms = append(rooms, i18n.T(l, "%s (%d adults, %d children)", res.Room.RoomName, res.Adults, res.Children))
+	}
+
+	htmlMsg := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		%s<br>
+		%s<br>
+		%s
+	`,
+		i18n.T(l, "Booking Confirmation"),
+		i18n.T(l, "Dear %s:", booking.FirstName),
+		i18n.T(l, "This is your confirmation for your booking from %s to %s.", i18n.Date(first.StartDate, l), i18n.Date(first.EndDate, l)),
+		i18n.T(l, "Check-in is from %s and check-out is by %s.", first.CheckInTime, first.CheckOutTime),
+		i18n.T(l, "Confirmation code: <strong>%s</strong>", booking.ConfirmationCode),
+		i18n.T(l, "Rooms: %s", strings.Join(rooms, ", ")),
+	)
+
+	msg := models.MailData{
+		To:       booking.Email,
+		From:     m.App.MailFrom,
+		Subject:  i18n.T(l, "Booking Confirmation") + " " + booking.ConfirmationCode,
+		Content:  htmlMsg,
+		Template: "base.html",
+	}
+
+	m.App.MailChan <- msg
+}
+
+// AdminBookings lists the bookings of several rooms
+func (m *Repository) AdminBookings(w http.ResponseWriter, r *http.Request) {
+	bookings, err := m.DB.AllBookings()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["bookings"] = bookings
+
+	render.Template(w, r, "admin-bookings.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminShowBooking shows a booking with a line for each of its rooms
+func (m *Repository) AdminShowBooking(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	booking, err := m.DB.GetBookingById(id)
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["booking"] = booking
+
+	render.Template(w, r, "admin-bookings-show.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminCancelBooking cancels every room of a booking
+func (m *Repository) AdminCancelBooking(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	booking, err := m.DB.GetBookingById(id)
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	lines := booking.Active()
+	for i := range lines {
+		lines[i].CancellationPenalty, lines[i].CancellationRefund, err = m.cancellationCharges(lines[i])
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	err = m.DB.CancelBooking(id, lines)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for _, res := range lines {
+		m.settleCancellation(res.ID, res.CancellationRefund)
+		m.fireReservationEvent("reservation.cancelled", res.ID)
+		m.offerWaitlistForReservation(res)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Booking cancelled")
+	http.Redirect(w, r, fmt.Sprintf("/admin/bookings/%d", id), http.StatusSeeOther)
+}
+
+// AdminCancelBookingRoom cancels one room of a booking, leaving the others booked
+func (m *Repository) AdminCancelBookingRoom(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	resId, err := strconv.Atoi(chi.URLParam(r, "reservation_id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	booking, err := m.DB.GetBookingById(id)
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	var line models.Reservation
+	for _, res := range booking.Active() {
+		if res.ID == resId {
+			line = res
+		}
+	}
+	if line.ID == 0 {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	penalty, refund, err := m.cancellationCharges(line)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.CancelReservation(resId, penalty, refund)
+	if errors.Is(err, repository.ErrAlreadyCancelled) {
+		m.App.Session.Put(r.Context(), "error", "This room was already cancelled")
+		http.Redirect(w, r, fmt.Sprintf("/admin/bookings/%d", id), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.settleCancellation(resId, refund)
+
+	m.fireReservationEvent("reservation.cancelled", resId)
+	m.offerWaitlistForReservation(line)
+
+	m.App.Session.Put(r.Context(), "flash", "Room cancelled")
+	http.Redirect(w, r, fmt.Sprintf("/admin/bookings/%d", id), http.StatusSeeOther)
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/cancellation"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// cancellationPolicy loads a cancellation policy, where an id of zero is the empty policy
+// under which cancelling is free
+func (m *Repository) cancellationPolicy(id int) (models.CancellationPolicy, error) {
+	if id == 0 {
+		return models.CancellationPolicy{}, nil
+	}
+	return m.DB.GetCancellationPolicyById(id)
+}
+
+// cancellationTerms explains the cancellation policy with the given id in a locale
+func (m *Repository) cancellationTerms(id int, locale string) (string, error) {
+	p, err := m.cancellationPolicy(id)
+	if err != nil {
+		return "", err
+	}
+	return cancellation.Terms(p).In(locale), nil
+}
+
+// roomCancellationTerms explains the cancellation policy of each room in a locale, by room id
+func (m *Repository) roomCancellationTerms(rooms []models.Room, locale string) (map[int]string, error) {
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	byId := make(map[int]models.CancellationPolicy)
+	for _, p := range policies {
+		byId[p.ID] = p
+	}
+
+	terms := make(map[int]string)
+	for _, room := range rooms {
+		terms[room.ID] = cancellation.Terms(byId[room.CancellationPolicyID]).In(locale)
+	}
+
+	return terms, nil
+}
+
+// cancellationCharges works out the penalty and refund, in cents, for cancelling a
+// reservation now under the policy it was booked with. The refund is of what the guest
+// paid through the payment provider, such as a deposit, not of the whole price.
+func (m *Repository) cancellationCharges(res models.Reservation) (int, int, error) {
+	p, err := m.cancellationPolicy(res.CancellationPolicyID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	penalty := cancellation.Penalty(p, res, m.now())
+
+	paid, err := m.DB.GetPaymentsForReservation(res.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return penalty, cancellation.Refund(payments.Paid(paid), penalty), nil
+}
+
+// settleCancellation pays a cancelled reservation's refund back through the payment
+// provider, from its captured payments in turn, and voids the deposits that were never
+// captured. What the provider refuses is logged and left on the folio for staff.
+func (m *Repository) settleCancellation(reservationId, refund int) {
+	ps, err := m.DB.GetPaymentsForReservation(reservationId)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	for _, p := range ps {
+		if p.Provider != m.App.Payments.Name() {
+			continue
+		}
+
+		switch p.Status {
+		case payments.Authorized:
+			err = m.voidPayment(p)
+		case payments.Captured:
+			amount := min(refund, p.Amount-p.Refunded)
+			if amount < 1 {
+				continue
+			}
+			err = m.refundPayment(p, amount)
+			if err == nil {
+				refund -= amount
+			}
+		}
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+}
+
+// AdminCancellationPolicies lists the cancellation policies, and the form to add one
+func (m *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	m.renderCancellationPolicies(w, r, forms.New(nil))
+}
+
+// AdminPostCancellationPolicy adds a cancellation policy. Policies are never changed or
+// deleted, so reservations keep the terms they were booked under.
+func (m *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "penalty_type")
+
+	p := models.CancellationPolicy{
+		Name:          strings.TrimSpace(form.Get("name")),
+		FreeDays:      stayRuleNumber(form, "free_days"),
+		PenaltyType:   form.Get("penalty_type"),
+		NonRefundable: form.Get("non_refundable") == "1",
+	}
+
+	switch p.PenaltyType {
+	case cancellation.Percent:
+		p.PenaltyPercent, err = strconv.Atoi(form.Get("penalty_percent"))
+		if err != nil || p.PenaltyPercent < 1 || p.PenaltyPercent > 100 {
+			form.Errors.Add("penalty_percent", "Enter a whole percentage from 1 to 100")
+		}
+	case cancellation.FirstNight, cancellation.FullStay:
+	default:
+		form.Errors.Add("penalty_type", "Choose what cancelling late costs")
+	}
+
+	if !form.Valid() {
+		m.renderCancellationPolicies(w, r, form)
+		return
+	}
+
+	_, err = m.DB.InsertCancellationPolicy(p)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy added")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+func (m *Repository) renderCancellationPolicies(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	terms := make(map[int]string)
+	for _, p := range policies {
+		terms[p.ID] = cancellation.Terms(p).String()
+	}
+
+	data := make(map[string]interface{})
+	data["policies"] = policies
+	data["terms"] = terms
+
+	render.Template(w, r, "admin-cancellation-policies.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostRoomCancellationPolicy sets the cancellation policy of new reservations for a room
+func (m *Repository) AdminPostRoomCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	policyId := 0
+	if r.Form.Get("cancellation_policy_id") != "" {
+		policyId, err = strconv.Atoi(r.Form.Get("cancellation_policy_id"))
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = m.DB.UpdateRoomCancellationPolicy(id, policyId)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/currency"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// maxRatesFile is the largest exchange rate file staff can import
+const maxRatesFile = 1 << 20
+
+// LoadExchangeRates reads the exchange rates into the table prices are converted with
+func (m *Repository) LoadExchangeRates() error {
+	rates, err := m.DB.AllExchangeRates()
+	if err != nil {
+		return err
+	}
+
+	m.App.Currencies.Load(rates)
+
+	return nil
+}
+
+// PostCurrency remembers the currency the guest wants to see prices in, and takes them back
+// to the page they were on
+func (m *Repository) PostCurrency(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	code := strings.ToUpper(r.Form.Get("currency"))
+	if m.App.Currencies.Has(code) {
+		m.App.Session.Put(r.Context(), "currency", code)
+	} else {
+		m.App.Session.Put(r.Context(), "error", "We can't show prices in that currency")
+	}
+
+	// only the path is kept, so the redirect can't leave the site
+	back := "/"
+	if u, err := url.Parse(r.Referer()); err == nil && strings.HasPrefix(u.Path, "/") {
+		back = u.Path
+		if u.RawQuery != "" {
+			back += "?" + u.RawQuery
+		}
+	}
+
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// AdminCurrencies lists the exchange rates, with forms to set a rate and import a file of them
+func (m *Repository) AdminCurrencies(w http.ResponseWriter, r *http.Request) {
+	m.renderCurrencies(w, r, forms.New(nil))
+}
+
+// AdminPostExchangeRate sets the rate for one currency
+func (m *Repository) AdminPostExchangeRate(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("currency", "rate")
+
+	code := strings.ToUpper(form.Get("currency"))
+	if _, ok := currency.Lookup(code); !ok {
+		form.Errors.Add("currency", "Choose a currency")
+	} else if code == m.App.Currencies.Base() {
+		form.Errors.Add("currency", "Prices are already in "+code)
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(form.Get("rate")), 64)
+	if err != nil || rate <= 0 {
+		form.Errors.Add("rate", "Enter how much one "+m.App.Currencies.Base()+" buys, such as 0.61")
+	}
+
+	if !form.Valid() {
+		m.renderCurrencies(w, r, form)
+		return
+	}
+
+	err = m.DB.SaveExchangeRates([]models.ExchangeRate{{Currency: code, Rate: rate}})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.LoadExchangeRates()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Exchange rate saved")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
+
+// AdminPostImportExchangeRates sets the rates from an uploaded CSV file, such as one exported
+// from a bank. A file with any bad line changes nothing.
+func (m *Repository) AdminPostImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRatesFile)
+
+	file, _, err := r.FormFile("rates")
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Choose a file of exchange rates to import")
+		http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	rates, err := currency.ParseRates(file, m.App.Currencies.Base())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't import the rates: "+err.Error())
+		http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.SaveExchangeRates(rates)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.LoadExchangeRates()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", strconv.Itoa(len(rates))+" exchange rates imported")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
+
+// AdminPostDeleteExchangeRate removes a rate, so guests can no longer choose its currency
+func (m *Repository) AdminPostDeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteExchangeRate(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.LoadExchangeRates()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Exchange rate removed")
+	http.Redirect(w, r, "/admin/currencies", http.StatusSeeOther)
+}
+
+func (m *Repository) renderCurrencies(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rates, err := m.DB.AllExchangeRates()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	examples := make(map[string]string)
+	for _, rate := range rates {
+		examples[rate.Currency] = m.App.Currencies.Format(10000, rate.Currency, "en")
+	}
+
+	data := make(map[string]interface{})
+	data["rates"] = rates
+	data["codes"] = currency.Codes()
+	data["examples"] = examples
+
+	render.Template(w, r, "admin-currencies.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
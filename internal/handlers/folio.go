@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/folio"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// AdminPostFolioCharge posts an extra, and the tax on it when one is entered, to a
+// reservation's folio
+func (m *Repository) AdminPostFolioCharge(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.folioReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("description", "amount")
+
+	description := strings.TrimSpace(form.Get("description"))
+	amount := folioAmount(form, "amount")
+
+	tax := 0
+	if strings.TrimSpace(form.Get("tax")) != "" {
+		tax = folioAmount(form, "tax")
+	}
+
+	if !form.Valid() {
+		m.folioFormError(w, r, res, form, "description", "amount", "tax")
+		return
+	}
+
+	_, err = m.DB.InsertFolioItem(models.FolioItem{
+		ReservationID: res.ID,
+		Kind:          folio.Charge,
+		Description:   description,
+		Amount:        amount,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if tax > 0 {
+		_, err = m.DB.InsertFolioItem(models.FolioItem{
+			ReservationID: res.ID,
+			Kind:          folio.Tax,
+			Description:   "Tax on " + description,
+			Amount:        tax,
+		})
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Charge posted")
+	http.Redirect(w, r, folioURL(res.ID), http.StatusSeeOther)
+}
+
+// AdminPostFolioPayment posts a payment or refund made outside the payment provider, such
+// as cash or a bank transfer, to a reservation's folio
+func (m *Repository) AdminPostFolioPayment(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.folioReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("kind", "description", "amount")
+
+	kind := form.Get("kind")
+	if kind != folio.Payment && kind != folio.Refund {
+		form.Errors.Add("kind", "Choose a payment or a refund")
+	}
+
+	amount := folioAmount(form, "amount")
+
+	if !form.Valid() {
+		m.folioFormError(w, r, res, form, "kind", "description", "amount")
+		return
+	}
+
+	_, err = m.DB.InsertFolioItem(models.FolioItem{
+		ReservationID: res.ID,
+		Kind:          kind,
+		Description:   strings.TrimSpace(form.Get("description")),
+		Amount:        amount,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if kind == folio.Refund {
+		m.App.Session.Put(r.Context(), "flash", "Refund posted")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Payment posted")
+	}
+	http.Redirect(w, r, folioURL(res.ID), http.StatusSeeOther)
+}
+
+// AdminBalances reports what guests owe, or are owed, for reservations departing between
+// two dates; the current month by default
+func (m *Repository) AdminBalances(w http.ResponseWriter, r *http.Request) {
+	today := m.today()
+	start := today.AddDate(0, 0, 1-today.Day())
+	end := start.AddDate(0, 1, -1)
+
+	if s := r.URL.Query().Get("start"); s != "" {
+		t, err := time.Parse(apiDateLayout, s)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		start = t
+	}
+	if e := r.URL.Query().Get("end"); e != "" {
+		t, err := time.Parse(apiDateLayout, e)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+		end = t
+	}
+	if end.Before(start) {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	reservations, err := m.DB.GetReservationsDepartingBetween(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	items, err := m.DB.GetFolioItemsDepartingBetween(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	paid, err := m.DB.GetPaymentsDepartingBetween(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	taxLines, err := m.DB.GetReservationTaxesDepartingBetween(start, end)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	itemsFor := make(map[int][]models.FolioItem)
+	for _, item := range items {
+		itemsFor[item.ReservationID] = append(itemsFor[item.ReservationID], item)
+	}
+
+	paidFor := make(map[int][]models.Payment)
+	for _, p := range paid {
+		paidFor[p.ReservationID] = append(paidFor[p.ReservationID], p)
+	}
+
+	taxesFor := make(map[int][]models.ReservationTax)
+	for _, t := range taxLines {
+		taxesFor[t.ReservationID] = append(taxesFor[t.ReservationID], t)
+	}
+
+	var balances []reservationBalance
+	outstanding := 0
+
+	for _, res := range reservations {
+		res.TaxLines = taxesFor[res.ID]
+		f := folio.Build(res, itemsFor[res.ID], paidFor[res.ID])
+		if f.Balance == 0 {
+			continue
+		}
+
+		balances = append(balances, reservationBalance{Reservation: res, Folio: f})
+		outstanding += f.Balance
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = start.Format(apiDateLayout)
+	stringMap["end"] = end.Format(apiDateLayout)
+
+	data := make(map[string]interface{})
+	data["balances"] = balances
+	data["outstanding"] = outstanding
+
+	render.Template(w, r, "admin-balances.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// reservationBalance is a line of the balances report
+type reservationBalance struct {
+	Reservation models.Reservation
+	Folio       folio.Folio
+}
+
+// folioReservationFromURL loads the reservation named by the id url parameter, writing the
+// response when it can't
+func (m *Repository) folioReservationFromURL(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Reservation{}, false
+	}
+
+	res, err := m.DB.GetReservationById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return res, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return res, false
+	}
+
+	return res, true
+}
+
+// folioAmount reads a positive amount of money, in cents
+func folioAmount(form *forms.Form, field string) int {
+	if form.Get(field) == "" {
+		return 0
+	}
+
+	amount, err := parseCents(form.Get(field))
+	if err != nil || amount < 1 {
+		form.Errors.Add(field, "Enter an amount such as 20 or 20.50")
+		return 0
+	}
+
+	return amount
+}
+
+// folioFormError sends staff back to the folio with the first problem found on the form
+func (m *Repository) folioFormError(w http.ResponseWriter, r *http.Request, res models.Reservation, form *forms.Form, fields ...string) {
+	for _, field := range fields {
+		if msg := form.Errors.Get(field); msg != "" {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s: %s", strings.Title(field), msg))
+			break
+		}
+	}
+	http.Redirect(w, r, folioURL(res.ID), http.StatusSeeOther)
+}
+
+func folioURL(reservationId int) string {
+	return fmt.Sprintf("/admin/reservations/all/%d/show", reservationId)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,11 +11,15 @@ import (
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/clock"
 	"github.com/tsawler/bookings-app/internal/config"
 	"github.com/tsawler/bookings-app/internal/driver"
+	"github.com/tsawler/bookings-app/internal/folio"
 	"github.com/tsawler/bookings-app/internal/forms"
 	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
 	"github.com/tsawler/bookings-app/internal/render"
 	"github.com/tsawler/bookings-app/internal/repository"
 	"github.com/tsawler/bookings-app/internal/repository/dbrepo"
@@ -50,6 +55,17 @@ func NewHandlers(r *Repository) {
 	Repo = r
 }
 
+// now returns the current time on the property's clock, so the dates taken from it are the
+// property's dates
+func (m *Repository) now() time.Time {
+	return clock.Now(m.App.Timezone)
+}
+
+// today returns the date at the property, comparable with the dates of a stay
+func (m *Repository) today() time.Time {
+	return clock.Today(m.App.Timezone)
+}
+
 // Home is the handler for the home page
 func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "home.page.tmpl", &models.TemplateData{})
@@ -83,18 +99,53 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res.Room.RoomName = room.RoomName
+	res.Room.MaxOccupancy = room.MaxOccupancy
+	res.Room.NightlyRate = room.NightlyRate
+	res.Subtotal = res.Nights() * room.NightlyRate
+	res.CancellationPolicyID = room.CancellationPolicyID
+	if res.Adults == 0 {
+		res.Adults = 1
+	}
+
+	err = m.applyTaxes(&res)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't work out the taxes!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	terms, err := m.cancellationTerms(res.CancellationPolicyID, i18n.FromContext(r.Context()))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find the cancellation policy!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	sd := res.StartDate.Format("2006-01-02")
 	ed := res.EndDate.Format("2006-01-02")
 
+	// one-time token so a resubmitted form does not book twice
+	formToken, err := helpers.GenerateToken(16)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	stringMap["form_token"] = formToken
+	stringMap["cancellation_terms"] = terms
+
+	if expiresAt := m.holdExpiry(r); expiresAt.After(time.Now()) {
+		stringMap["hold_expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["deposit"] = m.App.Deposit.For(res)
 
 	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 		Form:      forms.New(nil),
@@ -105,20 +156,42 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 // PostReservation handles the posting of a reservation form
 func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
-	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
-	if !ok {
-		// helpers.ServerError(w, errors.New("can't get from session"))
+	err := r.ParseForm()
+	if err != nil {
+		// helpers.ServerError(w, err)
 		// return
-		m.App.Session.Put(r.Context(), "error", "Can't get form session!")
+		m.App.Session.Put(r.Context(), "error", "Can't parse form!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
-	err := r.ParseForm()
-	if err != nil {
-		// helpers.ServerError(w, err)
+	// a resubmitted form shows the reservation created the first time
+	formToken := r.Form.Get("form_token")
+	formKey := ""
+	if formToken != "" {
+		formKey = "form:" + formToken
+
+		key, claimed, err := m.DB.ClaimIdempotencyKey(formKey, "")
+		if err != nil {
+			m.App.Session.Put(r.Context(), "error", "Can't check the reservation form!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
+
+		if !claimed {
+			m.replayReservation(w, r, key)
+			return
+		}
+
+		// frees the token unless a reservation was stored for it
+		defer m.releaseIdempotencyKey(formKey)
+	}
+
+	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		// helpers.ServerError(w, errors.New("can't get from session"))
 		// return
-		m.App.Session.Put(r.Context(), "error", "Can't parse form!")
+		m.App.Session.Put(r.Context(), "error", "Can't get form session!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
@@ -170,18 +243,52 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	// 	RoomID:    roomId,
 	// }
 
-	form := forms.New(r.PostForm)
+	form := forms.NewLocalized(r.PostForm, i18n.FromContext(r.Context()))
 
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
 
+	reservation.Locale = form.Locale
+	reservation.CheckInTime = m.App.CheckInTime.String()
+	reservation.CheckOutTime = m.App.CheckOutTime.String()
+
+	if form.Has("adults") || form.Has("children") {
+		reservation.Adults, reservation.Children = parseGuests(form)
+	}
+	if reservation.Adults == 0 {
+		reservation.Adults = 1
+	}
+	checkOccupancy(form, reservation.Room, reservation.Adults, reservation.Children)
+
+	err = m.priceReservation(form, &reservation)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't work out the price!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
+	deposit := m.App.Deposit.For(reservation)
+	if deposit > 0 {
+		form.Required("payment_token")
+	}
+
+	terms, err := m.cancellationTerms(reservation.CancellationPolicyID, i18n.FromContext(r.Context()))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find the cancellation policy!")
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return
+	}
+
 	sd := reservation.StartDate.Format("2006-01-02")
 	ed := reservation.EndDate.Format("2006-01-02")
 
 	stringMap := make(map[string]string)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
+	stringMap["form_token"] = formToken
+	stringMap["cancellation_terms"] = terms
 
 	if !form.Valid() {
 		// data := make(map[string]interface{})
@@ -191,66 +298,182 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		// 	Data: data,
 		// })
 		// return
-		data := make(map[string]interface{})
-		data["reservation"] = reservation
-
-		// if we use here http.Error(w, "error message", http.StatusSeeOther) then it writes directly to response body this message, precisely above html code from render.Template function. This way, browser can't understand and render the page correctly and results in blank screen with pure html code. But w.WriteHeader only writes status code to header and doesn't touch body content. Thus, we get working app and passing tests.
-		w.WriteHeader(http.StatusSeeOther)
-		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
-			Form:      form,
-			Data:      data,
-			StringMap: stringMap,
-		})
+		m.renderReservationForm(w, r, form, reservation, stringMap)
 		return
 	}
 
-	newReservationId, err := m.DB.InsertReservation(reservation)
+	reasons, err := m.stayRuleReasons(reservation.RoomID, reservation.StartDate, reservation.EndDate)
 	if err != nil {
-		// helpers.ServerError(w, err)
-		// return
-		m.App.Session.Put(r.Context(), "error", "Can't insert the reservation into database!")
+		m.App.Session.Put(r.Context(), "error", "Can't check the booking rules!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
+	if len(reasons) > 0 {
+		m.releaseHold(r)
+		l := i18n.FromContext(r.Context())
+		m.App.Session.Put(r.Context(), "error", i18n.T(l, "Sorry, %s", stayRulesMessage(reservation.Room.RoomName, reasons, l)))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+	// only book if nobody has taken the room meanwhile, apart from the guest's own hold
+	holdId := m.App.Session.GetInt(r.Context(), "hold_id")
+	available, err := m.DB.SearchAvailabilityExceptHold(reservation.StartDate, reservation.EndDate, reservation.RoomID, holdId)
+	if err != nil || !available {
+		m.roomTaken(w, r, holdId)
+		return
+	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationId,
-		RestrictionID: 1,
+	// the reservation is only confirmed once the card has been authorized for the deposit
+	depositRef := ""
+	if deposit > 0 {
+		depositRef, err = m.App.Payments.Authorize(form.Get("payment_token"), deposit,
+			fmt.Sprintf("Deposit for %s from %s", reservation.Room.RoomName, sd))
+		if errors.Is(err, payments.ErrDeclined) {
+			form.Errors.Add("payment_token", form.T("Your card was declined"))
+			m.renderReservationForm(w, r, form, reservation, stringMap)
+			return
+		}
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			m.App.Session.Put(r.Context(), "error", "Can't take the deposit!")
+			http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+			return
+		}
 	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
+	// the reservation is stored with its room restriction, taking over the guest's hold
+	newReservationId, err := m.DB.InsertReservation(reservation, holdId)
 	if err != nil {
 		// helpers.ServerError(w, err)
 		// return
-		m.App.Session.Put(r.Context(), "error", "Can't insert room restriction!")
+		if depositRef != "" {
+			if err := m.App.Payments.Void(depositRef); err != nil {
+				m.App.ErrorLog.Println(err)
+			}
+		}
+		// someone else took the room since it was checked above
+		if errors.Is(err, repository.ErrRoomUnavailable) {
+			m.roomTaken(w, r, holdId)
+			return
+		}
+		// someone else took the code's last use since the price was worked out
+		if errors.Is(err, repository.ErrPromoCodeUsedUp) {
+			reservation.Discount, reservation.PromoCodeID, reservation.PromoCode = 0, 0, ""
+			if err := m.applyTaxes(&reservation); err != nil {
+				m.App.ErrorLog.Println(err)
+			}
+			form.Errors.Add("promo_code", form.T("This promo code has been used up"))
+			m.renderReservationForm(w, r, form, reservation, stringMap)
+			return
+		}
+		m.App.Session.Put(r.Context(), "error", "Can't insert the reservation into database!")
 		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
 		return
 	}
 
+	if depositRef != "" && m.captureDeposit(newReservationId, depositRef, deposit) {
+		m.App.Session.Put(r.Context(), "deposit", deposit)
+	}
+
+	m.forgetHold(r)
+	m.claimWaitlistEntry(r, reservation)
+
+	reservation.ID = newReservationId
+	if formKey != "" {
+		m.completeIdempotencyKey(formKey, newReservationId)
+	}
+
 	// Send notifications
+	m.sendConfirmation(reservation)
+	m.notifyStaff(reservation)
+	m.fireEvent("reservation.created", toAPIReservation(reservation))
+
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// sendConfirmation emails the guest a confirmation of their reservation
+func (m *Repository) sendConfirmation(reservation models.Reservation) {
+	l := reservation.Locale
+
+	terms, err := m.cancellationTerms(reservation.CancellationPolicyID, l)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	taxLines := ""
+	for _, t := range reservation.TaxLines {
+		if t.Inclusive {
+			taxLines += fmt.Sprintf("%s: %s %s<br>\n", t.Name, render.Money(t.Amount, l), i18n.T(l, "(included in the price)"))
+		} else {
+			taxLines += fmt.Sprintf("%s: %s<br>\n", t.Name, render.Money(t.Amount, l))
+		}
+	}
+
 	htmlMsg := fmt.Sprintf(`
-		<strong>Reserve Confirmation</strong><br>
-		Dear %s: <br>
-		This is your confirmation for your reservation from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		%s<br>
+		%s%s<br>
+		%s
+	`,
+		i18n.T(l, "Reservation Confirmation"),
+		i18n.T(l, "Dear %s:", reservation.FirstName),
+		i18n.T(l, "This is your confirmation for your reservation from %s to %s.",
+			i18n.Date(reservation.StartDate, l), i18n.Date(reservation.EndDate, l)),
+		i18n.T(l, "Check-in is from %s and check-out is by %s.", reservation.CheckInTime, reservation.CheckOutTime),
+		taxLines,
+		i18n.T(l, "Total: %s", render.Money(reservation.Total(), l)),
+		terms,
+	)
 
 	msg := models.MailData{
 		To:       reservation.Email,
-		From:     "me@helloworld.com",
-		Subject:  "Reservation Confirmation",
+		From:     m.App.MailFrom,
+		Subject:  i18n.T(l, "Reservation Confirmation"),
 		Content:  htmlMsg,
 		Template: "base.html",
 	}
 
 	m.App.MailChan <- msg
+}
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+// notifyStaff emails every configured staff recipient about a new reservation
+func (m *Repository) notifyStaff(reservation models.Reservation) {
+	if len(m.App.StaffEmails) == 0 {
+		return
+	}
+
+	htmlMsg := fmt.Sprintf(`
+		<strong>New Reservation</strong><br>
+		A new reservation (#%d) has been made for %s.<br>
+		Guest: %s %s (%s, %s)<br>
+		Arrival: %s<br>
+		Departure: %s
+	`,
+		reservation.ID,
+		reservation.Room.RoomName,
+		reservation.FirstName,
+		reservation.LastName,
+		reservation.Email,
+		reservation.Phone,
+		reservation.StartDate.Format("2006-01-02"),
+		reservation.EndDate.Format("2006-01-02"),
+	)
+
+	for _, to := range m.App.StaffEmails {
+		msg := models.MailData{
+			To:       to,
+			From:     m.App.MailFrom,
+			Subject:  fmt.Sprintf("New Reservation #%d", reservation.ID),
+			Content:  htmlMsg,
+			Template: "base.html",
+		}
+
+		m.App.MailChan <- msg
+	}
 }
 
 // Generals renders the room page
@@ -285,7 +508,21 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	form := forms.NewLocalized(r.Form, i18n.FromContext(r.Context()))
+	adults, children := parseGuests(form)
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", form.Errors.Get("adults")+form.Errors.Get("children"))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	if startDate.Before(m.today()) {
+		m.App.Session.Put(r.Context(), "error", "You can't arrive before today")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate, adults+children)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
@@ -296,19 +533,46 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	// 	m.App.InfoLog.Println("ROOM:", i.ID, i.RoomName)
 	// }
 
+	rooms, restricted, err := m.applyStayRules(rooms, startDate, endDate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	if len(rooms) == 0 {
 		// No availability
+		if len(restricted) > 0 {
+			var reasons []string
+			for _, x := range restricted {
+				reasons = append(reasons, stayRulesMessage(x.Room.RoomName, x.Reasons, i18n.FromContext(r.Context())))
+			}
+			m.App.Session.Put(r.Context(), "error", strings.Join(reasons, ". "))
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		// fully booked, so offer the waitlist for these dates
 		m.App.Session.Put(r.Context(), "error", "No availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		http.Redirect(w, r, waitlistURL(startDate, endDate, adults, children), http.StatusSeeOther)
+		return
+	}
+
+	terms, err := m.roomCancellationTerms(rooms, i18n.FromContext(r.Context()))
+	if err != nil {
+		helpers.ServerError(w, err)
 		return
 	}
 
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
+	data["restricted"] = restricted
+	data["terms"] = terms
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
@@ -409,9 +673,30 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	message := ""
+	if available {
+		reasons, err := m.stayRuleReasons(roomId, startDate, endDate)
+		if err != nil {
+			resp := jsonResponse{
+				OK:      false,
+				Message: "Error connecting to Database",
+			}
+
+			out, _ := json.MarshalIndent(resp, "", "     ")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(out)
+
+			return
+		}
+		if len(reasons) > 0 {
+			available = false
+			message = strings.Join(messagesIn(reasons, i18n.FromContext(r.Context())), "; ")
+		}
+	}
+
 	resp := jsonResponse{
 		OK:        available,
-		Message:   "",
+		Message:   message,
 		StartDate: sd,
 		EndDate:   ed,
 		RoomID:    strconv.Itoa(roomId),
@@ -428,6 +713,21 @@ func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
 }
 
+// renderReservationForm shows the reservation form again with the problems found
+func (m *Repository) renderReservationForm(w http.ResponseWriter, r *http.Request, form *forms.Form, res models.Reservation, stringMap map[string]string) {
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["deposit"] = m.App.Deposit.For(res)
+
+	// if we use here http.Error(w, "error message", http.StatusSeeOther) then it writes directly to response body this message, precisely above html code from render.Template function. This way, browser can't understand and render the page correctly and results in blank screen with pure html code. But w.WriteHeader only writes status code to header and doesn't touch body content. Thus, we get working app and passing tests.
+	w.WriteHeader(http.StatusSeeOther)
+	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
+		Form:      form,
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
 // ReservationSummary displays the res summary page
 func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
@@ -449,6 +749,17 @@ func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request)
 	stringMap["start_date"] = sd
 	stringMap["end_date"] = ed
 
+	terms, err := m.cancellationTerms(reservation.CancellationPolicyID, i18n.FromContext(r.Context()))
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	} else {
+		stringMap["cancellation_terms"] = terms
+	}
+
+	if deposit := m.App.Session.PopInt(r.Context(), "deposit"); deposit > 0 {
+		stringMap["deposit"] = render.Money(deposit, i18n.FromContext(r.Context()))
+	}
+
 	render.Template(w, r, "reservation-summary.page.tmpl", &models.TemplateData{
 		Data:      data,
 		StringMap: stringMap,
@@ -474,6 +785,7 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	res.RoomID = roomId
 
 	m.App.Session.Put(r.Context(), "reservation", res)
+	m.placeHold(r, res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
@@ -515,6 +827,7 @@ func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
 	res.EndDate = endDate
 
 	m.App.Session.Put(r.Context(), "reservation", res)
+	m.placeHold(r, res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
@@ -641,8 +954,28 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	stringMap["cancellation_terms"], err = m.cancellationTerms(res.CancellationPolicyID, i18n.Default)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	paid, err := m.DB.GetPaymentsForReservation(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	items, err := m.DB.GetFolioItemsForReservation(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["payments"] = paid
+	data["folio"] = folio.Build(res, items, paid)
 
 	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
 		StringMap: stringMap,
@@ -689,6 +1022,8 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	m.fireEvent("reservation.modified", toAPIReservation(res))
+
 	month := r.Form.Get("month")
 	year := r.Form.Get("year")
 
@@ -709,6 +1044,8 @@ func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Requ
 	err := m.DB.UpdateProcessedForReservation(id, 1)
 	if err != nil {
 		log.Println(err)
+	} else {
+		m.fireReservationEvent("reservation.processed", id)
 	}
 
 	year := r.URL.Query().Get("y")
@@ -728,12 +1065,70 @@ func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Reque
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
 
-	_ = m.DB.DeleteReservation(id)
+	// load the reservation first, as it is gone once deleted
+	res, getErr := m.DB.GetReservationById(id)
+
+	err := m.DB.DeleteReservation(id)
+	switch {
+	case errors.Is(err, repository.ErrReservationInvoiced):
+		m.App.Session.Put(r.Context(), "error", "This reservation has an invoice, so it can't be deleted. Cancel it instead.")
+	case err != nil:
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't delete the reservation")
+	default:
+		if getErr == nil && res.CancelledAt.IsZero() {
+			res.CancelledAt = time.Now()
+			m.fireEvent("reservation.cancelled", toAPIReservation(res))
+			m.offerWaitlistForReservation(res)
+		}
+		m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	}
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation deleted")
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// AdminCancelReservation cancels a reservation by id and frees its dates
+func (m *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	src := chi.URLParam(r, "src")
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err == nil {
+		var res models.Reservation
+		res, err = m.DB.GetReservationById(id)
+		if err == nil {
+			var penalty, refund int
+			penalty, refund, err = m.cancellationCharges(res)
+			if err == nil {
+				err = m.DB.CancelReservation(id, penalty, refund)
+			}
+			// the refund and notifications only go out for the cancellation that happened here
+			if err == nil {
+				m.settleCancellation(id, refund)
+				m.fireReservationEvent("reservation.cancelled", id)
+				m.offerWaitlistForReservation(res)
+			}
+		}
+	}
+
+	switch {
+	case err == nil:
+		m.App.Session.Put(r.Context(), "flash", "Reservation cancelled")
+	case errors.Is(err, repository.ErrAlreadyCancelled):
+		m.App.Session.Put(r.Context(), "error", "This reservation was already cancelled")
+	default:
+		log.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Can't cancel the reservation")
+	}
+
+	year := r.URL.Query().Get("y")
+	month := r.URL.Query().Get("m")
 
 	if year == "" {
 		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
@@ -745,7 +1140,7 @@ func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Reque
 // Admin Calendar Reservations page
 func (m *Repository) AdminCalendarReservations(w http.ResponseWriter, r *http.Request) {
 	// Assume that there is no month/year specified
-	now := time.Now()
+	now := m.today()
 
 	if r.URL.Query().Get("y") != "" {
 		year, _ := strconv.Atoi(r.URL.Query().Get("y"))
@@ -878,6 +1273,10 @@ func (m *Repository) AdminPostCalendarReservations(w http.ResponseWriter, r *htt
 							log.Println(err)
 							return
 						}
+
+						t, _ := time.Parse("2006-01-2", name)
+						m.fireEvent("block.deleted", apiBlock{ID: value, RoomID: x.ID, Date: t.Format(apiDateLayout)})
+						m.offerWaitlist(x.ID, t, t.AddDate(0, 0, 1))
 					}
 				}
 			}
@@ -898,6 +1297,8 @@ func (m *Repository) AdminPostCalendarReservations(w http.ResponseWriter, r *htt
 				log.Println(err)
 				return
 			}
+
+			m.fireEvent("block.created", apiBlock{RoomID: roomId, Date: t.Format(apiDateLayout)})
 		}
 	}
 
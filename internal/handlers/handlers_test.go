@@ -1,18 +1,27 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
 )
 
 // type postData struct {
@@ -40,6 +49,37 @@ var theTests = []struct {
 	{"new res", "/admin/reservations-new", "GET", http.StatusOK},
 	{"new res", "/admin/reservations-all", "GET", http.StatusOK},
 	{"show res", "/admin/reservations/new/1/show", "GET", http.StatusOK},
+	{"cancel res", "/admin/cancel-reservation/new/1/do", "GET", http.StatusOK},
+	{"calendar feeds", "/admin/calendar-feeds", "GET", http.StatusOK},
+	{"ical feed", "/ical/valid-token.ics", "GET", http.StatusOK},
+	{"ical feed bad token", "/ical/bad-token.ics", "GET", http.StatusNotFound},
+	{"external calendars", "/admin/external-calendars", "GET", http.StatusOK},
+	{"api tokens", "/admin/api-tokens", "GET", http.StatusOK},
+	{"bookings", "/admin/bookings", "GET", http.StatusOK},
+	{"show booking", "/admin/bookings/1", "GET", http.StatusOK},
+	{"show booking not found", "/admin/bookings/99", "GET", http.StatusNotFound},
+	{"stay rules", "/admin/stay-rules", "GET", http.StatusOK},
+	{"rooms", "/admin/rooms", "GET", http.StatusOK},
+	{"promo codes", "/admin/promo-codes", "GET", http.StatusOK},
+	{"taxes", "/admin/taxes", "GET", http.StatusOK},
+	{"currencies", "/admin/currencies", "GET", http.StatusOK},
+	{"cancellation policies", "/admin/cancellation-policies", "GET", http.StatusOK},
+	{"balances", "/admin/balances", "GET", http.StatusOK},
+	{"balances for dates", "/admin/balances?start=2050-01-01&end=2050-01-31", "GET", http.StatusOK},
+	{"balances bad date", "/admin/balances?start=January", "GET", http.StatusBadRequest},
+	{"balances dates reversed", "/admin/balances?start=2050-01-31&end=2050-01-01", "GET", http.StatusBadRequest},
+	{"invoice", "/admin/reservations/1/invoice.pdf", "GET", http.StatusOK},
+	{"invoice numbering fails", "/admin/reservations/2/invoice.pdf", "GET", http.StatusInternalServerError},
+	{"invoice unknown reservation", "/admin/reservations/9/invoice.pdf", "GET", http.StatusNotFound},
+	{"show promo code", "/admin/promo-codes/1", "GET", http.StatusOK},
+	{"show promo code not found", "/admin/promo-codes/99", "GET", http.StatusNotFound},
+	{"waitlist", "/waitlist?start=2050-01-01&end=2050-01-02", "GET", http.StatusOK},
+	{"admin waitlist", "/admin/waitlist", "GET", http.StatusOK},
+	{"claim waitlist offer", "/waitlist/valid-offer", "GET", http.StatusOK},
+	{"claim waitlist offer bad token", "/waitlist/bad-token", "GET", http.StatusOK},
+	{"webhooks", "/admin/webhooks", "GET", http.StatusOK},
+	{"webhook deliveries", "/admin/webhooks/1/deliveries", "GET", http.StatusOK},
+	{"webhook deliveries not found", "/admin/webhooks/99/deliveries", "GET", http.StatusNotFound},
 
 	// {"make-res", "/make-reservation", "GET", []postData{}, http.StatusOK},
 	// {"post-search-availability", "/search-availability", "Post", []postData{
@@ -301,13 +341,11 @@ func TestRepository_PostReservation(t *testing.T) {
 		t.Errorf("PostReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
 	}
 
-	//* Test when violating InsertRoomRestriction
-	reservation.RoomID = 50
-
+	//* Test when the room is taken between the availability check and storing the reservation
 	reqBody = fmt.Sprintf("%s&%s&%s&%s",
 		"first_name=John",
 		"last_name=Smith",
-		"email=John@test.com",
+		"email=slow@guest.com",
 		"phone=1234567890",
 	)
 
@@ -324,8 +362,11 @@ func TestRepository_PostReservation(t *testing.T) {
 	handler = http.HandlerFunc(Repo.PostReservation)
 
 	handler.ServeHTTP(rr, req)
-	if rr.Code != http.StatusTemporaryRedirect {
-		t.Errorf("PostReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusTemporaryRedirect)
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("PostReservation handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/search-availability" {
+		t.Errorf("PostReservation redirected to %q, wanted /search-availability", loc)
 	}
 }
 
@@ -360,6 +401,2029 @@ func TestRepository_AvailabilityJSON(t *testing.T) {
 	}
 }
 
+func TestRepository_RoomCalendarFeed(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/ical/valid-token.ics", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("token", "valid-token")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.RoomCalendarFeed)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("RoomCalendarFeed handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+		t.Errorf("RoomCalendarFeed returned wrong content type %s", rr.Header().Get("Content-Type"))
+	}
+
+	if !strings.Contains(rr.Body.String(), "DTSTART;VALUE=DATE:20500101") {
+		t.Error("RoomCalendarFeed did not export the room restriction")
+	}
+}
+
+func TestRepository_AdminRotateCalendarFeed(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/admin/calendar-feeds/1/rotate", nil)
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminRotateCalendarFeed)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminRotateCalendarFeed handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+}
+
+func TestRepository_AdminPostExternalCalendar(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("room_id", "1")
+	postedData.Add("name", "Booking site")
+	postedData.Add("url", "https://example.com/room.ics")
+
+	req, _ := http.NewRequest("POST", "/admin/external-calendars", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminPostExternalCalendar)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("AdminPostExternalCalendar handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusSeeOther)
+	}
+
+	// invalid url is shown back on the form
+	postedData.Set("url", "not a url")
+
+	req, _ = http.NewRequest("POST", "/admin/external-calendars", strings.NewReader(postedData.Encode()))
+	ctx = getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("AdminPostExternalCalendar handler returned wrong response code: got %d, wanted %d", rr.Code, http.StatusOK)
+	}
+
+	if !strings.Contains(rr.Body.String(), "Invalid URL") {
+		t.Error("AdminPostExternalCalendar did not show the url error")
+	}
+}
+
+func TestRepository_AdminPostAPIToken(t *testing.T) {
+	var tests = []struct {
+		name               string
+		tokenName          string
+		scope              string
+		expectedStatusCode int
+	}{
+		{"valid", "Housekeeping", "read", http.StatusSeeOther},
+		{"invalid scope", "Housekeeping", "admin", http.StatusOK},
+		{"missing name", "", "write", http.StatusOK},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("name", e.tokenName)
+		postedData.Add("scope", e.scope)
+		postedData.Add("rate_limit", "60")
+
+		req, _ := http.NewRequest("POST", "/admin/api-tokens", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostAPIToken)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedStatusCode == http.StatusSeeOther {
+			token := session.GetString(ctx, "new_api_token")
+			if !strings.HasPrefix(token, "bk_") {
+				t.Errorf("for %s expected the new token in the session but got %q", e.name, token)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostWebhook(t *testing.T) {
+	var tests = []struct {
+		name               string
+		url                string
+		events             []string
+		expectedStatusCode int
+	}{
+		{"valid", "https://example.com/hook", []string{"reservation.created", "block.created"}, http.StatusSeeOther},
+		{"no events", "https://example.com/hook", nil, http.StatusOK},
+		{"invalid url", "not a url", []string{"reservation.created"}, http.StatusOK},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("url", e.url)
+		for _, ev := range e.events {
+			postedData.Add("event_"+ev, "1")
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/webhooks", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostWebhook)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedStatusCode == http.StatusSeeOther {
+			secret := session.GetString(ctx, "new_webhook_secret")
+			if !strings.HasPrefix(secret, "whsec_") {
+				t.Errorf("for %s expected the new secret in the session but got %q", e.name, secret)
+			}
+		}
+	}
+}
+
+func TestRepository_FireEventQueueFull(t *testing.T) {
+	full := make(chan models.WebhookEvent, 1)
+	full <- models.WebhookEvent{Event: "block.created"}
+
+	repo := NewTestRepo(&config.AppConfig{EventChan: full, ErrorLog: app.ErrorLog})
+
+	done := make(chan struct{})
+	go func() {
+		repo.fireEvent("reservation.created", nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("firing an event waited for room in the queue")
+	}
+
+	if len(full) != 1 {
+		t.Errorf("expected the queued event to be left alone but %d are queued", len(full))
+	}
+}
+
+func TestRepository_PostReservationFormToken(t *testing.T) {
+	idempotencyWait = 0
+	defer func() { idempotencyWait = 3 * time.Second }()
+
+	reservation := models.Reservation{
+		RoomID:    1,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	var tests = []struct {
+		name               string
+		token              string
+		inSession          bool
+		expectedStatusCode int
+		expectedLocation   string
+		expectedID         int
+	}{
+		{"new token", "new-token", true, http.StatusSeeOther, "/reservation-summary", 0},
+		{"resubmitted", "already-used", true, http.StatusSeeOther, "/reservation-summary", 1},
+		{"resubmitted after summary", "already-used", false, http.StatusSeeOther, "/reservation-summary", 1},
+		{"still pending", "still-pending", true, http.StatusSeeOther, "/", 0},
+		{"lookup error", "lookup-error", true, http.StatusTemporaryRedirect, "/", 0},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+		postedData.Add("form_token", e.token)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		if e.inSession {
+			session.Put(ctx, "reservation", reservation)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if loc, _ := rr.Result().Location(); loc == nil || loc.String() != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+		}
+
+		if e.expectedID > 0 {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.ID != e.expectedID {
+				t.Errorf("for %s expected the original reservation %d in the session but got %d", e.name, e.expectedID, res.ID)
+			}
+		}
+	}
+}
+
+func TestRepository_ChooseRoomPlacesHold(t *testing.T) {
+	app.HoldDuration = 15 * time.Minute
+	defer func() { app.HoldDuration = 0 }()
+
+	reservation := models.Reservation{
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	var tests = []struct {
+		name         string
+		roomId       string
+		expectedHold int
+	}{
+		{"available room", "1", 1},
+		{"unavailable room", "2", 0},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/choose-room/"+e.roomId, nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		chiCtx := chi.NewRouteContext()
+		chiCtx.URLParams.Add("id", e.roomId)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+
+		session.Put(ctx, "reservation", reservation)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ChooseRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("for %s expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		if got := session.GetInt(ctx, "hold_id"); got != e.expectedHold {
+			t.Errorf("for %s expected hold %d but got %d", e.name, e.expectedHold, got)
+		}
+
+		if e.expectedHold > 0 && session.GetInt(ctx, "hold_expires_at") <= int(time.Now().Unix()) {
+			t.Errorf("for %s expected the hold to expire in the future", e.name)
+		}
+	}
+}
+
+func TestRepository_PostReservationWithHold(t *testing.T) {
+	var tests = []struct {
+		name               string
+		roomId             int
+		holdId             int
+		expiresIn          time.Duration
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"live hold", 1, 1, time.Minute, http.StatusSeeOther, "/reservation-summary"},
+		{"live hold on a room only the guest holds", 2, 1, time.Minute, http.StatusSeeOther, "/reservation-summary"},
+		{"live hold, room taken anyway", 2, 3, time.Minute, http.StatusSeeOther, "/search-availability"},
+		{"expired hold, room still free", 1, 2, -time.Minute, http.StatusSeeOther, "/reservation-summary"},
+		{"expired hold, room taken", 2, 2, -time.Minute, http.StatusSeeOther, "/search-availability"},
+		{"no hold, room still free", 1, 0, 0, http.StatusSeeOther, "/reservation-summary"},
+		{"no hold, room taken", 2, 0, 0, http.StatusSeeOther, "/search-availability"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    e.roomId,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		})
+		session.Put(ctx, "hold_id", e.holdId)
+		session.Put(ctx, "hold_expires_at", int(time.Now().Add(e.expiresIn).Unix()))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if loc, _ := rr.Result().Location(); loc == nil || loc.String() != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+		}
+
+		if session.GetInt(ctx, "hold_id") != 0 {
+			t.Errorf("for %s expected the hold to be cleared from the session", e.name)
+		}
+	}
+}
+
+func TestRepository_PostReservationOccupancy(t *testing.T) {
+	var tests = []struct {
+		name               string
+		adults             string
+		children           string
+		expectedStatusCode int
+	}{
+		{"fits the room", "2", "0", http.StatusSeeOther},
+		{"too many guests", "2", "1", http.StatusSeeOther},
+		{"no adults", "0", "1", http.StatusSeeOther},
+		{"bad children", "1", "x", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+		postedData.Add("adults", e.adults)
+		postedData.Add("children", e.children)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters", MaxOccupancy: 2},
+		})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		// a booking redirects to the summary; a rejected party re-renders the form
+		loc, _ := rr.Result().Location()
+		if e.name == "fits the room" {
+			if loc == nil || loc.String() != "/reservation-summary" {
+				t.Errorf("for %s expected redirect to /reservation-summary but got %v", e.name, loc)
+			}
+		} else if loc != nil {
+			t.Errorf("for %s expected the form to be shown again but got redirect to %s", e.name, loc)
+		}
+	}
+}
+
+func TestRepository_AdminPostStayRule(t *testing.T) {
+	var tests = []struct {
+		name               string
+		data               map[string]string
+		expectedStatusCode int
+	}{
+		{"valid", map[string]string{"room_id": "1", "start_date": "2050-07-01", "end_date": "2050-07-31", "min_nights": "3"}, http.StatusSeeOther},
+		{"single day", map[string]string{"room_id": "1", "start_date": "2050-07-04", "end_date": "2050-07-04", "closed_to_arrival": "1"}, http.StatusSeeOther},
+		{"no restriction", map[string]string{"room_id": "1", "start_date": "2050-07-01", "end_date": "2050-07-31"}, http.StatusOK},
+		{"dates reversed", map[string]string{"room_id": "1", "start_date": "2050-07-31", "end_date": "2050-07-01", "min_nights": "3"}, http.StatusOK},
+		{"max below min", map[string]string{"room_id": "1", "start_date": "2050-07-01", "end_date": "2050-07-31", "min_nights": "5", "max_nights": "2"}, http.StatusOK},
+		{"negative nights", map[string]string{"room_id": "1", "start_date": "2050-07-01", "end_date": "2050-07-31", "min_nights": "-1"}, http.StatusOK},
+		{"insert fails", map[string]string{"room_id": "3", "start_date": "2050-07-01", "end_date": "2050-07-31", "min_nights": "3"}, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for k, v := range e.data {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/stay-rules", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostStayRule)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostAvailabilityStayRules(t *testing.T) {
+	var tests = []struct {
+		name               string
+		start              string
+		end                string
+		expectedStatusCode int
+		expectedError      string
+	}{
+		{"one room allowed", "2060-01-10", "2060-01-11", http.StatusOK, ""},
+		{"no room allowed", "2060-01-01", "2060-01-02", http.StatusSeeOther, "Minimum stay is 3 nights for arrivals on 2060-01-01"},
+		{"long enough", "2060-01-10", "2060-01-13", http.StatusOK, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start", e.start)
+		postedData.Add("end", e.end)
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.ParseForm()
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostAvailability)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if msg := session.GetString(ctx, "error"); !strings.Contains(msg, e.expectedError) {
+			t.Errorf("for %s expected error containing %q but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestRepository_PostAvailabilityToday(t *testing.T) {
+	// today is the date where the property is, whatever the server's timezone
+	today := clock.Today(app.Timezone)
+
+	var tests = []struct {
+		name               string
+		start              time.Time
+		expectedStatusCode int
+		expectedError      string
+	}{
+		{"yesterday", today.AddDate(0, 0, -1), http.StatusSeeOther, "You can't arrive before today"},
+		{"today", today, http.StatusSeeOther, "No availability"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("start", e.start.Format("2006-01-02"))
+		postedData.Add("end", e.start.AddDate(0, 0, 1).Format("2006-01-02"))
+
+		req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.ParseForm()
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostAvailability)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if msg := session.GetString(ctx, "error"); msg != e.expectedError {
+			t.Errorf("for %s expected error %q but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+func TestRepository_PostReservationStayRules(t *testing.T) {
+	var tests = []struct {
+		name               string
+		start              time.Time
+		end                time.Time
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"allowed", time.Date(2060, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2060, 1, 13, 0, 0, 0, 0, time.UTC), http.StatusSeeOther, "/reservation-summary"},
+		{"too short", time.Date(2060, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2060, 1, 11, 0, 0, 0, 0, time.UTC), http.StatusSeeOther, "/search-availability"},
+		{"rules unavailable", time.Date(2070, 1, 10, 0, 0, 0, 0, time.UTC), time.Date(2070, 1, 11, 0, 0, 0, 0, time.UTC), http.StatusTemporaryRedirect, "/"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    1,
+			StartDate: e.start,
+			EndDate:   e.end,
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+		})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if loc, _ := rr.Result().Location(); loc == nil || loc.String() != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+		}
+	}
+}
+
+func TestRepository_ChooseRooms(t *testing.T) {
+	var tests = []struct {
+		name               string
+		roomIds            []string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"several rooms", []string{"1", "2"}, http.StatusSeeOther, "/make-booking"},
+		{"one room", []string{"2"}, http.StatusSeeOther, "/choose-room/2"},
+		{"same room twice", []string{"1", "1"}, http.StatusSeeOther, "/choose-room/1"},
+		{"no rooms", nil, http.StatusSeeOther, "/search-availability"},
+		{"bad room", []string{"1", "x"}, http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for _, id := range e.roomIds {
+			postedData.Add("room_id", id)
+		}
+
+		req, _ := http.NewRequest("POST", "/choose-rooms", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			StartDate: time.Date(2060, 1, 10, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2060, 1, 13, 0, 0, 0, 0, time.UTC),
+		})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ChooseRooms)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			if loc, _ := rr.Result().Location(); loc == nil || loc.String() != e.expectedLocation {
+				t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+			}
+		}
+	}
+}
+
+func TestRepository_PostMakeBooking(t *testing.T) {
+	var tests = []struct {
+		name               string
+		year               int
+		adults             string
+		children           string
+		paymentToken       string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"valid", 2060, "2", "3", "tok_visa", http.StatusSeeOther, "/booking-summary"},
+		{"room taken", 2050, "2", "0", "tok_visa", http.StatusSeeOther, "/search-availability"},
+		{"too many guests", 2060, "4", "3", "tok_visa", http.StatusSeeOther, ""},
+		{"adult missing from a room", 2060, "1", "2", "tok_visa", http.StatusSeeOther, ""},
+		{"no card for the deposits", 2060, "2", "3", "", http.StatusSeeOther, ""},
+		{"card declined", 2060, "2", "3", payments.DeclineToken, http.StatusSeeOther, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+		postedData.Add("adults", e.adults)
+		postedData.Add("children", e.children)
+		postedData.Add("payment_token", e.paymentToken)
+
+		req, _ := http.NewRequest("POST", "/make-booking", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		// 2060-01-10 is outside the test stay rules for room 2, and three nights satisfies room 1
+		session.Put(ctx, "reservation", models.Reservation{
+			StartDate: time.Date(e.year, 1, 10, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(e.year, 1, 13, 0, 0, 0, 0, time.UTC),
+		})
+		session.Put(ctx, "booking_rooms", []int{1, 2})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostMakeBooking)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		loc, _ := rr.Result().Location()
+		if e.expectedLocation == "" {
+			if loc != nil {
+				t.Errorf("for %s expected the form to be shown again but got redirect to %s", e.name, loc)
+			}
+			continue
+		}
+		if loc == nil || loc.String() != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+		}
+
+		if e.expectedLocation == "/booking-summary" {
+			booking, ok := session.Get(ctx, "booking").(models.Booking)
+			if !ok || len(booking.ConfirmationCode) != confirmationCodeLength || len(booking.Reservations) != 2 {
+				t.Errorf("for %s expected the booking with a confirmation code in the session but got %+v", e.name, booking)
+			}
+		}
+	}
+}
+
+func TestSplitParty(t *testing.T) {
+	rooms := []models.Room{{ID: 1, MaxOccupancy: 2}, {ID: 2, MaxOccupancy: 4}}
+
+	var tests = []struct {
+		name     string
+		adults   int
+		children int
+		expected [][2]int
+		valid    bool
+	}{
+		{"one adult each", 2, 0, [][2]int{{1, 0}, {1, 0}}, true},
+		{"fills in order", 3, 3, [][2]int{{2, 0}, {1, 3}}, true},
+		{"children with adults", 2, 4, [][2]int{{1, 1}, {1, 3}}, true},
+		{"too many", 3, 4, nil, false},
+		{"not enough adults", 1, 1, nil, false},
+	}
+
+	for _, e := range tests {
+		form := forms.New(url.Values{})
+		lines := splitParty(form, rooms, e.adults, e.children)
+
+		if form.Valid() != e.valid {
+			t.Errorf("for %s expected valid to be %v but got errors %v", e.name, e.valid, form.Errors)
+			continue
+		}
+		if e.valid && !reflect.DeepEqual(lines, e.expected) {
+			t.Errorf("for %s expected %v but got %v", e.name, e.expected, lines)
+		}
+	}
+}
+
+func TestRepository_AdminDeleteReservation(t *testing.T) {
+	var tests = []struct {
+		name          string
+		id            string
+		expectedError string
+	}{
+		{"deleted", "2", ""},
+		{"invoiced", "1", "This reservation has an invoice, so it can't be deleted. Cancel it instead."},
+		{"delete fails", "4", "Can't delete the reservation"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/delete-reservation/new/x/do", nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "new")
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminDeleteReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("for %s expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if got := app.Session.GetString(ctx, "error"); got != e.expectedError {
+			t.Errorf("for %s expected error %q but got %q", e.name, e.expectedError, got)
+		}
+	}
+}
+
+func TestRepository_AdminCancelReservation(t *testing.T) {
+	var tests = []struct {
+		name          string
+		id            string
+		expectedFlash string
+		expectedError string
+	}{
+		{"cancelled", "1", "Reservation cancelled", ""},
+		{"cancelled meanwhile", "2", "", "This reservation was already cancelled"},
+		{"unknown reservation", "3", "", "Can't cancel the reservation"},
+		{"bad id", "x", "", "Can't cancel the reservation"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/admin/cancel-reservation/new/x/do", nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "new")
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminCancelReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("for %s expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if got := app.Session.GetString(ctx, "flash"); got != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, got)
+		}
+		if got := app.Session.GetString(ctx, "error"); got != e.expectedError {
+			t.Errorf("for %s expected error %q but got %q", e.name, e.expectedError, got)
+		}
+	}
+}
+
+func TestRepository_AdminCancelBookingRoom(t *testing.T) {
+	var tests = []struct {
+		name               string
+		bookingId          string
+		reservationId      string
+		expectedStatusCode int
+	}{
+		{"active room", "1", "1", http.StatusSeeOther},
+		{"room cancelled meanwhile", "1", "2", http.StatusSeeOther},
+		{"room already cancelled", "2", "2", http.StatusNotFound},
+		{"room of another booking", "1", "5", http.StatusNotFound},
+		{"unknown booking", "9", "1", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/bookings/x/rooms/y/cancel", nil)
+		ctx := getCtx(req)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.bookingId)
+		rctx.URLParams.Add("reservation_id", e.reservationId)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminCancelBookingRoom)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostWaitlist(t *testing.T) {
+	var tests = []struct {
+		name               string
+		data               map[string]string
+		expectedStatusCode int
+	}{
+		{"valid", map[string]string{"name": "John", "email": "john@smith.com", "start": "2050-01-01", "end": "2050-01-02"}, http.StatusSeeOther},
+		{"specific room", map[string]string{"name": "John", "email": "john@smith.com", "start": "2050-01-01", "end": "2050-01-02", "room_id": "1", "adults": "2"}, http.StatusSeeOther},
+		{"missing name", map[string]string{"email": "john@smith.com", "start": "2050-01-01", "end": "2050-01-02"}, http.StatusSeeOther},
+		{"bad email", map[string]string{"name": "John", "email": "john", "start": "2050-01-01", "end": "2050-01-02"}, http.StatusSeeOther},
+		{"dates reversed", map[string]string{"name": "John", "email": "john@smith.com", "start": "2050-01-02", "end": "2050-01-01"}, http.StatusSeeOther},
+		{"in the past", map[string]string{"name": "John", "email": "john@smith.com", "start": "2000-01-01", "end": "2000-01-02"}, http.StatusSeeOther},
+		{"insert fails", map[string]string{"name": "John", "email": "john@smith.com", "start": "2050-01-01", "end": "2050-01-02", "room_id": "3"}, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for k, v := range e.data {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/waitlist", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostWaitlist)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_ClaimWaitlistOffer(t *testing.T) {
+	var tests = []struct {
+		name             string
+		token            string
+		expectedLocation string
+	}{
+		{"valid offer", "valid-offer", "/make-reservation"},
+		{"room taken again", "taken-offer", "/search-availability"},
+		{"expired offer", "expired-offer", "/search-availability"},
+		{"unknown token", "bad-token", "/search-availability"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/waitlist/"+e.token, nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ClaimWaitlistOffer)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("for %s expected %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		if loc, _ := rr.Result().Location(); loc == nil || loc.String() != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+		}
+
+		_, ok := session.Get(ctx, "reservation").(models.Reservation)
+		if ok != (e.expectedLocation == "/make-reservation") {
+			t.Errorf("for %s expected reservation in session to be %v", e.name, !ok)
+		}
+
+		// the offer is only used up when the reservation is made
+		if got := session.GetInt(ctx, "waitlist_entry_id"); (got == 1) != ok {
+			t.Errorf("for %s got waitlist entry %d in the session", e.name, got)
+		}
+	}
+}
+
+func TestRepository_PostReservationClaimsWaitlistOffer(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("first_name", "John")
+	postedData.Add("last_name", "Smith")
+	postedData.Add("email", "john@smith.com")
+	postedData.Add("phone", "1234567890")
+
+	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	session.Put(ctx, "reservation", models.Reservation{
+		RoomID:    1,
+		StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+	})
+	session.Put(ctx, "waitlist_entry_id", 1)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostReservation)
+	handler.ServeHTTP(rr, req)
+
+	if loc, _ := rr.Result().Location(); loc == nil || loc.String() != "/reservation-summary" {
+		t.Errorf("expected redirect to /reservation-summary but got %v", loc)
+	}
+	if session.Exists(ctx, "waitlist_entry_id") {
+		t.Error("expected the waitlist offer to be claimed with the reservation")
+	}
+}
+
+func TestRepository_PostAvailabilityWaitlist(t *testing.T) {
+	postedData := url.Values{}
+	postedData.Add("start", "2050-01-01")
+	postedData.Add("end", "2050-01-02")
+	postedData.Add("adults", "2")
+
+	req, _ := http.NewRequest("POST", "/search-availability", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.ParseForm()
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.PostAvailability)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther {
+		t.Errorf("expected %d but got %d", http.StatusSeeOther, rr.Code)
+	}
+
+	expected := "/waitlist?adults=2&children=0&end=2050-01-02&start=2050-01-01"
+	if loc, _ := rr.Result().Location(); loc == nil || loc.String() != expected {
+		t.Errorf("expected redirect to %s but got %v", expected, loc)
+	}
+}
+
+func TestRepository_ReofferExpiredWaitlistOffers(t *testing.T) {
+	mailChan := app.MailChan
+	defer func() { app.MailChan = mailChan }()
+	app.MailChan = make(chan models.MailData, 10)
+
+	// room 1's expired offer goes to the first waiting guest who fits in it
+	Repo.ReofferExpiredWaitlistOffers()
+
+	if len(app.MailChan) != 1 {
+		t.Fatalf("expected one offer but got %d", len(app.MailChan))
+	}
+
+	msg := <-app.MailChan
+	if msg.To != "john@smith.com" {
+		t.Errorf("expected the offer to go to john@smith.com but got %s", msg.To)
+	}
+	if !strings.Contains(msg.Content, app.BaseURL+"/waitlist/") {
+		t.Errorf("expected a booking link on %s but got %s", app.BaseURL, msg.Content)
+	}
+}
+
+func TestRepository_PostReservationPromoCode(t *testing.T) {
+	var tests = []struct {
+		name               string
+		code               string
+		email              string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedDiscount   int
+	}{
+		{"no code", "", "john@smith.com", http.StatusSeeOther, "/reservation-summary", 0},
+		{"percentage", "save10", "john@smith.com", http.StatusSeeOther, "/reservation-summary", 3000},
+		{"fixed amount", " TAKE25 ", "john@smith.com", http.StatusSeeOther, "/reservation-summary", 2500},
+		{"unknown code", "NOPE", "john@smith.com", http.StatusSeeOther, "", 0},
+		{"used up", "USEDUP", "john@smith.com", http.StatusSeeOther, "", 0},
+		{"first use by guest", "ONCE", "john@smith.com", http.StatusSeeOther, "/reservation-summary", 3000},
+		{"used by guest", "ONCE", "repeat@guest.com", http.StatusSeeOther, "", 0},
+		{"used up while booking", "save10", "late@guest.com", http.StatusSeeOther, "", 0},
+		{"lookup fails", "BROKEN", "john@smith.com", http.StatusTemporaryRedirect, "/", 0},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", e.email)
+		postedData.Add("phone", "1234567890")
+		postedData.Add("promo_code", e.code)
+		postedData.Add("payment_token", "tok_visa")
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters", MaxOccupancy: 2, NightlyRate: 10000},
+		})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		loc, _ := rr.Result().Location()
+		if e.expectedLocation == "" && loc != nil {
+			t.Errorf("for %s expected the form to be shown again but was redirected to %v", e.name, loc)
+		}
+		if e.expectedLocation != "" && (loc == nil || loc.String() != e.expectedLocation) {
+			t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+		}
+
+		if e.expectedLocation == "/reservation-summary" {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.Subtotal != 30000 || res.Discount != e.expectedDiscount {
+				t.Errorf("for %s expected 30000 less %d but got %d less %d", e.name, e.expectedDiscount, res.Subtotal, res.Discount)
+			}
+		}
+	}
+}
+
+func TestRepository_PostReservationTaxes(t *testing.T) {
+	var tests = []struct {
+		name          string
+		roomId        int
+		year          int
+		expectedTaxes int
+		expectedLines int
+	}{
+		{"included gst only", 1, 2050, 0, 1},
+		{"cleaning fee not yet charged", 2, 2050, 0, 1},
+		{"cleaning fee", 2, 2055, 4000, 2},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", "John")
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+		postedData.Add("payment_token", "tok_visa")
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    e.roomId,
+			StartDate: time.Date(e.year, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(e.year, 1, 3, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{ID: e.roomId, MaxOccupancy: 2, NightlyRate: 11000},
+		})
+		// room 2 is taken in the test repository, so it is booked from a live hold
+		session.Put(ctx, "hold_id", 1)
+		session.Put(ctx, "hold_expires_at", int(time.Now().Add(time.Minute).Unix()))
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if loc, _ := rr.Result().Location(); loc == nil || loc.String() != "/reservation-summary" {
+			t.Errorf("for %s expected redirect to /reservation-summary but got %v", e.name, loc)
+			continue
+		}
+
+		res, _ := session.Get(ctx, "reservation").(models.Reservation)
+		if res.Taxes != e.expectedTaxes || len(res.TaxLines) != e.expectedLines {
+			t.Errorf("for %s expected %d in %d lines but got %d in %d lines", e.name, e.expectedTaxes, e.expectedLines, res.Taxes, len(res.TaxLines))
+		}
+
+		if res.TaxLines[0].Name != "GST" || res.TaxLines[0].Amount != 2000 {
+			t.Errorf("for %s expected $20 of GST included but got %v", e.name, res.TaxLines[0])
+		}
+
+		if res.Total() != 22000+e.expectedTaxes {
+			t.Errorf("for %s expected a total of %d but got %d", e.name, 22000+e.expectedTaxes, res.Total())
+		}
+	}
+}
+
+func TestRepository_PostReservationDeposit(t *testing.T) {
+	var tests = []struct {
+		name               string
+		token              string
+		firstName          string
+		expectedStatusCode int
+		expectedLocation   string
+		expectedDeposit    int
+	}{
+		{"card accepted", "tok_visa", "John", http.StatusSeeOther, "/reservation-summary", 10000},
+		{"card declined", payments.DeclineToken, "John", http.StatusSeeOther, "", 0},
+		{"no card", "", "John", http.StatusSeeOther, "", 0},
+		{"insert fails after authorizing", "tok_visa", "Invalid", http.StatusTemporaryRedirect, "/", 0},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", e.firstName)
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+		postedData.Add("payment_token", e.token)
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters", MaxOccupancy: 2, NightlyRate: 10000},
+		})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		loc, _ := rr.Result().Location()
+		if e.expectedLocation == "" && loc != nil {
+			t.Errorf("for %s expected the form to be shown again but was redirected to %v", e.name, loc)
+		}
+		if e.expectedLocation != "" && (loc == nil || loc.String() != e.expectedLocation) {
+			t.Errorf("for %s expected redirect to %s but got %v", e.name, e.expectedLocation, loc)
+		}
+
+		if deposit := session.GetInt(ctx, "deposit"); deposit != e.expectedDeposit {
+			t.Errorf("for %s expected a deposit of %d but got %d", e.name, e.expectedDeposit, deposit)
+		}
+	}
+}
+
+func TestRepository_AdminPostPayment(t *testing.T) {
+	var tests = []struct {
+		name               string
+		action             string
+		paymentId          string
+		amount             string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"void authorized", "void", "1", "", http.StatusSeeOther, "Payment voided"},
+		{"void captured", "void", "2", "", http.StatusSeeOther, ""},
+		{"capture voided", "capture", "3", "", http.StatusSeeOther, ""},
+		{"refund authorized", "refund", "1", "", http.StatusSeeOther, ""},
+		{"refund part", "refund", "2", "25", http.StatusSeeOther, "Payment refunded"},
+		{"refund too much", "refund", "2", "80", http.StatusSeeOther, ""},
+		{"refund bad amount", "refund", "2", "ten", http.StatusSeeOther, ""},
+		{"capture voided at provider", "capture", "1", "", http.StatusSeeOther, ""},
+		{"unknown payment", "capture", "9", "", http.StatusNotFound, ""},
+		{"bad id", "void", "x", "", http.StatusBadRequest, ""},
+	}
+
+	// payments 1 and 2 are the fake provider's first two authorizations, and 2 was captured
+	provider := payments.NewFake()
+	provider.Authorize("tok_visa", 10000, "deposit")
+	ref, _ := provider.Authorize("tok_visa", 10000, "deposit")
+	if err := provider.Capture(ref, 10000); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p payments.Provider) { app.Payments = p }(app.Payments)
+	app.Payments = provider
+
+	handlers := map[string]http.HandlerFunc{
+		"capture": Repo.AdminPostPaymentCapture,
+		"void":    Repo.AdminPostPaymentVoid,
+		"refund":  Repo.AdminPostPaymentRefund,
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("amount", e.amount)
+
+		req, _ := http.NewRequest("POST", "/admin/payments/"+e.paymentId+"/"+e.action, strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.paymentId)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handlers[e.action].ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_settleCancellation(t *testing.T) {
+	// reservation 1 has payment 2, the provider's second authorization: 100.00 captured with
+	// 25.00 already refunded
+	provider := payments.NewFake()
+	provider.Authorize("tok_visa", 10000, "deposit")
+	ref, _ := provider.Authorize("tok_visa", 10000, "deposit")
+	if err := provider.Capture(ref, 10000); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Refund(ref, 2500); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p payments.Provider) { app.Payments = p }(app.Payments)
+	app.Payments = provider
+
+	penalty, refund, err := Repo.cancellationCharges(models.Reservation{ID: 1, Subtotal: 30000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// without a policy nothing is kept, and only what was paid comes back
+	if penalty != 0 || refund != 7500 {
+		t.Fatalf("expected no penalty and a refund of 7500 but got %d and %d", penalty, refund)
+	}
+
+	Repo.settleCancellation(1, 5000)
+
+	// 50.00 was refunded through the provider, leaving 25.00 of the payment
+	if err := provider.Refund(ref, 2501); err == nil {
+		t.Error("expected the cancellation refund to have been paid through the provider")
+	}
+	if err := provider.Refund(ref, 2500); err != nil {
+		t.Errorf("expected 25.00 left to refund but got %s", err)
+	}
+}
+
+func TestRepository_cancellationTerms(t *testing.T) {
+	var tests = []struct {
+		id       int
+		locale   string
+		expected string
+	}{
+		{1, "en", "Free cancellation until 7 days before arrival, then 50% of the price is charged."},
+		{1, "de", "Kostenlose Stornierung bis 7 Tage vor der Anreise, danach wird 50% des Preises berechnet."},
+		{2, "fr", "Non remboursable : l'annulation coûte le prix total."},
+	}
+
+	for _, e := range tests {
+		got, err := Repo.cancellationTerms(e.id, e.locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != e.expected {
+			t.Errorf("for policy %d in %s expected %q but got %q", e.id, e.locale, e.expected, got)
+		}
+	}
+
+	reasons := []i18n.Message{i18n.M("No arrivals on %s", time.Date(2050, 7, 5, 0, 0, 0, 0, time.UTC))}
+	if got := stayRulesMessage("", reasons, "de"); got != "Das Zimmer kann für diese Daten nicht gebucht werden: Keine Anreise am 05.07.2050" {
+		t.Errorf("expected the stay rules in German but got %q", got)
+	}
+}
+
+func TestRepository_AdminPostFolio(t *testing.T) {
+	var tests = []struct {
+		name               string
+		action             string
+		reservationId      string
+		data               map[string]string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"charge", "charges", "1", map[string]string{"description": "Breakfast", "amount": "20"}, http.StatusSeeOther, "Charge posted"},
+		{"charge with tax", "charges", "1", map[string]string{"description": "Parking", "amount": "15.50", "tax": "1.55"}, http.StatusSeeOther, "Charge posted"},
+		{"charge without amount", "charges", "1", map[string]string{"description": "Breakfast"}, http.StatusSeeOther, ""},
+		{"charge with bad tax", "charges", "1", map[string]string{"description": "Breakfast", "amount": "20", "tax": "-2"}, http.StatusSeeOther, ""},
+		{"payment", "payments", "1", map[string]string{"kind": "payment", "description": "Cash", "amount": "50"}, http.StatusSeeOther, "Payment posted"},
+		{"refund", "payments", "1", map[string]string{"kind": "refund", "description": "Bank transfer", "amount": "5"}, http.StatusSeeOther, "Refund posted"},
+		{"unknown kind", "payments", "1", map[string]string{"kind": "gift", "description": "Cash", "amount": "50"}, http.StatusSeeOther, ""},
+		{"post fails", "payments", "2", map[string]string{"kind": "payment", "description": "Cash", "amount": "50"}, http.StatusInternalServerError, ""},
+		{"unknown reservation", "charges", "9", map[string]string{"description": "Breakfast", "amount": "20"}, http.StatusNotFound, ""},
+		{"bad id", "charges", "x", map[string]string{"description": "Breakfast", "amount": "20"}, http.StatusBadRequest, ""},
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"charges":  Repo.AdminPostFolioCharge,
+		"payments": Repo.AdminPostFolioPayment,
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for k, v := range e.data {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/reservations/"+e.reservationId+"/folio/"+e.action, strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.reservationId)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handlers[e.action].ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_AdminReservationInvoice(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/admin/reservations/1/invoice.pdf", nil)
+	ctx := getCtx(req)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "1")
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.AdminReservationInvoice)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("expected a PDF but got %s", rr.Header().Get("Content-Type"))
+	}
+
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), "INV-000042.pdf") {
+		t.Errorf("expected the invoice number in the file name but got %s", rr.Header().Get("Content-Disposition"))
+	}
+
+	if !strings.HasPrefix(rr.Body.String(), "%PDF-") {
+		t.Error("expected the body to be a PDF document")
+	}
+}
+
+func TestRepository_AdminPostCheckoutEmail(t *testing.T) {
+	var tests = []struct {
+		name               string
+		reservationId      string
+		attach             string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"with invoice", "1", "1", http.StatusSeeOther, "Checkout email sent"},
+		{"without invoice", "2", "", http.StatusSeeOther, "Checkout email sent"},
+		{"invoice numbering fails", "2", "1", http.StatusInternalServerError, ""},
+		{"unknown reservation", "9", "1", http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("attach_invoice", e.attach)
+
+		req, _ := http.NewRequest("POST", "/admin/reservations/"+e.reservationId+"/checkout-email", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.reservationId)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostCheckoutEmail)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_AdminPostPromoCode(t *testing.T) {
+	var tests = []struct {
+		name               string
+		data               map[string]string
+		expectedStatusCode int
+	}{
+		{"percentage", map[string]string{"code": "spring", "discount_type": "percent", "amount": "15"}, http.StatusSeeOther},
+		{"fixed amount with limits", map[string]string{"code": "WELCOME", "discount_type": "fixed", "amount": "25.50", "room_id": "1",
+			"valid_from": "2050-01-01", "valid_to": "2050-03-31", "stay_from": "2050-04-01", "stay_to": "2050-06-30",
+			"max_uses": "50", "max_uses_per_guest": "1"}, http.StatusSeeOther},
+		{"missing code", map[string]string{"discount_type": "percent", "amount": "15"}, http.StatusOK},
+		{"code in use", map[string]string{"code": "save10", "discount_type": "percent", "amount": "15"}, http.StatusOK},
+		{"percentage too high", map[string]string{"code": "SPRING", "discount_type": "percent", "amount": "150"}, http.StatusOK},
+		{"bad amount", map[string]string{"code": "SPRING", "discount_type": "fixed", "amount": "25.505"}, http.StatusOK},
+		{"unknown type", map[string]string{"code": "SPRING", "discount_type": "free", "amount": "15"}, http.StatusOK},
+		{"valid dates reversed", map[string]string{"code": "SPRING", "discount_type": "percent", "amount": "15",
+			"valid_from": "2050-03-31", "valid_to": "2050-01-01"}, http.StatusOK},
+		{"stay dates reversed", map[string]string{"code": "SPRING", "discount_type": "percent", "amount": "15",
+			"stay_from": "2050-06-30", "stay_to": "2050-04-01"}, http.StatusOK},
+		{"negative uses", map[string]string{"code": "SPRING", "discount_type": "percent", "amount": "15", "max_uses": "-1"}, http.StatusOK},
+		{"insert fails", map[string]string{"code": "SPRING", "discount_type": "percent", "amount": "15", "room_id": "3"}, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for k, v := range e.data {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/promo-codes", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostPromoCode)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminPostTax(t *testing.T) {
+	var tests = []struct {
+		name               string
+		data               map[string]string
+		expectedStatusCode int
+	}{
+		{"percentage", map[string]string{"name": "GST", "kind": "tax", "basis": "percent", "per": "night", "amount": "10", "inclusive": "1"}, http.StatusSeeOther},
+		{"fee with limits", map[string]string{"name": "Cleaning", "kind": "fee", "basis": "flat", "per": "stay", "amount": "40", "room_id": "2",
+			"effective_from": "2050-01-01", "effective_to": "2050-12-31"}, http.StatusSeeOther},
+		{"per guest", map[string]string{"name": "City tax", "kind": "tax", "basis": "flat", "per": "guest", "amount": "2.50"}, http.StatusSeeOther},
+		{"missing name", map[string]string{"kind": "tax", "basis": "percent", "per": "night", "amount": "10"}, http.StatusOK},
+		{"unknown kind", map[string]string{"name": "GST", "kind": "levy", "basis": "percent", "per": "night", "amount": "10"}, http.StatusOK},
+		{"unknown basis", map[string]string{"name": "GST", "kind": "tax", "basis": "tiered", "per": "night", "amount": "10"}, http.StatusOK},
+		{"unknown per", map[string]string{"name": "GST", "kind": "tax", "basis": "percent", "per": "week", "amount": "10"}, http.StatusOK},
+		{"percentage per guest", map[string]string{"name": "GST", "kind": "tax", "basis": "percent", "per": "guest", "amount": "10"}, http.StatusOK},
+		{"percentage too high", map[string]string{"name": "GST", "kind": "tax", "basis": "percent", "per": "night", "amount": "100.5"}, http.StatusOK},
+		{"bad amount", map[string]string{"name": "Cleaning", "kind": "fee", "basis": "flat", "per": "stay", "amount": "forty"}, http.StatusOK},
+		{"dates reversed", map[string]string{"name": "GST", "kind": "tax", "basis": "percent", "per": "night", "amount": "10",
+			"effective_from": "2050-12-31", "effective_to": "2050-01-01"}, http.StatusOK},
+		{"insert fails", map[string]string{"name": "GST", "kind": "tax", "basis": "percent", "per": "night", "amount": "10", "room_id": "3"}, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for k, v := range e.data {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/taxes", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostTax)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminPostTaxActive(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		active             string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"deactivate", "1", "0", http.StatusSeeOther, "Tax deactivated"},
+		{"activate", "2", "1", http.StatusSeeOther, "Tax activated"},
+		{"update fails", "3", "1", http.StatusInternalServerError, ""},
+		{"bad id", "x", "1", http.StatusBadRequest, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("active", e.active)
+
+		req, _ := http.NewRequest("POST", "/admin/taxes/"+e.id+"/active", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostTaxActive)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_PostCurrency(t *testing.T) {
+	var tests = []struct {
+		name             string
+		currency         string
+		referer          string
+		expectedLocation string
+		expectedCurrency string
+	}{
+		{"euros", "EUR", "http://localhost:8080/choose-room/1?x=1", "/choose-room/1?x=1", "EUR"},
+		{"lower case", "usd", "http://localhost:8080/about", "/about", "USD"},
+		{"base currency", "AUD", "", "/", "AUD"},
+		{"no rate", "JPY", "http://localhost:8080/about", "/about", ""},
+		{"other site", "EUR", "https://example.com/phish", "/phish", "EUR"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("currency", e.currency)
+
+		req, _ := http.NewRequest("POST", "/currency", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Referer", e.referer)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostCurrency)
+		handler.ServeHTTP(rr, req)
+
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("for %s expected redirect to %s but got %s", e.name, e.expectedLocation, loc)
+		}
+
+		if c := session.GetString(ctx, "currency"); c != e.expectedCurrency {
+			t.Errorf("for %s expected currency %q but got %q", e.name, e.expectedCurrency, c)
+		}
+	}
+}
+
+func TestRepository_ReservationSummaryCurrency(t *testing.T) {
+	var tests = []struct {
+		name     string
+		currency string
+		expected []string
+	}{
+		{"base currency", "", []string{"A$220.00"}},
+		{"euros", "EUR", []string{"€132.00", "charged as A$220.00"}},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/reservation-summary", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			Subtotal:  22000,
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+		})
+		if e.currency != "" {
+			session.Put(ctx, "currency", e.currency)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.ReservationSummary)
+		handler.ServeHTTP(rr, req)
+
+		for _, s := range e.expected {
+			if !strings.Contains(rr.Body.String(), s) {
+				t.Errorf("for %s expected the summary to show %q", e.name, s)
+			}
+		}
+	}
+}
+
+func TestRepository_AdminPostExchangeRate(t *testing.T) {
+	var tests = []struct {
+		name               string
+		data               map[string]string
+		expectedStatusCode int
+	}{
+		{"rate", map[string]string{"currency": "EUR", "rate": "0.61"}, http.StatusSeeOther},
+		{"lower case", map[string]string{"currency": "jpy", "rate": "97.5"}, http.StatusSeeOther},
+		{"missing rate", map[string]string{"currency": "EUR"}, http.StatusOK},
+		{"unknown currency", map[string]string{"currency": "XYZ", "rate": "1.5"}, http.StatusOK},
+		{"base currency", map[string]string{"currency": "AUD", "rate": "1"}, http.StatusOK},
+		{"bad rate", map[string]string{"currency": "EUR", "rate": "lots"}, http.StatusOK},
+		{"negative rate", map[string]string{"currency": "EUR", "rate": "-0.61"}, http.StatusOK},
+		{"save fails", map[string]string{"currency": "GBP", "rate": "0.52"}, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for k, v := range e.data {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/currencies", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostExchangeRate)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminPostImportExchangeRates(t *testing.T) {
+	var tests = []struct {
+		name               string
+		file               string
+		expectedStatusCode int
+		expectedFlash      string
+		expectedError      bool
+	}{
+		{"rates", "currency,rate\nEUR,0.61\nUSD,0.66\n", http.StatusSeeOther, "2 exchange rates imported", false},
+		{"bad line", "EUR,0.61\nUSD,lots\n", http.StatusSeeOther, "", true},
+		{"no file", "", http.StatusSeeOther, "", true},
+		{"save fails", "GBP,0.52\n", http.StatusInternalServerError, "", false},
+	}
+
+	for _, e := range tests {
+		body := new(bytes.Buffer)
+		writer := multipart.NewWriter(body)
+		if e.file != "" {
+			part, _ := writer.CreateFormFile("rates", "rates.csv")
+			part.Write([]byte(e.file))
+		}
+		writer.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/currencies/import", body)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostImportExchangeRates)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+
+		if hasError := session.GetString(ctx, "error") != ""; hasError != e.expectedError {
+			t.Errorf("for %s expected an error to be %t", e.name, e.expectedError)
+		}
+	}
+}
+
+func TestRepository_AdminPostDeleteExchangeRate(t *testing.T) {
+	var tests = []struct {
+		name               string
+		id                 string
+		expectedStatusCode int
+	}{
+		{"delete", "1", http.StatusSeeOther},
+		{"delete fails", "3", http.StatusInternalServerError},
+		{"bad id", "x", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/currencies/"+e.id+"/delete", nil)
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.id)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostDeleteExchangeRate)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_PostReservationLocale(t *testing.T) {
+	var tests = []struct {
+		name      string
+		firstName string
+		expected  string
+	}{
+		{"missing name", "", "Dieses Feld darf nicht leer sein"},
+		{"booked", "John", ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("first_name", e.firstName)
+		postedData.Add("last_name", "Smith")
+		postedData.Add("email", "john@smith.com")
+		postedData.Add("phone", "1234567890")
+
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := i18n.WithLocale(getCtx(req), "de")
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		session.Put(ctx, "reservation", models.Reservation{
+			RoomID:    1,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+		})
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if e.expected != "" {
+			if !strings.Contains(rr.Body.String(), e.expected) {
+				t.Errorf("for %s expected the form to show %q", e.name, e.expected)
+			}
+			continue
+		}
+
+		// the reservation remembers the language, so emails to the guest are sent in it
+		res, ok := session.Get(ctx, "reservation").(models.Reservation)
+		if !ok || res.Locale != "de" {
+			t.Errorf("for %s expected the reservation to be in de but got %q", e.name, res.Locale)
+		}
+		if res.CheckInTime != "14:00" || res.CheckOutTime != "10:00" {
+			t.Errorf("for %s expected check-in at 14:00 and check-out at 10:00 but got %q and %q", e.name, res.CheckInTime, res.CheckOutTime)
+		}
+	}
+}
+
+func TestRepository_ReservationSummaryLocale(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/reservation-summary", nil)
+	ctx := i18n.WithLocale(getCtx(req), "fr")
+	req = req.WithContext(ctx)
+
+	session.Put(ctx, "reservation", models.Reservation{
+		RoomID:       1,
+		StartDate:    time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:      time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+		Subtotal:     22000,
+		Room:         models.Room{ID: 1, RoomName: "General's Quarters"},
+		CheckInTime:  "14:00",
+		CheckOutTime: "10:00",
+	})
+
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.ReservationSummary)
+	handler.ServeHTTP(rr, req)
+
+	for _, s := range []string{`lang="fr"`, "Récapitulatif de la réservation", "01/01/2050", "03/01/2050", "à partir de 14:00", "avant 10:00"} {
+		if !strings.Contains(rr.Body.String(), s) {
+			t.Errorf("expected the summary to show %q", s)
+		}
+	}
+}
+
+func TestRepository_AdminPostRoomRate(t *testing.T) {
+	var tests = []struct {
+		name               string
+		roomId             string
+		rate               string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"valid", "1", "120", http.StatusSeeOther, "Nightly rate saved"},
+		{"with cents", "2", "149.5", http.StatusSeeOther, "Nightly rate saved"},
+		{"bad rate", "1", "12O", http.StatusSeeOther, ""},
+		{"bad id", "x", "120", http.StatusBadRequest, ""},
+		{"update fails", "3", "120", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("nightly_rate", e.rate)
+
+		req, _ := http.NewRequest("POST", "/admin/rooms/"+e.roomId+"/rate", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.roomId)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostRoomRate)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_AdminPostRoomOccupancy(t *testing.T) {
+	var tests = []struct {
+		name               string
+		roomId             string
+		maxOccupancy       string
+		expectedStatusCode int
+		expectedFlash      string
+	}{
+		{"valid", "1", "3", http.StatusSeeOther, "Occupancy saved"},
+		{"no limit", "2", "0", http.StatusSeeOther, "Occupancy saved"},
+		{"negative", "1", "-1", http.StatusSeeOther, ""},
+		{"not a number", "1", "two", http.StatusSeeOther, ""},
+		{"bad id", "x", "2", http.StatusBadRequest, ""},
+		{"update fails", "3", "2", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("max_occupancy", e.maxOccupancy)
+
+		req, _ := http.NewRequest("POST", "/admin/rooms/"+e.roomId+"/occupancy", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.roomId)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostRoomOccupancy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+
+		if flash := session.GetString(ctx, "flash"); flash != e.expectedFlash {
+			t.Errorf("for %s expected flash %q but got %q", e.name, e.expectedFlash, flash)
+		}
+	}
+}
+
+func TestRepository_AdminPostCancellationPolicy(t *testing.T) {
+	var tests = []struct {
+		name               string
+		data               map[string]string
+		expectedStatusCode int
+	}{
+		{"percentage", map[string]string{"name": "Flexible", "free_days": "7", "penalty_type": "percent", "penalty_percent": "50"}, http.StatusSeeOther},
+		{"first night", map[string]string{"name": "Moderate", "free_days": "2", "penalty_type": "first_night"}, http.StatusSeeOther},
+		{"non-refundable", map[string]string{"name": "Saver", "penalty_type": "full", "non_refundable": "1"}, http.StatusSeeOther},
+		{"missing name", map[string]string{"penalty_type": "full"}, http.StatusOK},
+		{"missing percentage", map[string]string{"name": "Flexible", "penalty_type": "percent"}, http.StatusOK},
+		{"percentage too high", map[string]string{"name": "Flexible", "penalty_type": "percent", "penalty_percent": "120"}, http.StatusOK},
+		{"negative days", map[string]string{"name": "Flexible", "free_days": "-1", "penalty_type": "full"}, http.StatusOK},
+		{"unknown type", map[string]string{"name": "Flexible", "penalty_type": "double"}, http.StatusOK},
+		{"insert fails", map[string]string{"name": "Invalid", "penalty_type": "full"}, http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		for k, v := range e.data {
+			postedData.Add(k, v)
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/cancellation-policies", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestRepository_AdminPostRoomCancellationPolicy(t *testing.T) {
+	var tests = []struct {
+		name               string
+		roomId             string
+		policyId           string
+		expectedStatusCode int
+	}{
+		{"policy", "1", "2", http.StatusSeeOther},
+		{"free cancellation", "2", "", http.StatusSeeOther},
+		{"bad policy", "1", "x", http.StatusBadRequest},
+		{"bad id", "x", "1", http.StatusBadRequest},
+		{"update fails", "3", "1", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("cancellation_policy_id", e.policyId)
+
+		req, _ := http.NewRequest("POST", "/admin/rooms/"+e.roomId+"/cancellation-policy", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", e.roomId)
+		ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostRoomCancellationPolicy)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expectedStatusCode, rr.Code)
+		}
+	}
+}
+
+func TestParseCents(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected int
+		valid    bool
+	}{
+		{"120", 12000, true},
+		{"120.5", 12050, true},
+		{"120.05", 12005, true},
+		{" 0.99 ", 99, true},
+		{"120.505", 0, false},
+		{"-5", 0, false},
+		{"1,200", 0, false},
+		{"", 0, false},
+	}
+
+	for _, e := range tests {
+		got, err := parseCents(e.input)
+		if (err == nil) != e.valid || got != e.expected {
+			t.Errorf("for %q expected %d (valid %v) but got %d, %v", e.input, e.expected, e.valid, got, err)
+		}
+	}
+}
+
 var loginTests = []struct {
 	name               string
 	email              string
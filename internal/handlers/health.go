@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/health"
+)
+
+// readyTimeout is how long the readiness checks have between them
+const readyTimeout = 2 * time.Second
+
+// Healthz reports that the process is up and serving requests. It checks nothing else, so
+// a database outage doesn't get the process restarted.
+func (m *Repository) Healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, map[string]string{"status": health.StatusOK})
+}
+
+// Readyz reports whether the application can serve requests: the database answers and is
+// migrated, the templates are loaded and the mail server can be reached. It answers 503
+// when any of them fails, so the load balancer stops sending traffic here.
+func (m *Repository) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := health.Run(r.Context(), readyTimeout, m.readyChecks()...)
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+
+	writeHealth(w, status, report)
+}
+
+// Version reports which build is running
+func (m *Repository) Version(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, health.Build())
+}
+
+func (m *Repository) readyChecks() []health.Check {
+	return []health.Check{
+		{Name: "database", Run: func(ctx context.Context) error {
+			return m.DB.Ping(ctx)
+		}},
+		{Name: "migrations", Run: func(ctx context.Context) error {
+			version, err := m.DB.MigrationVersion(ctx)
+			if err != nil {
+				return err
+			}
+			if version < m.App.SchemaVersion {
+				return fmt.Errorf("database is at migration %q, expected %s", version, m.App.SchemaVersion)
+			}
+			return nil
+		}},
+		{Name: "templates", Run: func(ctx context.Context) error {
+			if len(m.App.TemplateCache) == 0 {
+				return errors.New("no templates loaded")
+			}
+			return nil
+		}},
+		{Name: "mail", Run: func(ctx context.Context) error {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(m.App.MailHost, strconv.Itoa(m.App.MailPort)))
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}},
+	}
+}
+
+// writeHealth writes v as JSON. Probes aren't part of the API, so v isn't wrapped in its envelope.
+func writeHealth(w http.ResponseWriter, status int, v interface{}) {
+	out, _ := json.MarshalIndent(v, "", "  ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(out)
+}
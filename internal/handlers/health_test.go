@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tsawler/bookings-app/internal/health"
+)
+
+func TestRepository_Healthz(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Healthz)
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected %d but got %d", http.StatusOK, rr.Code)
+	}
+	if rr.Body.String() != "{\n  \"status\": \"ok\"\n}" {
+		t.Errorf("unexpected body %s", rr.Body.String())
+	}
+}
+
+func TestRepository_Readyz(t *testing.T) {
+	// a mail server to reach, and the address of one that isn't there
+	mail, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mail.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	defer func(host string, port int, version string) {
+		app.MailHost, app.MailPort, app.SchemaVersion = host, port, version
+	}(app.MailHost, app.MailPort, app.SchemaVersion)
+
+	var tests = []struct {
+		name           string
+		mailPort       int
+		schemaVersion  string
+		expectedStatus int
+		failing        string
+	}{
+		{"ready", mail.Addr().(*net.TCPAddr).Port, "20261020040000", http.StatusOK, ""},
+		{"behind on migrations", mail.Addr().(*net.TCPAddr).Port, "20991231000000", http.StatusServiceUnavailable, "migrations"},
+		{"no mail server", closedPort, "20261020040000", http.StatusServiceUnavailable, "mail"},
+	}
+
+	for _, e := range tests {
+		app.MailHost = "127.0.0.1"
+		app.MailPort = e.mailPort
+		app.SchemaVersion = e.schemaVersion
+
+		req, _ := http.NewRequest("GET", "/readyz", nil)
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.Readyz)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatus {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedStatus, rr.Code)
+		}
+
+		var report health.Report
+		err := json.Unmarshal(rr.Body.Bytes(), &report)
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		for _, name := range []string{"database", "migrations", "templates", "mail"} {
+			c, ok := report.Checks[name]
+			if !ok {
+				t.Errorf("%s: %s not checked", e.name, name)
+				continue
+			}
+
+			failed := c.Status != health.StatusOK
+			if failed != (name == e.failing) {
+				t.Errorf("%s: unexpected %s check %+v", e.name, name, c)
+			}
+		}
+	}
+}
+
+func TestRepository_Version(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/version", nil)
+	rr := httptest.NewRecorder()
+
+	handler := http.HandlerFunc(Repo.Version)
+	handler.ServeHTTP(rr, req)
+
+	var b health.BuildInfo
+	err := json.Unmarshal(rr.Body.Bytes(), &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Code != http.StatusOK || b.Version != health.Version || b.GoVersion == "" {
+		t.Errorf("unexpected build info %d %+v", rr.Code, b)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// holdRestrictionID is the restriction type of a temporary room hold
+const holdRestrictionID = 3
+
+// placeHold holds the chosen room while the guest fills in their details,
+// replacing any hold they already had. No hold is placed when the room is taken.
+func (m *Repository) placeHold(r *http.Request, res models.Reservation) {
+	m.releaseHold(r)
+
+	if m.App.HoldDuration <= 0 {
+		return
+	}
+
+	expiresAt := time.Now().Add(m.App.HoldDuration)
+
+	holdId, err := m.DB.InsertHold(models.RoomRestriction{
+		StartDate:     res.StartDate,
+		EndDate:       res.EndDate,
+		RoomID:        res.RoomID,
+		RestrictionID: holdRestrictionID,
+		ExpiresAt:     expiresAt,
+	})
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		return
+	}
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "hold_id", holdId)
+	m.App.Session.Put(r.Context(), "hold_expires_at", int(expiresAt.Unix()))
+}
+
+// holdExpiry returns when the guest's hold expires, or the zero time when they have none
+func (m *Repository) holdExpiry(r *http.Request) time.Time {
+	if m.App.Session.GetInt(r.Context(), "hold_id") == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(m.App.Session.GetInt(r.Context(), "hold_expires_at")), 0)
+}
+
+// releaseHold deletes the guest's hold, if they have one
+func (m *Repository) releaseHold(r *http.Request) {
+	holdId := m.App.Session.GetInt(r.Context(), "hold_id")
+	if holdId == 0 {
+		return
+	}
+
+	err := m.DB.DeleteHold(holdId)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	m.forgetHold(r)
+}
+
+// roomTaken sends the guest back to search when the room was taken before their reservation
+// could be made
+func (m *Repository) roomTaken(w http.ResponseWriter, r *http.Request, holdId int) {
+	msg := "Sorry, the room is no longer available for those dates"
+	if holdId > 0 && !m.holdExpiry(r).After(time.Now()) {
+		msg = "Sorry, your hold expired and the room is no longer available for those dates"
+	}
+
+	m.forgetHold(r)
+	m.App.Session.Put(r.Context(), "error", msg)
+	http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+}
+
+// forgetHold removes the hold from the session once it is converted or gone
+func (m *Repository) forgetHold(r *http.Request) {
+	m.App.Session.Remove(r.Context(), "hold_id")
+	m.App.Session.Remove(r.Context(), "hold_expires_at")
+}
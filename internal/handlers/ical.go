@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/calsync"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/ical"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// RoomCalendarFeed exports all restrictions for a room as an iCalendar feed
+func (m *Repository) RoomCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	room, err := m.DB.GetRoomByICalToken(chi.URLParam(r, "token"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	restrictions, err := m.DB.AllRestrictionsForRoom(room.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	var events []ical.Event
+	for _, x := range restrictions {
+		summary := x.Restriction.RestrictionName
+		if summary == "" {
+			summary = "Unavailable"
+		}
+
+		events = append(events, ical.Event{
+			UID:     fmt.Sprintf("room-restriction-%d@bookings", x.ID),
+			Summary: summary,
+			Start:   x.StartDate,
+			End:     x.EndDate,
+			Stamp:   x.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="room-%d.ics"`, room.ID))
+
+	err = ical.Write(w, room.RoomName, events)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// AdminCalendarFeeds shows the iCalendar feed url for every room
+func (m *Repository) AdminCalendarFeeds(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["base_url"] = m.App.BaseURL
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-calendar-feeds.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+	})
+}
+
+// AdminRotateCalendarFeed issues a new feed token for a room, invalidating the old url
+func (m *Repository) AdminRotateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	roomId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	token, err := helpers.GenerateToken(24)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.UpdateRoomICalToken(roomId, token)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar feed url updated")
+	http.Redirect(w, r, "/admin/calendar-feeds", http.StatusSeeOther)
+}
+
+// AdminExternalCalendars lists the imported external calendars and their sync status
+func (m *Repository) AdminExternalCalendars(w http.ResponseWriter, r *http.Request) {
+	calendars, err := m.DB.AllExternalCalendars()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["calendars"] = calendars
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-external-calendars.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostExternalCalendar adds an external calendar to import for a room
+func (m *Repository) AdminPostExternalCalendar(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "name", "url")
+	form.IsURL("url")
+
+	roomId, err := strconv.Atoi(r.Form.Get("room_id"))
+	if err != nil {
+		form.Errors.Add("room_id", "Choose a room")
+	}
+
+	if !form.Valid() {
+		calendars, err := m.DB.AllExternalCalendars()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		rooms, err := m.DB.AllRooms()
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		data := make(map[string]interface{})
+		data["calendars"] = calendars
+		data["rooms"] = rooms
+
+		render.Template(w, r, "admin-external-calendars.page.tmpl", &models.TemplateData{
+			Data: data,
+			Form: form,
+		})
+		return
+	}
+
+	err = m.DB.InsertExternalCalendar(models.ExternalCalendar{
+		RoomID: roomId,
+		Name:   r.Form.Get("name"),
+		URL:    r.Form.Get("url"),
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "External calendar added")
+	http.Redirect(w, r, "/admin/external-calendars", http.StatusSeeOther)
+}
+
+// AdminSyncExternalCalendar imports an external calendar immediately
+func (m *Repository) AdminSyncExternalCalendar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	c, err := m.DB.GetExternalCalendarById(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = calsync.New(m.DB).Sync(c)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Sync failed: %s", err))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Calendar synced")
+	}
+
+	http.Redirect(w, r, "/admin/external-calendars", http.StatusSeeOther)
+}
+
+// AdminDeleteExternalCalendar stops importing an external calendar and removes its blocks
+func (m *Repository) AdminDeleteExternalCalendar(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteExternalCalendar(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "External calendar removed")
+	http.Redirect(w, r, "/admin/external-calendars", http.StatusSeeOther)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key header accepted
+const maxIdempotencyKeyLength = 255
+
+// idempotencyWait is how long a resubmitted form waits for the original submission to finish
+var idempotencyWait = 3 * time.Second
+
+// apiIdempotencyKey returns the stored key for an Idempotency-Key header,
+// scoped to the api token so clients cannot replay each other's requests
+func apiIdempotencyKey(r *http.Request, header string) string {
+	if t, ok := helpers.APIToken(r); ok {
+		return fmt.Sprintf("api:%d:%s", t.ID, header)
+	}
+	return "api:" + header
+}
+
+// releaseIdempotencyKey frees a key whose request did not create a reservation
+func (m *Repository) releaseIdempotencyKey(key string) {
+	err := m.DB.ReleaseIdempotencyKey(key)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// completeIdempotencyKey stores the reservation created for a key
+func (m *Repository) completeIdempotencyKey(key string, reservationId int) {
+	err := m.DB.CompleteIdempotencyKey(key, reservationId)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// awaitIdempotencyKey waits for a submission still in progress to store its reservation
+func (m *Repository) awaitIdempotencyKey(key models.IdempotencyKey) (models.IdempotencyKey, bool) {
+	deadline := time.Now().Add(idempotencyWait)
+
+	for key.ReservationID == 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+
+		k, err := m.DB.GetIdempotencyKey(key.Key)
+		if err != nil {
+			// the original submission failed and released the key
+			return key, false
+		}
+		key = k
+	}
+
+	return key, key.ReservationID > 0
+}
+
+// replayReservation shows the summary of the reservation created by the first
+// submission of a reservation form
+func (m *Repository) replayReservation(w http.ResponseWriter, r *http.Request, key models.IdempotencyKey) {
+	key, ok := m.awaitIdempotencyKey(key)
+	if !ok {
+		m.App.Session.Put(r.Context(), "error", "This form was already submitted. Check your email for a confirmation or try again.")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	res, err := m.DB.GetReservationById(key.ReservationID)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Can't find the reservation!")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// replayAPIReservation returns the response of the original request made with an idempotency key
+func (m *Repository) replayAPIReservation(w http.ResponseWriter, key models.IdempotencyKey, requestHash string) {
+	if key.RequestHash != requestHash {
+		writeAPIError(w, http.StatusUnprocessableEntity, "idempotency_key_reused", "The idempotency key was already used for a different request", nil)
+		return
+	}
+
+	if key.ReservationID == 0 {
+		writeAPIError(w, http.StatusConflict, "request_in_progress", "A request with this idempotency key is still being processed", nil)
+		return
+	}
+
+	res, err := m.DB.GetReservationById(key.ReservationID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		writeAPIError(w, http.StatusInternalServerError, "server_error", "Internal server error", nil)
+		return
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.Header().Set("Location", "/api/v1/reservations/"+strconv.Itoa(res.ID))
+	writeJSON(w, http.StatusCreated, toAPIReservation(res))
+}
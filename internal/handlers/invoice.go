@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tsawler/bookings-app/internal/folio"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/invoice"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// AdminReservationInvoice downloads the invoice for a reservation, or the receipt when it was
+// paid. The invoice is issued with its number the first time, and the same one downloaded after.
+func (m *Repository) AdminReservationInvoice(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.folioReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	f, err := m.reservationFolio(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	inv, err := m.DB.GetOrCreateInvoice(res.ID, m.renderInvoice(res, f))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Filename(inv)))
+	w.Write(inv.PDF)
+}
+
+// AdminPostCheckoutEmail thanks the guest for their stay with their balance, attaching the
+// invoice when asked to
+func (m *Repository) AdminPostCheckoutEmail(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.folioReservationFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	f, err := m.reservationFolio(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	l := res.Locale
+
+	balance := i18n.T(l, "Your account is settled.")
+	if f.Balance > 0 {
+		balance = i18n.T(l, "Balance due: %s", render.Money(f.Balance, l))
+	} else if f.Balance < 0 {
+		balance = i18n.T(l, "We owe you %s, which will be refunded.", render.Money(-f.Balance, l))
+	}
+
+	htmlMsg := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		%s
+	`,
+		i18n.T(l, "Thank you for staying with us"),
+		i18n.T(l, "Dear %s:", res.FirstName),
+		i18n.T(l, "Thank you for staying in the %s from %s to %s.", res.Room.RoomName, i18n.Date(res.StartDate, l), i18n.Date(res.EndDate, l)),
+		balance,
+	)
+
+	msg := models.MailData{
+		To:       res.Email,
+		From:     m.App.PropertyEmail,
+		Subject:  i18n.T(l, "Thank you for your stay"),
+		Content:  htmlMsg,
+		Template: "base.html",
+	}
+
+	if r.Form.Get("attach_invoice") == "1" {
+		inv, err := m.DB.GetOrCreateInvoice(res.ID, m.renderInvoice(res, f))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		msg.Attachments = append(msg.Attachments, models.MailAttachment{
+			Name:        invoice.Filename(inv),
+			ContentType: "application/pdf",
+			Data:        inv.PDF,
+		})
+	}
+
+	m.App.MailChan <- msg
+
+	m.App.Session.Put(r.Context(), "flash", "Checkout email sent")
+	http.Redirect(w, r, folioURL(res.ID), http.StatusSeeOther)
+}
+
+// reservationFolio builds the folio of a reservation
+func (m *Repository) reservationFolio(res models.Reservation) (folio.Folio, error) {
+	items, err := m.DB.GetFolioItemsForReservation(res.ID)
+	if err != nil {
+		return folio.Folio{}, err
+	}
+
+	paid, err := m.DB.GetPaymentsForReservation(res.ID)
+	if err != nil {
+		return folio.Folio{}, err
+	}
+
+	return folio.Build(res, items, paid), nil
+}
+
+// property is who invoices are from
+func (m *Repository) property() invoice.Property {
+	return invoice.Property{
+		Name:     m.App.PropertyName,
+		Address:  m.App.PropertyAddress,
+		Email:    m.App.PropertyEmail,
+		Phone:    m.App.PropertyPhone,
+		Currency: m.App.Currencies.Base(),
+	}
+}
+
+// renderInvoice renders the invoice for a reservation as it stands, for when its number is
+// assigned. What is issued is stored, so later changes to the folio don't alter it.
+func (m *Repository) renderInvoice(res models.Reservation, f folio.Folio) func(inv models.Invoice) []byte {
+	return func(inv models.Invoice) []byte {
+		return invoice.Render(m.property(), inv, res, f)
+	}
+}
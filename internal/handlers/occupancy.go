@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// parseGuests validates the adults and children fields, defaulting to a single adult
+func parseGuests(form *forms.Form) (int, int) {
+	adults, children := 1, 0
+
+	if form.Has("adults") {
+		n, err := strconv.Atoi(form.Get("adults"))
+		if err != nil || n < 1 {
+			form.Errors.Add("adults", form.T("At least one adult must be staying"))
+		} else {
+			adults = n
+		}
+	}
+
+	if form.Has("children") {
+		n, err := strconv.Atoi(form.Get("children"))
+		if err != nil || n < 0 {
+			form.Errors.Add("children", form.T("Enter the number of children, or 0"))
+		} else {
+			children = n
+		}
+	}
+
+	return adults, children
+}
+
+// checkOccupancy adds an error when the party is larger than the room sleeps. A room with a
+// max occupancy of 0 sleeps any number of guests.
+func checkOccupancy(form *forms.Form, room models.Room, adults, children int) {
+	if room.MaxOccupancy > 0 && adults+children > room.MaxOccupancy {
+		form.Errors.Add("adults", form.T("%s sleeps at most %d guests", room.RoomName, room.MaxOccupancy))
+	}
+}
+
+// AdminPostRoomOccupancy sets how many guests a room sleeps, or 0 for no limit
+func (m *Repository) AdminPostRoomOccupancy(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	maxOccupancy, err := strconv.Atoi(r.Form.Get("max_occupancy"))
+	if err != nil || maxOccupancy < 0 {
+		m.App.Session.Put(r.Context(), "error", "Enter how many guests the room sleeps, or 0 for no limit")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateRoomMaxOccupancy(id, maxOccupancy)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Occupancy saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
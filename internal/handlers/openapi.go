@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/openapi"
+)
+
+const (
+	jsonType = "application/json"
+	formType = "application/x-www-form-urlencoded"
+)
+
+// OpenAPI serves the OpenAPI document describing the JSON endpoints
+func (m *Repository) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	out, _ := json.MarshalIndent(OpenAPISpec(), "", "  ")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// OpenAPISpec returns the OpenAPI 3 document for the JSON endpoints. The
+// examples are built from the same types the handlers encode, so a change to
+// a response that is not reflected in the schemas fails the spec tests.
+func OpenAPISpec() *openapi.Document {
+	exampleRoom := models.Room{ID: 1, RoomName: "General's Quarters", MaxOccupancy: 2}
+	created := time.Date(2050, 1, 1, 9, 30, 0, 0, time.UTC)
+	exampleReservation := toAPIReservation(models.Reservation{
+		ID:        7,
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		Phone:     "555-555-5555",
+		StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+		Adults:    2,
+		RoomID:    1,
+		Room:      exampleRoom,
+		CreatedAt: created,
+	})
+
+	notFound := errorResponse("The resource does not exist", "not_found", "Reservation not found", nil)
+	invalid := errorResponse("The request failed validation", "validation_failed", "The request is invalid", map[string][]string{
+		"start_date": {"Must be a date in YYYY-MM-DD format"},
+	})
+	unauthorized := errorResponse("Authentication is required", "unauthorized", "Authentication required", nil)
+	forbidden := errorResponse("The token does not have the required scope", "forbidden", "The token does not have the required scope", nil)
+	rateLimited := errorResponse("The token is over its request limit", "rate_limited", "Too many requests", nil)
+
+	read := []map[string][]string{{"bearerAuth": {"read"}}, {"sessionCookie": {}}}
+	write := []map[string][]string{{"bearerAuth": {"write"}}, {"sessionCookie": {}}}
+
+	idParam := openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}}
+
+	return &openapi.Document{
+		OpenAPI: "3.0.3",
+		Info: openapi.Info{
+			Title:   "Bookings API",
+			Version: "1.0.0",
+			Description: "Room availability and reservations. Successful responses are wrapped in " +
+				"a data envelope and failures in an error envelope.",
+		},
+		Paths: map[string]openapi.PathItem{
+			"/api/openapi.json": {
+				"get": {
+					OperationID: "getOpenAPI",
+					Summary:     "This document",
+					Tags:        []string{"meta"},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "The OpenAPI document", Content: map[string]openapi.MediaType{
+							jsonType: {Schema: &openapi.Schema{Type: "object"}},
+						}},
+					},
+				},
+			},
+			"/search-availability-json": {
+				"post": {
+					OperationID: "searchAvailabilityJSON",
+					Summary:     "Check whether a room is free for a date range",
+					Description: "Used by the room pages. Requires the session cookie and its CSRF token.",
+					Tags:        []string{"availability"},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content: map[string]openapi.MediaType{
+							formType: {Schema: openapi.Ref("AvailabilityForm")},
+						},
+					},
+					Responses: map[string]openapi.Response{
+						"200": {Description: "Availability, or ok false with a message on error", Content: map[string]openapi.MediaType{
+							jsonType: {Schema: openapi.Ref("AvailabilityCheck"), Example: jsonResponse{
+								OK:        true,
+								StartDate: "2050-01-10",
+								EndDate:   "2050-01-12",
+								RoomID:    "1",
+							}},
+						}},
+					},
+					Security: []map[string][]string{{"sessionCookie": {}}},
+				},
+			},
+			"/api/v1/rooms": {
+				"get": {
+					OperationID: "listRooms",
+					Summary:     "List rooms",
+					Tags:        []string{"rooms"},
+					Responses: map[string]openapi.Response{
+						"200": dataResponse("The rooms", envelope("Room", true), []apiRoom{toAPIRoom(exampleRoom)}),
+					},
+				},
+			},
+			"/api/v1/rooms/{id}": {
+				"get": {
+					OperationID: "getRoom",
+					Summary:     "Get a room",
+					Tags:        []string{"rooms"},
+					Parameters:  []openapi.Parameter{idParam},
+					Responses: map[string]openapi.Response{
+						"200": dataResponse("The room", envelope("Room", false), toAPIRoom(exampleRoom)),
+						"404": errorResponse("The room does not exist", "not_found", "Room not found", nil),
+					},
+				},
+			},
+			"/api/v1/availability": {
+				"get": {
+					OperationID: "getAvailability",
+					Summary:     "Rooms available between two dates",
+					Tags:        []string{"availability"},
+					Parameters: []openapi.Parameter{
+						{Name: "start", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Format: "date"}},
+						{Name: "end", In: "query", Required: true, Schema: &openapi.Schema{Type: "string", Format: "date"}},
+						{Name: "room_id", In: "query", Description: "Only check this room", Schema: &openapi.Schema{Type: "integer"}},
+						{Name: "adults", In: "query", Description: "Defaults to 1", Schema: &openapi.Schema{Type: "integer"}},
+						{Name: "children", In: "query", Description: "Defaults to 0", Schema: &openapi.Schema{Type: "integer"}},
+					},
+					Responses: map[string]openapi.Response{
+						"200": dataResponse("The available rooms", envelope("Availability", false), apiAvailability{
+							StartDate: "2050-01-10",
+							EndDate:   "2050-01-12",
+							Available: true,
+							Rooms:     []apiRoom{toAPIRoom(exampleRoom)},
+						}),
+						"404": errorResponse("The room does not exist", "not_found", "Room not found", nil),
+						"422": invalid,
+					},
+				},
+			},
+			"/api/v1/reservations": {
+				"post": {
+					OperationID: "createReservation",
+					Summary:     "Book a room",
+					Description: "Send an Idempotency-Key header to retry safely: a repeated request with the same key " +
+						"and body returns the original reservation with an Idempotent-Replayed header instead of booking again.",
+					Tags: []string{"reservations"},
+					Parameters: []openapi.Parameter{
+						{Name: "Idempotency-Key", In: "header", Description: "Client generated key, at most 255 characters", Schema: &openapi.Schema{Type: "string"}},
+					},
+					RequestBody: &openapi.RequestBody{
+						Required: true,
+						Content: map[string]openapi.MediaType{
+							jsonType: {Schema: openapi.Ref("ReservationRequest"), Example: apiReservationRequest{
+								RoomID:       1,
+								StartDate:    "2050-01-10",
+								EndDate:      "2050-01-12",
+								FirstName:    "John",
+								LastName:     "Smith",
+								Email:        "john@smith.com",
+								Phone:        "555-555-5555",
+								Adults:       2,
+								PaymentToken: "tok_visa",
+							}},
+						},
+					},
+					Responses: map[string]openapi.Response{
+						"201": dataResponse("The reservation was created, or replayed for a repeated idempotency key", envelope("Reservation", false), exampleReservation),
+						"400": errorResponse("The body is not valid JSON, or the idempotency key is too long", "invalid_json", "The request body must be a JSON object", nil),
+						"401": unauthorized,
+						"402": errorResponse("The card was declined for the deposit", "payment_declined", "The card was declined", nil),
+						"403": forbidden,
+						"409": errorResponse("The room is not available, the stay rules don't allow the dates (code restricted), "+
+							"or a request with the same idempotency key is in progress", "unavailable", "The room is not available for the requested dates", nil),
+						"422": errorResponse("The request failed validation, or the idempotency key was used for a different body", "validation_failed", "The request is invalid", map[string][]string{
+							"start_date": {"Must be a date in YYYY-MM-DD format"},
+						}),
+						"429": rateLimited,
+						"502": errorResponse("The payment provider could not take the deposit", "payment_failed", "The deposit could not be taken", nil),
+					},
+					Security: write,
+				},
+			},
+			"/api/v1/reservations/{id}": {
+				"get": {
+					OperationID: "getReservation",
+					Summary:     "Get a reservation",
+					Tags:        []string{"reservations"},
+					Parameters:  []openapi.Parameter{idParam},
+					Responses: map[string]openapi.Response{
+						"200": dataResponse("The reservation", envelope("Reservation", false), exampleReservation),
+						"401": unauthorized,
+						"403": forbidden,
+						"404": notFound,
+						"429": rateLimited,
+					},
+					Security: read,
+				},
+			},
+			"/api/v1/reservations/{id}/cancel": {
+				"post": {
+					OperationID: "cancelReservation",
+					Summary:     "Cancel a reservation and free its dates",
+					Tags:        []string{"reservations"},
+					Parameters:  []openapi.Parameter{idParam},
+					Responses: map[string]openapi.Response{
+						"200": dataResponse("The cancelled reservation", envelope("Reservation", false), exampleReservation),
+						"401": unauthorized,
+						"403": forbidden,
+						"404": notFound,
+						"409": errorResponse("The reservation is already cancelled", "already_cancelled", "The reservation is already cancelled", nil),
+						"429": rateLimited,
+					},
+					Security: write,
+				},
+			},
+		},
+		Components: openapi.Components{
+			Schemas: map[string]*openapi.Schema{
+				"Room": {
+					Type:     "object",
+					Required: []string{"id", "name", "max_occupancy"},
+					Properties: map[string]*openapi.Schema{
+						"id":            {Type: "integer"},
+						"name":          {Type: "string"},
+						"max_occupancy": {Type: "integer", Description: "Most guests, adults and children together, the room sleeps"},
+					},
+				},
+				"Availability": {
+					Type:     "object",
+					Required: []string{"start_date", "end_date", "available", "rooms"},
+					Properties: map[string]*openapi.Schema{
+						"start_date": {Type: "string", Format: "date"},
+						"end_date":   {Type: "string", Format: "date"},
+						"available":  {Type: "boolean"},
+						"rooms":      {Type: "array", Items: openapi.Ref("Room")},
+						"restricted": {
+							Type:        "array",
+							Description: "Free rooms the stay rules don't allow for these dates, with the reasons",
+							Items:       openapi.Ref("RestrictedRoom"),
+						},
+					},
+				},
+				"RestrictedRoom": {
+					Type:     "object",
+					Required: []string{"room", "reasons"},
+					Properties: map[string]*openapi.Schema{
+						"room":    openapi.Ref("Room"),
+						"reasons": {Type: "array", Items: &openapi.Schema{Type: "string"}},
+					},
+				},
+				"Reservation": {
+					Type:     "object",
+					Required: []string{"id", "room", "first_name", "last_name", "email", "phone", "start_date", "end_date", "adults", "children", "processed", "cancelled"},
+					Properties: map[string]*openapi.Schema{
+						"id":         {Type: "integer"},
+						"room":       openapi.Ref("Room"),
+						"first_name": {Type: "string"},
+						"last_name":  {Type: "string"},
+						"email":      {Type: "string", Format: "email"},
+						"phone":      {Type: "string"},
+						"start_date": {Type: "string", Format: "date"},
+						"end_date":   {Type: "string", Format: "date"},
+						"adults":     {Type: "integer"},
+						"children":   {Type: "integer"},
+						"processed":  {Type: "boolean"},
+						"cancelled":  {Type: "boolean"},
+						"created_at": {Type: "string", Format: "date-time"},
+					},
+				},
+				"ReservationRequest": {
+					Type:     "object",
+					Required: []string{"room_id", "start_date", "end_date", "first_name", "last_name", "email"},
+					Properties: map[string]*openapi.Schema{
+						"room_id":    {Type: "integer"},
+						"start_date": {Type: "string", Format: "date"},
+						"end_date":   {Type: "string", Format: "date"},
+						"first_name": {Type: "string", Description: "At least 3 characters"},
+						"last_name":  {Type: "string"},
+						"email":      {Type: "string", Format: "email"},
+						"phone":      {Type: "string"},
+						"adults":     {Type: "integer", Description: "Defaults to 1"},
+						"children":   {Type: "integer", Description: "Defaults to 0"},
+						"payment_token": {Type: "string", Description: "Card token from the payment provider, needed when the property takes a deposit. " +
+							"The deposit is authorized before the reservation is made and taken once it is."},
+					},
+				},
+				"AvailabilityForm": {
+					Type:     "object",
+					Required: []string{"start", "end", "room_id", "csrf_token"},
+					Properties: map[string]*openapi.Schema{
+						"start":      {Type: "string", Format: "date"},
+						"end":        {Type: "string", Format: "date"},
+						"room_id":    {Type: "integer"},
+						"adults":     {Type: "integer"},
+						"children":   {Type: "integer"},
+						"csrf_token": {Type: "string"},
+					},
+				},
+				"AvailabilityCheck": {
+					Type:     "object",
+					Required: []string{"ok", "message", "room_id", "start_date", "end_date"},
+					Properties: map[string]*openapi.Schema{
+						"ok":         {Type: "boolean"},
+						"message":    {Type: "string"},
+						"room_id":    {Type: "string"},
+						"start_date": {Type: "string"},
+						"end_date":   {Type: "string"},
+					},
+				},
+				"Error": {
+					Type:     "object",
+					Required: []string{"error"},
+					Properties: map[string]*openapi.Schema{
+						"error": {
+							Type:     "object",
+							Required: []string{"code", "message"},
+							Properties: map[string]*openapi.Schema{
+								"code":    {Type: "string"},
+								"message": {Type: "string"},
+								"fields": {
+									Type:                 "object",
+									Description:          "Validation messages by field name",
+									AdditionalProperties: &openapi.Schema{Type: "array", Items: &openapi.Schema{Type: "string"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				"bearerAuth": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "API token created under Admin > API Tokens",
+				},
+				"sessionCookie": {
+					Type:        "apiKey",
+					In:          "cookie",
+					Name:        "session",
+					Description: "Logged in admin session; requests also need the CSRF token",
+				},
+			},
+		},
+	}
+}
+
+// envelope returns the schema of a data envelope around a component
+func envelope(name string, list bool) *openapi.Schema {
+	data := openapi.Ref(name)
+	if list {
+		data = &openapi.Schema{Type: "array", Items: data}
+	}
+
+	return &openapi.Schema{
+		Type:       "object",
+		Required:   []string{"data"},
+		Properties: map[string]*openapi.Schema{"data": data},
+	}
+}
+
+// dataResponse documents a successful response, wrapping the example in the data envelope
+func dataResponse(description string, schema *openapi.Schema, example interface{}) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content: map[string]openapi.MediaType{
+			jsonType: {Schema: schema, Example: apiEnvelope{Data: example}},
+		},
+	}
+}
+
+// errorResponse documents a failed response with an example error envelope
+func errorResponse(description, code, message string, fields map[string][]string) openapi.Response {
+	return openapi.Response{
+		Description: description,
+		Content: map[string]openapi.MediaType{
+			jsonType: {Schema: openapi.Ref("Error"), Example: apiErrorEnvelope{
+				Error: apiErrorBody{Code: code, Message: message, Fields: fields},
+			}},
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/tsawler/bookings-app/internal/openapi"
+)
+
+func TestOpenAPIExamples(t *testing.T) {
+	spec := OpenAPISpec()
+
+	for _, path := range sortedPaths(spec) {
+		for method, op := range spec.Paths[path] {
+			if op.RequestBody != nil {
+				for ct, mt := range op.RequestBody.Content {
+					checkExample(t, spec, path+" "+method+" request "+ct, mt)
+				}
+			}
+
+			for status, resp := range op.Responses {
+				for ct, mt := range resp.Content {
+					checkExample(t, spec, path+" "+method+" "+status+" "+ct, mt)
+				}
+			}
+		}
+	}
+}
+
+func checkExample(t *testing.T, spec *openapi.Document, name string, mt openapi.MediaType) {
+	if _, err := spec.Resolve(mt.Schema); err != nil {
+		t.Errorf("%s: %s", name, err)
+		return
+	}
+
+	if mt.Example == nil {
+		return
+	}
+
+	if err := spec.ValidateExample(mt.Schema, mt.Example); err != nil {
+		t.Errorf("%s: example does not match schema: %s", name, err)
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	routes := getRoutes()
+
+	req := httptest.NewRequest("GET", "/api/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected %d but got %d", http.StatusOK, rr.Code)
+	}
+
+	var doc openapi.Document
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI == "" || len(doc.Paths) == 0 {
+		t.Error("served document is missing its version or paths")
+	}
+}
+
+// TestOpenAPIResponses checks the real responses from the API tests against the documented schemas
+func TestOpenAPIResponses(t *testing.T) {
+	spec := OpenAPISpec()
+	routes := getRoutes()
+
+	for _, e := range apiTests {
+		u, _ := url.Parse(e.url)
+		op := spec.Operation(matchPath(spec, u.Path), e.method)
+		if op == nil {
+			continue
+		}
+
+		req := httptest.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		routes.ServeHTTP(rr, req)
+
+		checkResponse(t, spec, op, e.name, rr)
+	}
+
+	// the legacy availability endpoint takes a form post
+	postedData := url.Values{}
+	postedData.Add("start", "2050-01-01")
+	postedData.Add("end", "2050-01-02")
+	postedData.Add("room_id", "1")
+
+	req := httptest.NewRequest("POST", "/search-availability-json", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	checkResponse(t, spec, spec.Operation("/search-availability-json", "POST"), "search availability json", rr)
+}
+
+func checkResponse(t *testing.T, spec *openapi.Document, op *openapi.Operation, name string, rr *httptest.ResponseRecorder) {
+	resp, ok := op.Responses[strconv.Itoa(rr.Code)]
+	if !ok {
+		t.Errorf("for %s status %d is not documented", name, rr.Code)
+		return
+	}
+
+	mt, ok := resp.Content[jsonType]
+	if !ok {
+		t.Errorf("for %s no json schema documented for status %d", name, rr.Code)
+		return
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Errorf("for %s response is not json: %s", name, err)
+		return
+	}
+
+	if err := spec.Validate(mt.Schema, body); err != nil {
+		t.Errorf("for %s response does not match schema: %s", name, err)
+	}
+}
+
+// matchPath returns the documented path template matching a request path
+func matchPath(spec *openapi.Document, path string) string {
+	parts := strings.Split(path, "/")
+
+	for _, p := range sortedPaths(spec) {
+		tmpl := strings.Split(p, "/")
+		if len(tmpl) != len(parts) {
+			continue
+		}
+
+		match := true
+		for i := range tmpl {
+			if !strings.HasPrefix(tmpl[i], "{") && tmpl[i] != parts[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return p
+		}
+	}
+
+	return ""
+}
+
+func sortedPaths(spec *openapi.Document) []string {
+	var paths []string
+	for p := range spec.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
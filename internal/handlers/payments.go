@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
+)
+
+// captureDeposit takes an authorized deposit and records the payment on the reservation.
+// A failed capture leaves the payment authorized, for staff to capture or void later.
+func (m *Repository) captureDeposit(reservationId int, ref string, amount int) bool {
+	status := payments.Captured
+
+	err := m.App.Payments.Capture(ref, amount)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		status = payments.Authorized
+	}
+
+	_, err = m.DB.InsertPayment(models.Payment{
+		ReservationID: reservationId,
+		Provider:      m.App.Payments.Name(),
+		Reference:     ref,
+		Status:        status,
+		Amount:        amount,
+	})
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+
+	return status == payments.Captured
+}
+
+// voidDeposits releases the deposits authorized for a booking that couldn't be stored
+func (m *Repository) voidDeposits(refs []string) {
+	for _, ref := range refs {
+		if ref == "" {
+			continue
+		}
+		if err := m.App.Payments.Void(ref); err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+}
+
+// AdminPostPaymentCapture takes an authorized payment
+func (m *Repository) AdminPostPaymentCapture(w http.ResponseWriter, r *http.Request) {
+	p, ok := m.paymentFromURL(w, r, payments.Authorized)
+	if !ok {
+		return
+	}
+
+	err := m.App.Payments.Capture(p.Reference, p.Amount)
+	if err != nil {
+		m.paymentFailed(w, r, p, err)
+		return
+	}
+
+	err = m.DB.UpdatePaymentStatus(p.ID, payments.Captured, p.Refunded)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Payment captured")
+	http.Redirect(w, r, paymentReservationURL(p), http.StatusSeeOther)
+}
+
+// AdminPostPaymentVoid releases an authorized payment without taking it
+func (m *Repository) AdminPostPaymentVoid(w http.ResponseWriter, r *http.Request) {
+	p, ok := m.paymentFromURL(w, r, payments.Authorized)
+	if !ok {
+		return
+	}
+
+	err := m.voidPayment(p)
+	var refused providerError
+	if errors.As(err, &refused) {
+		m.paymentFailed(w, r, p, refused.err)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Payment voided")
+	http.Redirect(w, r, paymentReservationURL(p), http.StatusSeeOther)
+}
+
+// AdminPostPaymentRefund pays back the amount entered, or all of a captured payment not yet
+// refunded when the amount is left blank
+func (m *Repository) AdminPostPaymentRefund(w http.ResponseWriter, r *http.Request) {
+	p, ok := m.paymentFromURL(w, r, payments.Captured)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	amount := p.Amount - p.Refunded
+	if strings.TrimSpace(r.Form.Get("amount")) != "" {
+		amount, err = parseCents(r.Form.Get("amount"))
+		if err != nil || amount < 1 || amount > p.Amount-p.Refunded {
+			m.App.Session.Put(r.Context(), "error", "Enter a refund of at most what is left of the payment")
+			http.Redirect(w, r, paymentReservationURL(p), http.StatusSeeOther)
+			return
+		}
+	}
+
+	err = m.refundPayment(p, amount)
+	var refused providerError
+	if errors.As(err, &refused) {
+		m.paymentFailed(w, r, p, refused.err)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Payment refunded")
+	http.Redirect(w, r, paymentReservationURL(p), http.StatusSeeOther)
+}
+
+// providerError is a change to a payment the provider refused, told apart from failing to
+// record the change
+type providerError struct {
+	err error
+}
+
+func (e providerError) Error() string {
+	return e.err.Error()
+}
+
+// voidPayment releases an authorized payment and records that it was voided
+func (m *Repository) voidPayment(p models.Payment) error {
+	err := m.App.Payments.Void(p.Reference)
+	if err != nil {
+		return providerError{err}
+	}
+
+	return m.DB.UpdatePaymentStatus(p.ID, payments.Voided, p.Refunded)
+}
+
+// refundPayment pays back part or all of a captured payment and records the refund
+func (m *Repository) refundPayment(p models.Payment, amount int) error {
+	err := m.App.Payments.Refund(p.Reference, amount)
+	if err != nil {
+		return providerError{err}
+	}
+
+	status := payments.Captured
+	if p.Refunded+amount == p.Amount {
+		status = payments.Refunded
+	}
+
+	return m.DB.UpdatePaymentStatus(p.ID, status, p.Refunded+amount)
+}
+
+// paymentFromURL loads the payment named by the id url parameter, writing the response
+// when it can't be loaded, isn't in the given status or was taken by another provider
+func (m *Repository) paymentFromURL(w http.ResponseWriter, r *http.Request, status string) (models.Payment, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return models.Payment{}, false
+	}
+
+	p, err := m.DB.GetPaymentById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return p, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return p, false
+	}
+
+	if p.Status != status {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("This payment is %s", p.Status))
+		http.Redirect(w, r, paymentReservationURL(p), http.StatusSeeOther)
+		return p, false
+	}
+
+	if p.Provider != m.App.Payments.Name() {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("This payment was taken with %s, which is no longer in use", p.Provider))
+		http.Redirect(w, r, paymentReservationURL(p), http.StatusSeeOther)
+		return p, false
+	}
+
+	return p, true
+}
+
+// paymentFailed reports a payment the provider refused to change
+func (m *Repository) paymentFailed(w http.ResponseWriter, r *http.Request, p models.Payment, err error) {
+	m.App.ErrorLog.Println(err)
+	m.App.Session.Put(r.Context(), "error", "The payment provider refused: "+err.Error())
+	http.Redirect(w, r, paymentReservationURL(p), http.StatusSeeOther)
+}
+
+func paymentReservationURL(p models.Payment) string {
+	return folioURL(p.ReservationID)
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/promo"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// priceReservation sets the reservation's subtotal from the room's nightly rate, the discount
+// given by any promo code the guest entered, and the taxes and fees on what is left. A code
+// that can't be used is reported on the form; the error is only for failing to look the
+// code or the taxes up.
+func (m *Repository) priceReservation(form *forms.Form, res *models.Reservation) error {
+	res.Subtotal = res.Nights() * res.Room.NightlyRate
+	res.Discount = 0
+	res.PromoCodeID = 0
+	res.PromoCode = ""
+
+	err := m.applyPromoCode(form, res)
+	if err != nil {
+		return err
+	}
+
+	return m.applyTaxes(res)
+}
+
+// applyPromoCode takes the discount of the promo code the guest entered, if any, off the subtotal
+func (m *Repository) applyPromoCode(form *forms.Form, res *models.Reservation) error {
+	code := strings.TrimSpace(form.Get("promo_code"))
+	if code == "" {
+		return nil
+	}
+
+	p, err := m.DB.GetPromoCodeByCode(code)
+	if errors.Is(err, sql.ErrNoRows) {
+		form.Errors.Add("promo_code", form.T("This promo code is not valid"))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	guestUses := 0
+	if p.MaxUsesPerGuest > 0 && res.Email != "" {
+		guestUses, err = m.DB.CountPromoCodeUsesByEmail(p.ID, res.Email)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reason := promo.Check(p, *res, guestUses, m.now()); reason.Text != "" {
+		form.Errors.Add("promo_code", reason.In(form.Locale))
+		return nil
+	}
+
+	res.Discount = promo.Discount(p, res.Subtotal)
+	res.PromoCodeID = p.ID
+	res.PromoCode = p.Code
+
+	return nil
+}
+
+// AdminPromoCodes lists the promo codes with their usage, and the form to add one
+func (m *Repository) AdminPromoCodes(w http.ResponseWriter, r *http.Request) {
+	m.renderPromoCodes(w, r, forms.New(nil))
+}
+
+// AdminPostPromoCode adds a promo code
+func (m *Repository) AdminPostPromoCode(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("code", "discount_type", "amount")
+
+	p := models.PromoCode{
+		Code:            strings.ToUpper(strings.TrimSpace(form.Get("code"))),
+		Description:     form.Get("description"),
+		DiscountType:    form.Get("discount_type"),
+		ValidFrom:       promoDate(form, "valid_from"),
+		ValidTo:         promoDate(form, "valid_to"),
+		StayFrom:        promoDate(form, "stay_from"),
+		StayTo:          promoDate(form, "stay_to"),
+		MaxUses:         stayRuleNumber(form, "max_uses"),
+		MaxUsesPerGuest: stayRuleNumber(form, "max_uses_per_guest"),
+		Active:          true,
+	}
+
+	if form.Get("room_id") != "" {
+		p.RoomID, err = strconv.Atoi(form.Get("room_id"))
+		if err != nil {
+			form.Errors.Add("room_id", "Choose a room")
+		}
+	}
+
+	switch p.DiscountType {
+	case promo.Percent:
+		p.Amount, err = strconv.Atoi(form.Get("amount"))
+		if err != nil || p.Amount < 1 || p.Amount > 100 {
+			form.Errors.Add("amount", "Enter a whole percentage from 1 to 100")
+		}
+	case promo.Fixed:
+		p.Amount, err = parseCents(form.Get("amount"))
+		if err != nil || p.Amount < 1 {
+			form.Errors.Add("amount", "Enter an amount such as 25 or 25.50")
+		}
+	default:
+		form.Errors.Add("discount_type", "Choose a percentage or fixed discount")
+	}
+
+	if !p.ValidFrom.IsZero() && !p.ValidTo.IsZero() && p.ValidTo.Before(p.ValidFrom) {
+		form.Errors.Add("valid_to", "Must not be before the start date")
+	}
+	if !p.StayFrom.IsZero() && !p.StayTo.IsZero() && !p.StayTo.After(p.StayFrom) {
+		form.Errors.Add("stay_to", "Must be after the first night")
+	}
+
+	if p.Code != "" {
+		_, err = m.DB.GetPromoCodeByCode(p.Code)
+		if err == nil {
+			form.Errors.Add("code", "This code is already in use")
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	if !form.Valid() {
+		m.renderPromoCodes(w, r, form)
+		return
+	}
+
+	_, err = m.DB.InsertPromoCode(p)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Promo code added")
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// AdminShowPromoCode reports on a promo code and the reservations made with it
+func (m *Repository) AdminShowPromoCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	p, err := m.DB.GetPromoCodeById(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	reservations, err := m.DB.GetReservationsForPromoCode(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["promo_code"] = p
+	data["reservations"] = reservations
+
+	render.Template(w, r, "admin-promo-codes-show.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminPostPromoCodeActive switches a promo code on or off. Codes are never deleted, so
+// reservations keep the code they were made with.
+func (m *Repository) AdminPostPromoCodeActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	active := r.Form.Get("active") == "1"
+
+	err = m.DB.UpdatePromoCodeActive(id, active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if active {
+		m.App.Session.Put(r.Context(), "flash", "Promo code activated")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Promo code deactivated")
+	}
+	http.Redirect(w, r, "/admin/promo-codes", http.StatusSeeOther)
+}
+
+// promoDate reads an optional date, where blank means no restriction
+func promoDate(form *forms.Form, field string) time.Time {
+	if form.Get(field) == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(apiDateLayout, form.Get(field))
+	if err != nil {
+		form.Errors.Add(field, "Must be a date in YYYY-MM-DD format")
+	}
+
+	return t
+}
+
+// moneyRegex matches an amount of money with at most two decimal places
+var moneyRegex = regexp.MustCompile(`^\d+(\.\d{1,2})?$`)
+
+// parseCents reads an amount of money such as 25, 25.5 or 25.50 as cents
+func parseCents(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if !moneyRegex.MatchString(s) {
+		return 0, errors.New("invalid amount")
+	}
+
+	whole, frac := s, "00"
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, frac = s[:i], (s[i+1:] + "0")[:2]
+	}
+
+	dollars, err := strconv.Atoi(whole)
+	if err != nil {
+		return 0, err
+	}
+
+	cents, err := strconv.Atoi(frac)
+	if err != nil {
+		return 0, err
+	}
+
+	return dollars*100 + cents, nil
+}
+
+func (m *Repository) renderPromoCodes(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	codes, err := m.DB.AllPromoCodes()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["promo_codes"] = codes
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-promo-codes.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminRooms lists the rooms with their nightly rates and cancellation policies
+func (m *Repository) AdminRooms(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["policies"] = policies
+
+	render.Template(w, r, "admin-rooms.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostRoomRate sets the price of a night in a room
+func (m *Repository) AdminPostRoomRate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rate, err := parseCents(r.Form.Get("nightly_rate"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Enter a nightly rate such as 120 or 120.50")
+		http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateRoomNightlyRate(id, rate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Nightly rate saved")
+	http.Redirect(w, r, "/admin/rooms", http.StatusSeeOther)
+}
@@ -15,8 +15,13 @@ import (
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"github.com/justinas/nosurf"
+	"github.com/tsawler/bookings-app/internal/clock"
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/currency"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/payments"
 	"github.com/tsawler/bookings-app/internal/render"
 )
 
@@ -28,6 +33,10 @@ var functions = template.FuncMap{
 	"formatDate": render.FormatDate,
 	"iterate":    render.Iterate,
 	"add":        render.Add,
+	"money":      render.BasePrice,
+	"price":      render.Price,
+	"t":          render.Translate,
+	"language":   i18n.Name,
 }
 
 func TestMain(m *testing.M) {
@@ -37,6 +46,8 @@ func TestMain(m *testing.M) {
 	gob.Register(models.Room{})
 	gob.Register(models.RoomRestriction{})
 	gob.Register(map[string]int{})
+	gob.Register(models.Booking{})
+	gob.Register([]int{})
 
 	// change this to true when in production
 	app.InProduction = false
@@ -60,7 +71,29 @@ func TestMain(m *testing.M) {
 	app.MailChan = mailChan
 	defer close(mailChan)
 
+	eventChan := make(chan models.WebhookEvent)
+	app.EventChan = eventChan
+	defer close(eventChan)
+
 	listenForMail()
+	listenForEvents()
+
+	app.Payments = payments.NewFake()
+	app.Deposit = payments.DepositRule{Type: payments.FirstNight}
+	app.PropertyName = "Five Star Best breakfast hostel"
+	app.PropertyAddress = "Brisbane, Australia"
+	app.PropertyEmail = "me@helloworld.com"
+	app.MailFrom = "me@helloworld.com"
+	app.BaseURL = "https://bookings.example.com"
+	app.Currencies = currency.NewTable("AUD")
+	app.Timezone = time.FixedZone("AEST", 10*60*60)
+	app.CheckInTime = clock.TimeOfDay{Hour: 14}
+	app.CheckOutTime = clock.TimeOfDay{Hour: 10}
+
+	err := i18n.Load("./../../locales")
+	if err != nil {
+		log.Fatal("cannot load translations")
+	}
 
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
@@ -73,7 +106,13 @@ func TestMain(m *testing.M) {
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
 
+	err = repo.LoadExchangeRates()
+	if err != nil {
+		log.Fatal("cannot load exchange rates")
+	}
+
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
@@ -86,6 +125,14 @@ func listenForMail() {
 	}()
 }
 
+func listenForEvents() {
+	go func() {
+		for {
+			_ = <-app.EventChan
+		}
+	}()
+}
+
 func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -103,10 +150,33 @@ func getRoutes() http.Handler {
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
 
 	mux.Get("/contact", Repo.Contact)
+	mux.Post("/currency", Repo.PostCurrency)
 
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
+	mux.Post("/choose-rooms", Repo.ChooseRooms)
+	mux.Get("/make-booking", Repo.MakeBooking)
+	mux.Post("/make-booking", Repo.PostMakeBooking)
+	mux.Get("/booking-summary", Repo.BookingSummary)
+	mux.Get("/waitlist", Repo.Waitlist)
+	mux.Post("/waitlist", Repo.PostWaitlist)
+	mux.Get("/waitlist/{token}", Repo.ClaimWaitlistOffer)
+
+	mux.Get("/ical/{token}.ics", Repo.RoomCalendarFeed)
+
+	mux.Get("/api/openapi.json", Repo.OpenAPI)
+	mux.Route("/api/v1", func(mux chi.Router) {
+		mux.NotFound(Repo.APINotFound)
+		mux.MethodNotAllowed(Repo.APIMethodNotAllowed)
+
+		mux.Get("/rooms", Repo.APIListRooms)
+		mux.Get("/rooms/{id}", Repo.APIGetRoom)
+		mux.Get("/availability", Repo.APIAvailability)
+		mux.Post("/reservations", Repo.APICreateReservation)
+		mux.Get("/reservations/{id}", Repo.APIGetReservation)
+		mux.Post("/reservations/{id}/cancel", Repo.APICancelReservation)
+	})
 
 	// Login
 	mux.Get("/user/login", Repo.ShowLogin)
@@ -121,10 +191,62 @@ func getRoutes() http.Handler {
 	mux.Post("/admin/reservations-calendar", Repo.AdminPostCalendarReservations)
 	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
 	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
+	mux.Get("/admin/cancel-reservation/{src}/{id}/do", Repo.AdminCancelReservation)
 
 	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
 	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
 
+	mux.Get("/admin/calendar-feeds", Repo.AdminCalendarFeeds)
+	mux.Post("/admin/calendar-feeds/{id}/rotate", Repo.AdminRotateCalendarFeed)
+
+	mux.Get("/admin/external-calendars", Repo.AdminExternalCalendars)
+	mux.Post("/admin/external-calendars", Repo.AdminPostExternalCalendar)
+	mux.Post("/admin/external-calendars/{id}/sync", Repo.AdminSyncExternalCalendar)
+	mux.Post("/admin/external-calendars/{id}/delete", Repo.AdminDeleteExternalCalendar)
+
+	mux.Get("/admin/api-tokens", Repo.AdminAPITokens)
+	mux.Post("/admin/api-tokens", Repo.AdminPostAPIToken)
+	mux.Post("/admin/api-tokens/{id}/delete", Repo.AdminDeleteAPIToken)
+
+	mux.Get("/admin/bookings", Repo.AdminBookings)
+	mux.Get("/admin/bookings/{id}", Repo.AdminShowBooking)
+	mux.Post("/admin/bookings/{id}/cancel", Repo.AdminCancelBooking)
+	mux.Post("/admin/bookings/{id}/rooms/{reservation_id}/cancel", Repo.AdminCancelBookingRoom)
+	mux.Get("/admin/waitlist", Repo.AdminWaitlist)
+	mux.Post("/admin/waitlist/{id}/delete", Repo.AdminDeleteWaitlistEntry)
+	mux.Get("/admin/rooms", Repo.AdminRooms)
+	mux.Post("/admin/rooms/{id}/rate", Repo.AdminPostRoomRate)
+	mux.Post("/admin/rooms/{id}/occupancy", Repo.AdminPostRoomOccupancy)
+	mux.Post("/admin/rooms/{id}/cancellation-policy", Repo.AdminPostRoomCancellationPolicy)
+	mux.Get("/admin/cancellation-policies", Repo.AdminCancellationPolicies)
+	mux.Post("/admin/cancellation-policies", Repo.AdminPostCancellationPolicy)
+	mux.Post("/admin/reservations/{id}/folio/charges", Repo.AdminPostFolioCharge)
+	mux.Post("/admin/reservations/{id}/folio/payments", Repo.AdminPostFolioPayment)
+	mux.Get("/admin/balances", Repo.AdminBalances)
+	mux.Get("/admin/reservations/{id}/invoice.pdf", Repo.AdminReservationInvoice)
+	mux.Post("/admin/reservations/{id}/checkout-email", Repo.AdminPostCheckoutEmail)
+	mux.Post("/admin/payments/{id}/capture", Repo.AdminPostPaymentCapture)
+	mux.Post("/admin/payments/{id}/void", Repo.AdminPostPaymentVoid)
+	mux.Post("/admin/payments/{id}/refund", Repo.AdminPostPaymentRefund)
+	mux.Get("/admin/taxes", Repo.AdminTaxes)
+	mux.Post("/admin/taxes", Repo.AdminPostTax)
+	mux.Post("/admin/taxes/{id}/active", Repo.AdminPostTaxActive)
+	mux.Get("/admin/currencies", Repo.AdminCurrencies)
+	mux.Post("/admin/currencies", Repo.AdminPostExchangeRate)
+	mux.Post("/admin/currencies/import", Repo.AdminPostImportExchangeRates)
+	mux.Post("/admin/currencies/{id}/delete", Repo.AdminPostDeleteExchangeRate)
+	mux.Get("/admin/promo-codes", Repo.AdminPromoCodes)
+	mux.Post("/admin/promo-codes", Repo.AdminPostPromoCode)
+	mux.Get("/admin/promo-codes/{id}", Repo.AdminShowPromoCode)
+	mux.Post("/admin/promo-codes/{id}/active", Repo.AdminPostPromoCodeActive)
+	mux.Get("/admin/stay-rules", Repo.AdminStayRules)
+	mux.Post("/admin/stay-rules", Repo.AdminPostStayRule)
+	mux.Post("/admin/stay-rules/{id}/delete", Repo.AdminDeleteStayRule)
+	mux.Get("/admin/webhooks", Repo.AdminWebhooks)
+	mux.Post("/admin/webhooks", Repo.AdminPostWebhook)
+	mux.Post("/admin/webhooks/{id}/delete", Repo.AdminDeleteWebhook)
+	mux.Get("/admin/webhooks/{id}/deliveries", Repo.AdminWebhookDeliveries)
+
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
 
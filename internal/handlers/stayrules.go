@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+	"github.com/tsawler/bookings-app/internal/stayrules"
+)
+
+// restrictedRoom is a free room that the stay rules don't allow for the searched dates
+type restrictedRoom struct {
+	Room    models.Room
+	Reasons []i18n.Message
+}
+
+// stayRuleReasons returns why the stay rules don't allow booking a room for the dates, if they don't
+func (m *Repository) stayRuleReasons(roomId int, start, end time.Time) ([]i18n.Message, error) {
+	rules, err := m.DB.GetStayRules(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return stayrules.Check(rules, roomId, start, end, m.now()), nil
+}
+
+// applyStayRules splits free rooms into those that can be booked for the dates and those that can't
+func (m *Repository) applyStayRules(rooms []models.Room, start, end time.Time) ([]models.Room, []restrictedRoom, error) {
+	if len(rooms) == 0 {
+		return rooms, nil, nil
+	}
+
+	rules, err := m.DB.GetStayRules(start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bookable []models.Room
+	var restricted []restrictedRoom
+	now := m.now()
+
+	for _, room := range rooms {
+		reasons := stayrules.Check(rules, room.ID, start, end, now)
+		if len(reasons) > 0 {
+			restricted = append(restricted, restrictedRoom{Room: room, Reasons: reasons})
+			continue
+		}
+		bookable = append(bookable, room)
+	}
+
+	return bookable, restricted, nil
+}
+
+// stayRulesMessage explains to a guest in their language why a room can't be booked
+func stayRulesMessage(roomName string, reasons []i18n.Message, locale string) string {
+	if roomName == "" {
+		roomName = i18n.T(locale, "The room")
+	}
+	return i18n.T(locale, "%s can't be booked for these dates: %s", roomName, strings.Join(messagesIn(reasons, locale), "; "))
+}
+
+// messagesIn translates messages into a locale
+func messagesIn(messages []i18n.Message, locale string) []string {
+	var s []string
+	for _, m := range messages {
+		s = append(s, m.In(locale))
+	}
+	return s
+}
+
+// AdminStayRules lists the stay rules and the form to add one
+func (m *Repository) AdminStayRules(w http.ResponseWriter, r *http.Request) {
+	m.renderStayRules(w, r, forms.New(nil))
+}
+
+// AdminPostStayRule adds a stay rule for a room and date range
+func (m *Repository) AdminPostStayRule(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "start_date", "end_date")
+
+	roomId, err := strconv.Atoi(form.Get("room_id"))
+	if err != nil {
+		form.Errors.Add("room_id", "Choose a room")
+	}
+
+	// a rule may cover a single day, so the range is inclusive
+	startDate, err := time.Parse(apiDateLayout, form.Get("start_date"))
+	if err != nil {
+		form.Errors.Add("start_date", "Must be a date in YYYY-MM-DD format")
+	}
+	endDate, err2 := time.Parse(apiDateLayout, form.Get("end_date"))
+	if err2 != nil {
+		form.Errors.Add("end_date", "Must be a date in YYYY-MM-DD format")
+	}
+	if err == nil && err2 == nil && endDate.Before(startDate) {
+		form.Errors.Add("end_date", "Must not be before the start date")
+	}
+
+	rule := models.StayRule{
+		RoomID:            roomId,
+		StartDate:         startDate,
+		EndDate:           endDate,
+		MinNights:         stayRuleNumber(form, "min_nights"),
+		MaxNights:         stayRuleNumber(form, "max_nights"),
+		ClosedToArrival:   form.Has("closed_to_arrival"),
+		ClosedToDeparture: form.Has("closed_to_departure"),
+		MinAdvanceDays:    stayRuleNumber(form, "min_advance_days"),
+		MaxAdvanceDays:    stayRuleNumber(form, "max_advance_days"),
+	}
+
+	if rule.MaxNights > 0 && rule.MaxNights < rule.MinNights {
+		form.Errors.Add("max_nights", "Must be at least the minimum stay")
+	}
+	if rule.MaxAdvanceDays > 0 && rule.MaxAdvanceDays < rule.MinAdvanceDays {
+		form.Errors.Add("max_advance_days", "Must be at least the minimum notice")
+	}
+	if rule.MinNights == 0 && rule.MaxNights == 0 && rule.MinAdvanceDays == 0 && rule.MaxAdvanceDays == 0 &&
+		!rule.ClosedToArrival && !rule.ClosedToDeparture {
+		form.Errors.Add("rule", "Set at least one restriction")
+	}
+
+	if !form.Valid() {
+		m.renderStayRules(w, r, form)
+		return
+	}
+
+	_, err = m.DB.InsertStayRule(rule)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule added")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// AdminDeleteStayRule removes a stay rule
+func (m *Repository) AdminDeleteStayRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteStayRule(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Stay rule removed")
+	http.Redirect(w, r, "/admin/stay-rules", http.StatusSeeOther)
+}
+
+// stayRuleNumber reads an optional count of nights or days, where blank means no limit
+func stayRuleNumber(form *forms.Form, field string) int {
+	if form.Get(field) == "" {
+		return 0
+	}
+
+	n, err := strconv.Atoi(form.Get(field))
+	if err != nil || n < 0 {
+		form.Errors.Add(field, "Enter a whole number, or leave blank for no limit")
+		return 0
+	}
+
+	return n
+}
+
+func (m *Repository) renderStayRules(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rules, err := m.DB.AllStayRules()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rules"] = rules
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-stay-rules.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
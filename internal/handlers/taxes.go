@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+	"github.com/tsawler/bookings-app/internal/taxes"
+)
+
+// applyTaxes works out the taxes and fees on a priced reservation from the rules in force
+func (m *Repository) applyTaxes(res *models.Reservation) error {
+	rules, err := m.DB.AllTaxes()
+	if err != nil {
+		return err
+	}
+
+	taxes.Apply(rules, res)
+
+	return nil
+}
+
+// AdminTaxes lists the taxes and fees, and the form to add one
+func (m *Repository) AdminTaxes(w http.ResponseWriter, r *http.Request) {
+	m.renderTaxes(w, r, forms.New(nil))
+}
+
+// AdminPostTax adds a tax or fee. Reservations keep the taxes they were booked with, so
+// changing a rate means adding a new tax and switching the old one off.
+func (m *Repository) AdminPostTax(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "kind", "basis", "per", "amount")
+
+	t := models.Tax{
+		Name:          strings.TrimSpace(form.Get("name")),
+		Kind:          form.Get("kind"),
+		Basis:         form.Get("basis"),
+		Per:           form.Get("per"),
+		Inclusive:     form.Get("inclusive") == "1",
+		EffectiveFrom: promoDate(form, "effective_from"),
+		EffectiveTo:   promoDate(form, "effective_to"),
+		Active:        true,
+	}
+
+	if form.Get("room_id") != "" {
+		t.RoomID, err = strconv.Atoi(form.Get("room_id"))
+		if err != nil {
+			form.Errors.Add("room_id", "Choose a room")
+		}
+	}
+
+	if t.Kind != taxes.Tax && t.Kind != taxes.Fee {
+		form.Errors.Add("kind", "Choose a tax or a fee")
+	}
+
+	switch t.Per {
+	case taxes.PerNight, taxes.PerStay, taxes.PerGuest:
+	default:
+		form.Errors.Add("per", "Choose what it is charged for")
+	}
+
+	switch t.Basis {
+	case taxes.Percent:
+		// hundredths of a percent read just like cents
+		t.Amount, err = parseCents(form.Get("amount"))
+		if err != nil || t.Amount < 1 || t.Amount > 10000 {
+			form.Errors.Add("amount", "Enter a percentage such as 10 or 12.5")
+		}
+		if t.Per == taxes.PerGuest {
+			form.Errors.Add("per", "A percentage is of the price, so it can't be charged per guest")
+		}
+	case taxes.Flat:
+		t.Amount, err = parseCents(form.Get("amount"))
+		if err != nil || t.Amount < 1 {
+			form.Errors.Add("amount", "Enter an amount such as 25 or 25.50")
+		}
+	default:
+		form.Errors.Add("basis", "Choose a percentage or a flat amount")
+	}
+
+	if !t.EffectiveFrom.IsZero() && !t.EffectiveTo.IsZero() && t.EffectiveTo.Before(t.EffectiveFrom) {
+		form.Errors.Add("effective_to", "Must not be before the start date")
+	}
+
+	if !form.Valid() {
+		m.renderTaxes(w, r, form)
+		return
+	}
+
+	_, err = m.DB.InsertTax(t)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Tax added")
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
+
+// AdminPostTaxActive switches a tax or fee on or off for new reservations
+func (m *Repository) AdminPostTaxActive(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	active := r.Form.Get("active") == "1"
+
+	err = m.DB.UpdateTaxActive(id, active)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if active {
+		m.App.Session.Put(r.Context(), "flash", "Tax activated")
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Tax deactivated")
+	}
+	http.Redirect(w, r, "/admin/taxes", http.StatusSeeOther)
+}
+
+func (m *Repository) renderTaxes(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	rules, err := m.DB.AllTaxes()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	descriptions := make(map[int]string)
+	for _, t := range rules {
+		descriptions[t.ID] = taxes.Describe(t, m.App.Currencies.Base())
+	}
+
+	data := make(map[string]interface{})
+	data["taxes"] = rules
+	data["descriptions"] = descriptions
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-taxes.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+)
+
+// Waitlist shows the form to join the waitlist, filled in from a search that found nothing
+func (m *Repository) Waitlist(w http.ResponseWriter, r *http.Request) {
+	m.renderWaitlist(w, r, forms.New(r.URL.Query()), http.StatusOK)
+}
+
+// PostWaitlist adds a guest to the waitlist for a date range and, optionally, a room
+func (m *Repository) PostWaitlist(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.NewLocalized(r.PostForm, i18n.FromContext(r.Context()))
+	form.Required("name", "email", "start", "end")
+	form.IsEmail("email")
+
+	startDate, endDate := m.parseStayDates(form, "start", "end")
+	adults, children := parseGuests(form)
+
+	roomId := 0
+	if form.Get("room_id") != "" {
+		roomId, err = strconv.Atoi(form.Get("room_id"))
+		if err != nil || roomId < 0 {
+			form.Errors.Add("room_id", form.T("Choose a room"))
+		}
+	}
+
+	if !form.Valid() {
+		m.renderWaitlist(w, r, form, http.StatusSeeOther)
+		return
+	}
+
+	_, err = m.DB.InsertWaitlistEntry(models.WaitlistEntry{
+		Name:      form.Get("name"),
+		Email:     form.Get("email"),
+		RoomID:    roomId,
+		StartDate: startDate,
+		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
+		Locale:    form.Locale,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "You're on the waitlist. We'll email you a booking link if a room frees up")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// ClaimWaitlistOffer follows the booking link emailed to a waitlisted guest, holding
+// the offered room and taking them to the reservation form. The offer is only used up
+// once the reservation is made, so a guest who leaves the form can follow the link again.
+func (m *Repository) ClaimWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	entry, err := m.DB.GetWaitlistEntryByTokenHash(helpers.HashToken(chi.URLParam(r, "token")))
+	if err != nil || !entry.ClaimedAt.IsZero() || !entry.OfferExpiresAt.After(time.Now()) {
+		m.App.Session.Put(r.Context(), "error", "Sorry, this booking link has expired or was already used")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomId(entry.StartDate, entry.EndDate, entry.OfferedRoomID)
+	if err != nil || !available {
+		m.App.Session.Put(r.Context(), "error", "Sorry, the room was booked by someone else in the meantime")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	res := models.Reservation{
+		Email:     entry.Email,
+		StartDate: entry.StartDate,
+		EndDate:   entry.EndDate,
+		RoomID:    entry.OfferedRoomID,
+		Adults:    entry.Adults,
+		Children:  entry.Children,
+		Room:      entry.OfferedRoom,
+	}
+
+	m.App.Session.Put(r.Context(), "reservation", res)
+	m.App.Session.Put(r.Context(), "waitlist_entry_id", entry.ID)
+	m.placeHold(r, res)
+
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// claimWaitlistEntry uses up the waitlist offer the guest followed once their reservation
+// is stored. Reservations for other rooms or dates leave the offer as it was.
+func (m *Repository) claimWaitlistEntry(r *http.Request, res models.Reservation) {
+	id := m.App.Session.PopInt(r.Context(), "waitlist_entry_id")
+	if id == 0 {
+		return
+	}
+
+	_, err := m.DB.ClaimWaitlistEntry(id, res)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// ReofferExpiredWaitlistOffers passes the rooms of booking links that expired unused on to the
+// next waitlisted guest who can have them. The guest who let the link expire has had their turn.
+func (m *Repository) ReofferExpiredWaitlistOffers() {
+	lapsed, err := m.DB.ExpireWaitlistOffers(time.Now())
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	for _, e := range lapsed {
+		if e.OfferedRoomID > 0 {
+			m.offerWaitlist(e.OfferedRoomID, e.StartDate, e.EndDate)
+		}
+	}
+}
+
+// offerWaitlist emails a booking link for a room whose dates were just freed to the
+// earliest waitlisted guest who can now have it
+func (m *Repository) offerWaitlist(roomId int, start, end time.Time) {
+	entries, err := m.DB.GetWaitlistCandidates(roomId, start, end)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	room, err := m.DB.GetRoomById(roomId)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	for _, e := range entries {
+		if room.MaxOccupancy > 0 && e.Adults+e.Children > room.MaxOccupancy {
+			continue
+		}
+
+		// the freed dates may only cover part of the stay the guest is waiting for
+		available, err := m.DB.SearchAvailabilityByDatesByRoomId(e.StartDate, e.EndDate, roomId)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+		if !available {
+			continue
+		}
+
+		token, err := helpers.GenerateToken(24)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+
+		expiresAt := time.Now().Add(m.App.WaitlistOfferTTL)
+
+		err = m.DB.OfferWaitlistEntry(e.ID, roomId, helpers.HashToken(token), expiresAt)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+			return
+		}
+
+		m.sendWaitlistOffer(e, room, m.App.BaseURL+"/waitlist/"+token, expiresAt)
+		return
+	}
+}
+
+// offerWaitlistForReservation offers the dates of a cancelled or deleted reservation to the waitlist
+func (m *Repository) offerWaitlistForReservation(res models.Reservation) {
+	m.offerWaitlist(res.RoomID, res.StartDate, res.EndDate)
+}
+
+// sendWaitlistOffer emails a waitlisted guest the link to book the room that freed up
+func (m *Repository) sendWaitlistOffer(e models.WaitlistEntry, room models.Room, link string, expiresAt time.Time) {
+	l := e.Locale
+
+	htmlMsg := fmt.Sprintf(`
+		<strong>%s</strong><br>
+		%s <br>
+		%s<br>
+		%s
+	`,
+		i18n.T(l, "A room is available"),
+		i18n.T(l, "Dear %s:", e.Name),
+		i18n.T(l, "%s is now available from %s to %s.", room.RoomName, i18n.Date(e.StartDate, l), i18n.Date(e.EndDate, l)),
+		i18n.T(l, `<a href="%s">Book it here</a> before %s, after which the link stops working.`,
+			link, i18n.Date(expiresAt, l)+expiresAt.Format(" 15:04")),
+	)
+
+	msg := models.MailData{
+		To:       e.Email,
+		From:     m.App.MailFrom,
+		Subject:  i18n.T(l, "A room is available for your dates"),
+		Content:  htmlMsg,
+		Template: "base.html",
+	}
+
+	m.App.MailChan <- msg
+}
+
+// waitlistURL returns the link to join the waitlist for a search that found nothing
+func waitlistURL(start, end time.Time, adults, children int) string {
+	q := url.Values{}
+	q.Set("start", start.Format(apiDateLayout))
+	q.Set("end", end.Format(apiDateLayout))
+	q.Set("adults", strconv.Itoa(adults))
+	q.Set("children", strconv.Itoa(children))
+
+	return "/waitlist?" + q.Encode()
+}
+
+func (m *Repository) renderWaitlist(w http.ResponseWriter, r *http.Request, form *forms.Form, status int) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+
+	// like the reservation form, an invalid post re-renders with a 303 status
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	render.Template(w, r, "waitlist.page.tmpl", &models.TemplateData{
+		Form: form,
+		Data: data,
+	})
+}
+
+// AdminWaitlist lists the guests on the waitlist and any offers they were sent
+func (m *Repository) AdminWaitlist(w http.ResponseWriter, r *http.Request) {
+	entries, err := m.DB.AllWaitlistEntries()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["entries"] = entries
+
+	render.Template(w, r, "admin-waitlist.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminDeleteWaitlistEntry removes a guest from the waitlist
+func (m *Repository) AdminDeleteWaitlistEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteWaitlistEntry(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Waitlist entry removed")
+	http.Redirect(w, r, "/admin/waitlist", http.StatusSeeOther)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/tsawler/bookings-app/internal/forms"
+	"github.com/tsawler/bookings-app/internal/helpers"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/render"
+	"github.com/tsawler/bookings-app/internal/webhooks"
+)
+
+// apiBlock is the webhook payload for an owner block
+type apiBlock struct {
+	ID     int    `json:"id,omitempty"`
+	RoomID int    `json:"room_id"`
+	Date   string `json:"date"`
+}
+
+// fireEvent queues an event for the webhooks subscribed to it. When the queue is full the
+// event is stored for delivery straight away, so the request doesn't wait for room in it.
+func (m *Repository) fireEvent(event string, data interface{}) {
+	if m.App.EventChan == nil {
+		return
+	}
+
+	e := models.WebhookEvent{
+		Event:      event,
+		Data:       data,
+		OccurredAt: time.Now(),
+	}
+
+	select {
+	case m.App.EventChan <- e:
+	default:
+		err := webhooks.New(m.DB).Enqueue(e)
+		if err != nil {
+			m.App.ErrorLog.Println(err)
+		}
+	}
+}
+
+// fireReservationEvent reloads a reservation and fires an event carrying its current state
+func (m *Repository) fireReservationEvent(event string, id int) {
+	res, err := m.DB.GetReservationById(id)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		return
+	}
+
+	m.fireEvent(event, toAPIReservation(res))
+}
+
+// AdminWebhooks lists the registered webhooks, showing a new webhook's secret once
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	m.renderWebhooks(w, r, forms.New(nil))
+}
+
+// AdminPostWebhook registers a webhook
+func (m *Repository) AdminPostWebhook(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+	form.IsURL("url")
+
+	var events []string
+	for _, e := range webhooks.Events {
+		if form.Has("event_" + e) {
+			events = append(events, e)
+		}
+	}
+	if len(events) == 0 {
+		form.Errors.Add("events", "Choose at least one event")
+	}
+
+	if !form.Valid() {
+		m.renderWebhooks(w, r, form)
+		return
+	}
+
+	secret, err := helpers.GenerateToken(24)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	secret = "whsec_" + secret
+
+	_, err = m.DB.InsertWebhook(models.Webhook{
+		URL:    r.Form.Get("url"),
+		Secret: secret,
+		Events: events,
+		Active: true,
+	})
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "new_webhook_secret", secret)
+	m.App.Session.Put(r.Context(), "flash", "Webhook added")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminDeleteWebhook removes a webhook and its delivery log
+func (m *Repository) AdminDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.DB.DeleteWebhook(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook removed")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminWebhookDeliveries shows the recent delivery log for a webhook
+func (m *Repository) AdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	hook, err := m.DB.GetWebhookById(id)
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	deliveries, err := m.DB.GetWebhookDeliveries(id, 100)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhook"] = hook
+	data["deliveries"] = deliveries
+
+	render.Template(w, r, "admin-webhook-deliveries.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+func (m *Repository) renderWebhooks(w http.ResponseWriter, r *http.Request, form *forms.Form) {
+	hooks, err := m.DB.AllWebhooks()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["webhooks"] = hooks
+	data["events"] = webhooks.Events
+
+	stringMap := make(map[string]string)
+	stringMap["new_secret"] = m.App.Session.PopString(r.Context(), "new_webhook_secret")
+	stringMap["events"] = strings.Join(webhooks.Events, ", ")
+
+	render.Template(w, r, "admin-webhooks.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      form,
+	})
+}
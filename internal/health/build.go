@@ -0,0 +1,57 @@
+package health
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Version, Commit and BuildTime describe the build. They are set when building, with
+//
+//	go build -ldflags "-X github.com/tsawler/bookings-app/internal/health.Version=1.4.0 ..."
+//
+// and otherwise the commit is taken from what the go tool records of the repository the
+// binary was built from.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// BuildInfo is the metadata of the running build
+type BuildInfo struct {
+	Version    string `json:"version"`
+	Commit     string `json:"commit,omitempty"`
+	CommitTime string `json:"commit_time,omitempty"`
+	Modified   bool   `json:"modified,omitempty"`
+	BuildTime  string `json:"build_time,omitempty"`
+	GoVersion  string `json:"go_version"`
+}
+
+// Build returns the metadata of the running build
+func Build() BuildInfo {
+	b := BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	// a commit set when building wins over the one the go tool recorded
+	info, ok := debug.ReadBuildInfo()
+	if !ok || b.Commit != "" {
+		return b
+	}
+
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Commit = s.Value
+		case "vcs.time":
+			b.CommitTime = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,123 @@
+// Package health reports whether the application is ready to serve requests, by running
+// checks on what it depends on, and which build of it is running.
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Check is something the application needs before it can serve requests, such as the database
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Result is how a check went
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report is how all the checks went; its status is ok only when every check is
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready reports whether every check passed
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Run runs the checks at the same time, giving up on any still running after timeout
+func Run(ctx context.Context, timeout time.Duration, checks ...Check) Report {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c Check) {
+			defer wg.Done()
+
+			result := run(ctx, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[c.Name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFailing
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// run runs one check, returning when it is done or ctx is
+func run(ctx context.Context, c Check) Result {
+	start := time.Now()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out: %w", ctx.Err())
+	}
+
+	result := Result{Status: StatusOK, Duration: time.Since(start).Round(time.Microsecond).String()}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// migrationFile matches the up migrations in the migrations folder, such as
+// 20261020040000_add_check_in_and_out_times_to_reservations.up.fizz
+var migrationFile = regexp.MustCompile(`^(\d{14})_.+\.up\.(fizz|sql)$`)
+
+// LatestMigration returns the version of the newest migration in dir, such as 20261020040000,
+// which the database has to be migrated to
+func LatestMigration(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	for _, e := range entries {
+		m := migrationFile.FindStringSubmatch(e.Name())
+		if m != nil && m[1] > latest {
+			latest = m[1]
+		}
+	}
+
+	if latest == "" {
+		return "", fmt.Errorf("no migrations in %s", filepath.Clean(dir))
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,84 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	ok := Check{Name: "ok", Run: func(ctx context.Context) error { return nil }}
+	broken := Check{Name: "broken", Run: func(ctx context.Context) error { return errors.New("no connection") }}
+	slow := Check{Name: "slow", Run: func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}}
+
+	report := Run(context.Background(), time.Second, ok)
+	if !report.Ready() || report.Checks["ok"].Status != StatusOK {
+		t.Errorf("expected ready but got %+v", report)
+	}
+
+	report = Run(context.Background(), 50*time.Millisecond, ok, broken, slow)
+	if report.Ready() {
+		t.Error("expected not ready")
+	}
+
+	var tests = []struct {
+		name   string
+		status string
+	}{
+		{"ok", StatusOK},
+		{"broken", StatusFailing},
+		{"slow", StatusFailing},
+	}
+
+	for _, e := range tests {
+		if got := report.Checks[e.name]; got.Status != e.status {
+			t.Errorf("%s: expected %s but got %+v", e.name, e.status, got)
+		}
+	}
+
+	if report.Checks["broken"].Error != "no connection" {
+		t.Errorf("expected the error to be reported but got %+v", report.Checks["broken"])
+	}
+}
+
+func TestLatestMigration(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{
+		"20240220173120_create_user_table.up.fizz",
+		"20240220173120_create_user_table.down.fizz",
+		"20261020040000_add_times.up.fizz",
+		"20991231000000_later.down.fizz",
+		"schema.sql",
+	} {
+		err := os.WriteFile(filepath.Join(dir, name), nil, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := LatestMigration(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "20261020040000" {
+		t.Errorf("expected 20261020040000 but got %s", got)
+	}
+
+	_, err = LatestMigration(t.TempDir())
+	if err == nil {
+		t.Error("expected an error for a folder without migrations")
+	}
+
+	// the repository's own migrations
+	_, err = LatestMigration("./../../migrations")
+	if err != nil {
+		t.Error(err)
+	}
+}
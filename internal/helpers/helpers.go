@@ -1,15 +1,25 @@
 package helpers
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/models"
 )
 
 var app *config.AppConfig
 
+type contextKey string
+
+const apiTokenKey contextKey = "api_token"
+
 // NewHelpers sets up app config for helpers
 func NewHelpers(a *config.AppConfig) {
 	app = a
@@ -31,3 +41,58 @@ func IsAuthenticated(r *http.Request) bool {
 
 	return exists
 }
+
+// GenerateToken returns a random hex encoded token built from n random bytes
+func GenerateToken(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// codeAlphabet leaves out characters that are easily confused when read out, like 0/O and 1/I
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// GenerateCode returns a random code of n characters that is easy to read out and type
+func GenerateCode(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	for i := range b {
+		b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+	}
+
+	return string(b), nil
+}
+
+// HashToken returns the hex encoded sha256 hash of a token, as stored in the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// BearerToken returns the token from an Authorization: Bearer header, if any
+func BearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
+
+// WithAPIToken returns a copy of ctx carrying the authenticated api token
+func WithAPIToken(ctx context.Context, t models.APIToken) context.Context {
+	return context.WithValue(ctx, apiTokenKey, t)
+}
+
+// APIToken returns the api token the request was authenticated with, if any
+func APIToken(r *http.Request) (models.APIToken, bool) {
+	t, ok := r.Context().Value(apiTokenKey).(models.APIToken)
+	return t, ok
+}
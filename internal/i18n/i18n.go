@@ -0,0 +1,285 @@
+// Package i18n translates the text guests see into their language. Messages are looked up
+// by their English text in catalogs loaded at startup, one JSON file per locale, so text
+// without a translation is shown in English.
+package i18n
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the locale text is written in, and used when no other is wanted
+const Default = "en"
+
+// Cookie and Query are where a guest's choice of language is kept and changed
+const (
+	Cookie = "lang"
+	Query  = "lang"
+)
+
+// names are the languages as their speakers write them, for choosing between them
+var names = map[string]string{
+	"de": "Deutsch",
+	"en": "English",
+	"es": "Español",
+	"fr": "Français",
+	"it": "Italiano",
+	"ja": "日本語",
+	"pt": "Português",
+	"zh": "中文",
+}
+
+// catalogs holds the translations of each locale, keyed by the English text. It is filled
+// by Load at startup and only read afterwards.
+var catalogs = map[string]map[string]string{}
+
+// Load reads the catalogs in a directory, such as ./locales/de.json, replacing any loaded
+// before. Each file is an object of English text to its translation.
+func Load(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]map[string]string)
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var catalog map[string]string
+		err = json.Unmarshal(data, &catalog)
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+
+		locale := strings.ToLower(strings.TrimSuffix(filepath.Base(file), ".json"))
+		loaded[locale] = catalog
+	}
+
+	catalogs = loaded
+
+	return nil
+}
+
+// Supported returns the locales text can be shown in, English first
+func Supported() []string {
+	var locales []string
+	for locale := range catalogs {
+		if locale != Default {
+			locales = append(locales, locale)
+		}
+	}
+	sort.Strings(locales)
+
+	return append([]string{Default}, locales...)
+}
+
+// Name returns a locale's language as its speakers write it, such as Deutsch
+func Name(locale string) string {
+	if name, ok := names[locale]; ok {
+		return name
+	}
+	return locale
+}
+
+// T translates English text into a locale, formatting it with any arguments like
+// fmt.Sprintf. Text without a translation is kept in English.
+func T(locale, text string, args ...interface{}) string {
+	if s, ok := catalogs[locale][text]; ok && s != "" {
+		text = s
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Message is text to translate later, when the locale it is shown in is known, such as a
+// reason worked out before it is known who reads it. Arguments that are messages are
+// translated too, and dates are written the way the locale writes them.
+type Message struct {
+	Text string
+	Args []interface{}
+}
+
+// M returns a message of English text, formatted with any arguments like fmt.Sprintf
+func M(text string, args ...interface{}) Message {
+	return Message{Text: text, Args: args}
+}
+
+// In translates a message into a locale
+func (m Message) In(locale string) string {
+	args := make([]interface{}, len(m.Args))
+	for i, arg := range m.Args {
+		switch a := arg.(type) {
+		case Message:
+			args[i] = a.In(locale)
+		case time.Time:
+			args[i] = Date(a, locale)
+		default:
+			args[i] = arg
+		}
+	}
+	return T(locale, m.Text, args...)
+}
+
+// String writes a message in English
+func (m Message) String() string {
+	return m.In(Default)
+}
+
+// Match returns the supported locale for a language tag such as de-AT or fr_CA, or an
+// empty string when there is none
+func Match(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(strings.Replace(tag, "_", "-", -1)))
+	if tag == "" {
+		return ""
+	}
+
+	lang := strings.SplitN(tag, "-", 2)[0]
+	if lang == Default {
+		return Default
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag
+	}
+	if _, ok := catalogs[lang]; ok {
+		return lang
+	}
+
+	return ""
+}
+
+// Negotiate picks the locale for a request: the one asked for in the query string, then
+// the one kept in the cookie, then the most preferred in the Accept-Language header that
+// is supported, and English otherwise
+func Negotiate(r *http.Request) string {
+	if locale := Match(r.URL.Query().Get(Query)); locale != "" {
+		return locale
+	}
+
+	if c, err := r.Cookie(Cookie); err == nil {
+		if locale := Match(c.Value); locale != "" {
+			return locale
+		}
+	}
+
+	if locale := acceptLanguage(r.Header.Get("Accept-Language")); locale != "" {
+		return locale
+	}
+
+	return Default
+}
+
+// acceptLanguage returns the supported locale a guest's browser prefers most, reading a
+// header such as "fr-CH, fr;q=0.9, en;q=0.8"
+func acceptLanguage(header string) string {
+	type choice struct {
+		locale string
+		q      float64
+	}
+
+	var choices []choice
+
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if locale := Match(fields[0]); locale != "" && q > 0 {
+			choices = append(choices, choice{locale, q})
+		}
+	}
+
+	if len(choices) == 0 {
+		return ""
+	}
+
+	sort.SliceStable(choices, func(i, j int) bool {
+		return choices[i].q > choices[j].q
+	})
+
+	return choices[0].locale
+}
+
+type contextKey struct{}
+
+// WithLocale returns a context carrying the locale of the request
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale of the request, or English if none was negotiated
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return Default
+}
+
+var (
+	months   = []string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"}
+	weekdays = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+)
+
+// Date writes a date the way a locale writes dates, such as 2050-01-31 or 31.01.2050
+func Date(t time.Time, locale string) string {
+	return FormatDate(t, T(locale, "2006-01-02"), locale)
+}
+
+// FormatDate formats a time with a layout as time.Format does, with the names of months
+// and days in a locale. Short names are the first three letters of the name unless the
+// catalog translates them, such as "Mon".
+func FormatDate(t time.Time, layout, locale string) string {
+	var parts []string
+
+	// the names are swapped for markers first, so translated names aren't read as layout
+	var b strings.Builder
+	for i := 0; i < len(layout); {
+		name := ""
+		switch {
+		case strings.HasPrefix(layout[i:], "January"):
+			name, i = T(locale, months[t.Month()-1]), i+len("January")
+		case strings.HasPrefix(layout[i:], "Jan"):
+			name, i = T(locale, months[t.Month()-1][:3]), i+len("Jan")
+		case strings.HasPrefix(layout[i:], "Monday"):
+			name, i = T(locale, weekdays[t.Weekday()]), i+len("Monday")
+		case strings.HasPrefix(layout[i:], "Mon"):
+			name, i = T(locale, weekdays[t.Weekday()][:3]), i+len("Mon")
+		default:
+			b.WriteByte(layout[i])
+			i++
+			continue
+		}
+
+		parts = append(parts, name)
+		b.WriteString("\x00")
+	}
+
+	s := t.Format(b.String())
+	for _, name := range parts {
+		s = strings.Replace(s, "\x00", name, 1)
+	}
+
+	return s
+}
@@ -0,0 +1,194 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadTestCatalogs(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"de.json":   `{"Hello": "Hallo", "%d nights": "%d Nächte", "Arrive on %s for %s": "Anreise am %s für %s", "2006-01-02": "02.01.2006", "March": "März", "Mar": "März", "Tuesday": "Dienstag", "Empty": ""}`,
+		"fr.json":   `{"Hello": "Bonjour"}`,
+		"notes.txt": `not a catalog`,
+	}
+	for name, s := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(s), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	loadTestCatalogs(t)
+
+	if got := strings.Join(Supported(), ","); got != "en,de,fr" {
+		t.Errorf("expected en,de,fr but got %s", got)
+	}
+
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"Hello":`), 0644)
+
+	err := Load(dir)
+	if err == nil {
+		t.Error("expected a broken catalog to fail")
+	}
+	if len(Supported()) != 3 {
+		t.Error("expected a failed load to keep the catalogs")
+	}
+}
+
+func TestT(t *testing.T) {
+	loadTestCatalogs(t)
+
+	var tests = []struct {
+		locale   string
+		text     string
+		args     []interface{}
+		expected string
+	}{
+		{"de", "Hello", nil, "Hallo"},
+		{"fr", "Hello", nil, "Bonjour"},
+		{"en", "Hello", nil, "Hello"},
+		{"de", "Goodbye", nil, "Goodbye"},
+		{"xx", "Hello", nil, "Hello"},
+		{"de", "Empty", nil, "Empty"},
+		{"de", "%d nights", []interface{}{3}, "3 Nächte"},
+		{"fr", "%d nights", []interface{}{3}, "3 nights"},
+		{"de", "100%", nil, "100%"},
+	}
+
+	for _, e := range tests {
+		if got := T(e.locale, e.text, e.args...); got != e.expected {
+			t.Errorf("%s %q: expected %q but got %q", e.locale, e.text, e.expected, got)
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	loadTestCatalogs(t)
+
+	m := M("Arrive on %s for %s", time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC), M("%d nights", 3))
+
+	if got := m.In("de"); got != "Anreise am 01.03.2050 für 3 Nächte" {
+		t.Errorf("expected the message in German but got %q", got)
+	}
+	if got := m.String(); got != "Arrive on 2050-03-01 for 3 nights" {
+		t.Errorf("expected the message in English but got %q", got)
+	}
+	if got := M("Hello").In("fr"); got != "Bonjour" {
+		t.Errorf("expected Bonjour but got %q", got)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	loadTestCatalogs(t)
+
+	var tests = []struct {
+		tag      string
+		expected string
+	}{
+		{"de", "de"},
+		{"de-AT", "de"},
+		{"fr_CA", "fr"},
+		{" FR ", "fr"},
+		{"en-GB", "en"},
+		{"es", ""},
+		{"", ""},
+	}
+
+	for _, e := range tests {
+		if got := Match(e.tag); got != e.expected {
+			t.Errorf("%q: expected %q but got %q", e.tag, e.expected, got)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	loadTestCatalogs(t)
+
+	var tests = []struct {
+		name     string
+		url      string
+		cookie   string
+		header   string
+		expected string
+	}{
+		{"nothing asked", "/", "", "", "en"},
+		{"query", "/?lang=fr", "de", "de", "fr"},
+		{"unknown query", "/?lang=es", "de", "", "de"},
+		{"cookie", "/", "fr", "de", "fr"},
+		{"header", "/", "", "es, fr-CH;q=0.9, de;q=0.7", "fr"},
+		{"header by weight", "/", "", "de;q=0.5, fr;q=0.8", "fr"},
+		{"header refused", "/", "", "de;q=0", "en"},
+		{"header unsupported", "/", "", "es, it", "en"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.url, nil)
+		if e.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: Cookie, Value: e.cookie})
+		}
+		if e.header != "" {
+			req.Header.Set("Accept-Language", e.header)
+		}
+
+		if got := Negotiate(req); got != e.expected {
+			t.Errorf("for %s expected %s but got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if got := FromContext(context.Background()); got != Default {
+		t.Errorf("expected %s but got %s", Default, got)
+	}
+
+	ctx := WithLocale(context.Background(), "de")
+	if got := FromContext(ctx); got != "de" {
+		t.Errorf("expected de but got %s", got)
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	loadTestCatalogs(t)
+
+	d := time.Date(2050, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		layout   string
+		locale   string
+		expected string
+	}{
+		{"Monday, 2 January 2006", "de", "Dienstag, 1 März 2050"},
+		{"Mon 2 Jan", "de", "Tue 1 März"},
+		{"Monday, 2 January 2006", "en", "Tuesday, 1 March 2050"},
+		{"2006-01-02", "fr", "2050-03-01"},
+	}
+
+	for _, e := range tests {
+		if got := FormatDate(d, e.layout, e.locale); got != e.expected {
+			t.Errorf("%q in %s: expected %q but got %q", e.layout, e.locale, e.expected, got)
+		}
+	}
+
+	if got := Date(d, "de"); got != "01.03.2050" {
+		t.Errorf("expected 01.03.2050 but got %q", got)
+	}
+	if got := Date(d, "fr"); got != "2050-03-01" {
+		t.Errorf("expected 2050-03-01 but got %q", got)
+	}
+}
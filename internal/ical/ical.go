@@ -0,0 +1,214 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const dateLayout = "20060102"
+const stampLayout = "20060102T150405Z"
+
+// maxLineLength is the longest content line allowed by RFC 5545, in octets
+const maxLineLength = 75
+
+// Event is a single all-day calendar event
+type Event struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+	Stamp   time.Time
+}
+
+// Write writes the events as an iCalendar (.ics) document
+func Write(w io.Writer, name string, events []Event) error {
+	bw := bufio.NewWriter(w)
+
+	writeLine(bw, "BEGIN:VCALENDAR")
+	writeLine(bw, "VERSION:2.0")
+	writeLine(bw, "PRODID:-//Bookings//Room Availability//EN")
+	writeLine(bw, "CALSCALE:GREGORIAN")
+	writeLine(bw, "METHOD:PUBLISH")
+	writeLine(bw, "X-WR-CALNAME:"+escape(name))
+
+	for _, e := range events {
+		writeLine(bw, "BEGIN:VEVENT")
+		writeLine(bw, "UID:"+escape(e.UID))
+		writeLine(bw, "DTSTAMP:"+e.Stamp.UTC().Format(stampLayout))
+		writeLine(bw, "DTSTART;VALUE=DATE:"+e.Start.Format(dateLayout))
+		writeLine(bw, "DTEND;VALUE=DATE:"+e.End.Format(dateLayout))
+		writeLine(bw, "SUMMARY:"+escape(e.Summary))
+		writeLine(bw, "TRANSP:OPAQUE")
+		writeLine(bw, "END:VEVENT")
+	}
+
+	writeLine(bw, "END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+// writeLine writes a content line, folding it when longer than the RFC limit
+func writeLine(w *bufio.Writer, line string) {
+	for len(line) > maxLineLength {
+		cut := maxLineLength
+		// never split a multi-byte character
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		fmt.Fprintf(w, "%s\r\n", line[:cut])
+		line = " " + line[cut:]
+	}
+	fmt.Fprintf(w, "%s\r\n", line)
+}
+
+// escape escapes text values as required by RFC 5545
+func escape(s string) string {
+	r := strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	)
+	return r.Replace(s)
+}
+
+// Parse reads the events from an iCalendar document. Events without a start
+// date or marked as cancelled are skipped, and events without an end are
+// treated as lasting a single day.
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	cancelled := false
+
+	for _, line := range lines {
+		name, params, value := splitLine(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &Event{}
+			cancelled = false
+		case name == "END" && value == "VEVENT":
+			if current != nil && !current.Start.IsZero() && !cancelled {
+				if current.End.IsZero() || !current.End.After(current.Start) {
+					current.End = current.Start.AddDate(0, 0, 1)
+				}
+				events = append(events, *current)
+			}
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = unescape(value)
+		case name == "SUMMARY":
+			current.Summary = unescape(value)
+		case name == "STATUS":
+			cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			t, err := parseDate(params, value)
+			if err != nil {
+				return nil, err
+			}
+			current.Start = t
+		case name == "DTEND":
+			t, err := parseDate(params, value)
+			if err != nil {
+				return nil, err
+			}
+			current.End = t
+		case name == "DTSTAMP" || name == "LAST-MODIFIED":
+			t, err := time.Parse(stampLayout, value)
+			if err == nil {
+				current.Stamp = t
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// unfold joins folded content lines back together
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// splitLine splits a content line into its name, parameters and value
+func splitLine(line string) (string, map[string]string, string) {
+	params := make(map[string]string)
+
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), params, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = kv[1]
+		}
+	}
+
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+// parseDate parses a DTSTART or DTEND value, keeping only the calendar date
+func parseDate(params map[string]string, value string) (time.Time, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		return time.Parse(dateLayout, value)
+	}
+
+	var t time.Time
+	var err error
+
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse(stampLayout, value)
+	} else {
+		loc := time.UTC
+		if tz, ok := params["TZID"]; ok {
+			if l, lerr := time.LoadLocation(tz); lerr == nil {
+				loc = l
+			}
+		}
+		t, err = time.ParseInLocation("20060102T150405", value, loc)
+	}
+	if err != nil {
+		return t, err
+	}
+
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// unescape reverses escape
+func unescape(s string) string {
+	r := strings.NewReplacer(
+		`\\`, `\`,
+		`\;`, ";",
+		`\,`, ",",
+		`\n`, "\n",
+		`\N`, "\n",
+	)
+	return r.Replace(s)
+}
@@ -0,0 +1,137 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	events := []Event{
+		{
+			UID:     "restriction-1@bookings",
+			Summary: "Reserved",
+			Start:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:     time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC),
+			Stamp:   time.Date(2049, 12, 1, 10, 30, 0, 0, time.UTC),
+		},
+	}
+
+	var buf bytes.Buffer
+	err := Write(&buf, "General's Quarters", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+
+	expected := []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:General's Quarters\r\n",
+		"UID:restriction-1@bookings\r\n",
+		"DTSTAMP:20491201T103000Z\r\n",
+		"DTSTART;VALUE=DATE:20500101\r\n",
+		"DTEND;VALUE=DATE:20500103\r\n",
+		"END:VCALENDAR\r\n",
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(out, e) {
+			t.Errorf("expected output to contain %q", e)
+		}
+	}
+}
+
+func TestWriteLineFolding(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, strings.Repeat("a", 200), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Errorf("line longer than %d octets: %q", maxLineLength, line)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	got := escape("a,b;c\\d\ne")
+	if got != `a\,b\;c\\d\ne` {
+		t.Errorf("unexpected escaped value %q", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc := "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:abc-123@example.com\r\n" +
+		"DTSTART;VALUE=DATE:20500101\r\n" +
+		"DTEND;VALUE=DATE:20500104\r\n" +
+		"SUMMARY:Booked\\, via\r\n" +
+		"  channel\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:def-456@example.com\r\n" +
+		"DTSTART:20500201T150000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:cancelled@example.com\r\n" +
+		"STATUS:CANCELLED\r\n" +
+		"DTSTART;VALUE=DATE:20500301\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	events, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events but got %d", len(events))
+	}
+
+	if events[0].UID != "abc-123@example.com" || events[0].Summary != "Booked, via channel" {
+		t.Errorf("unexpected first event %+v", events[0])
+	}
+
+	if !events[0].End.Equal(time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected end date %s", events[0].End)
+	}
+
+	if !events[1].Start.Equal(time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected start date %s", events[1].Start)
+	}
+
+	if !events[1].End.Equal(time.Date(2050, 2, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("event without end should last one day, got %s", events[1].End)
+	}
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	in := []Event{
+		{
+			UID:     "room-restriction-1@bookings",
+			Summary: "Owner Block",
+			Start:   time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			End:     time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "Room", in); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 1 || out[0].UID != in[0].UID || !out[0].Start.Equal(in[0].Start) || !out[0].End.Equal(in[0].End) {
+		t.Errorf("round trip changed events: %+v", out)
+	}
+}
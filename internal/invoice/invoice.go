@@ -0,0 +1,150 @@
+// Package invoice renders the invoice, or the receipt once it is paid, for a reservation
+// as a PDF document.
+package invoice
+
+import (
+	"fmt"
+
+	"github.com/tsawler/bookings-app/internal/currency"
+	"github.com/tsawler/bookings-app/internal/folio"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/pdf"
+)
+
+// Property is who the invoice is from, and the currency it charges in
+type Property struct {
+	Name     string
+	Address  string
+	Email    string
+	Phone    string
+	Currency string
+}
+
+const (
+	dateLayout = "2006-01-02"
+	left       = 50.0
+	right      = pdf.PageWidth - 50
+	bottom     = pdf.PageHeight - 60
+)
+
+// Number formats an invoice number as printed, such as INV-000042
+func Number(n int) string {
+	return fmt.Sprintf("INV-%06d", n)
+}
+
+// Title is Receipt when nothing is left to pay, and Invoice otherwise
+func Title(f folio.Folio) string {
+	if f.Balance <= 0 {
+		return "Receipt"
+	}
+	return "Invoice"
+}
+
+// Filename is the name the document is downloaded or attached as
+func Filename(inv models.Invoice) string {
+	return Number(inv.Number) + ".pdf"
+}
+
+// Render writes the invoice for a reservation with the given folio. The room charge, the
+// first line of the folio, is broken down by night.
+func Render(p Property, inv models.Invoice, res models.Reservation, f folio.Folio) []byte {
+	money := func(cents int) string {
+		return currency.Format(cents, p.Currency, i18n.Default)
+	}
+
+	title := Title(f)
+	doc := pdf.New(fmt.Sprintf("%s %s", title, Number(inv.Number)))
+
+	doc.Text(left, 70, 22, true, title)
+	doc.TextRight(right, 62, 10, true, Number(inv.Number))
+	doc.TextRight(right, 76, 10, false, "Issued "+inv.CreatedAt.Format(dateLayout))
+
+	y := 110.0
+	doc.Text(left, y, 11, true, p.Name)
+	for _, s := range []string{p.Address, p.Email, p.Phone} {
+		if s != "" {
+			y += 14
+			doc.Text(left, y, 10, false, s)
+		}
+	}
+
+	y += 34
+	doc.Text(left, y, 10, true, "Billed to")
+	doc.Text(320, y, 10, true, "Stay")
+	guest := []string{res.FirstName + " " + res.LastName, res.Email, res.Phone}
+	stay := []string{
+		res.Room.RoomName,
+		"Arrival " + res.StartDate.Format(dateLayout),
+		"Departure " + res.EndDate.Format(dateLayout),
+		fmt.Sprintf("Reservation %d", res.ID),
+	}
+	for i := 0; i < len(stay); i++ {
+		y += 14
+		if i < len(guest) {
+			doc.Text(left, y, 10, false, guest[i])
+		}
+		doc.Text(320, y, 10, false, stay[i])
+	}
+
+	y += 36
+	heading := func() {
+		doc.Text(left, y, 10, true, "Date")
+		doc.Text(130, y, 10, true, "Description")
+		doc.TextRight(right, y, 10, true, "Amount")
+		doc.Line(left, y+6, right, y+6)
+		y += 22
+	}
+	heading()
+
+	lines := folio.Nightly(res)
+	if len(f.Lines) > 0 {
+		lines = append(lines, f.Lines[1:]...)
+	}
+
+	for _, line := range lines {
+		if y > bottom {
+			doc.AddPage()
+			y = 60
+			heading()
+		}
+
+		doc.Text(left, y, 10, false, line.Date.Format(dateLayout))
+		doc.Text(130, y, 10, false, line.Description)
+		doc.TextRight(right, y, 10, false, money(line.Amount))
+		y += 16
+	}
+
+	if y > bottom-100 {
+		doc.AddPage()
+		y = 60
+	}
+
+	doc.Line(320, y, right, y)
+	y += 18
+
+	totals := []struct {
+		label  string
+		amount int
+	}{
+		{"Charges", f.Charges},
+		{"Taxes", f.Taxes},
+		{"Paid", -f.Paid},
+	}
+	for _, t := range totals {
+		doc.Text(320, y, 10, false, t.label)
+		doc.TextRight(right, y, 10, false, money(t.amount))
+		y += 16
+	}
+
+	y += 4
+	doc.Text(320, y, 11, true, "Balance due")
+	doc.TextRight(right, y, 11, true, money(f.Balance))
+
+	if f.Included > 0 {
+		y += 20
+		doc.Text(320, y, 9, false, "The room price includes taxes of "+money(f.Included))
+	}
+
+	return doc.Bytes()
+}
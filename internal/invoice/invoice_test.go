@@ -0,0 +1,87 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/folio"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+var property = Property{Name: "Fort Smythe", Address: "Brisbane, Australia", Email: "me@helloworld.com", Currency: "EUR"}
+
+var inv = models.Invoice{Number: 42, CreatedAt: time.Date(2050, 1, 12, 11, 0, 0, 0, time.UTC)}
+
+var res = models.Reservation{
+	ID:        7,
+	FirstName: "John",
+	LastName:  "Smith",
+	Email:     "john@smith.com",
+	StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+	Subtotal:  20000,
+	Room:      models.Room{RoomName: "General's Quarters"},
+	CreatedAt: time.Date(2050, 1, 1, 9, 0, 0, 0, time.UTC),
+}
+
+func TestNumber(t *testing.T) {
+	if Number(42) != "INV-000042" {
+		t.Errorf("expected INV-000042 but got %s", Number(42))
+	}
+	if Filename(inv) != "INV-000042.pdf" {
+		t.Errorf("expected INV-000042.pdf but got %s", Filename(inv))
+	}
+}
+
+func TestRender(t *testing.T) {
+	items := []models.FolioItem{
+		{Kind: folio.Charge, Description: "Breakfast", Amount: 2500, CreatedAt: time.Date(2050, 1, 11, 8, 0, 0, 0, time.UTC)},
+		{Kind: folio.Tax, Description: "Tax on Breakfast", Amount: 250, CreatedAt: time.Date(2050, 1, 11, 8, 0, 0, 0, time.UTC)},
+	}
+
+	out := Render(property, inv, res, folio.Build(res, items, nil))
+
+	if !bytes.HasPrefix(out, []byte("%PDF-")) {
+		t.Fatal("expected a PDF")
+	}
+
+	for _, want := range []string{"(Invoice)", "(INV-000042)", "(Fort Smythe)", "(John Smith)", "(Arrival 2050-01-10)",
+		"(2050-01-10)", "(2050-01-11)", `(\200100.00)`, "(Tax on Breakfast)", `(\200227.50)`} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("expected the invoice to contain %s", want)
+		}
+	}
+
+	if bytes.Contains(out, []byte("2 nights")) {
+		t.Error("expected the room charge to be broken down by night")
+	}
+}
+
+func TestRender_Receipt(t *testing.T) {
+	items := []models.FolioItem{
+		{Kind: folio.Payment, Description: "Cash", Amount: 20000, CreatedAt: time.Date(2050, 1, 12, 10, 0, 0, 0, time.UTC)},
+	}
+
+	f := folio.Build(res, items, nil)
+	out := Render(property, inv, res, f)
+
+	if Title(f) != "Receipt" || !bytes.Contains(out, []byte("(Receipt)")) {
+		t.Error("expected a paid invoice to be a receipt")
+	}
+	if !bytes.Contains(out, []byte("(Cash)")) {
+		t.Error("expected the payment to be listed")
+	}
+}
+
+func TestRender_Pages(t *testing.T) {
+	long := res
+	long.EndDate = long.StartDate.AddDate(0, 0, 60)
+	long.Subtotal = 600000
+
+	out := Render(property, inv, long, folio.Build(long, nil, nil))
+
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Error("expected a long stay to run onto a second page")
+	}
+}
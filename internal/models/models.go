@@ -16,12 +16,16 @@ type User struct {
 	UpdatedAt   time.Time
 }
 
-// Room is the room model
+// Room is the room model; NightlyRate is in cents
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID                   int
+	RoomName             string
+	MaxOccupancy         int
+	NightlyRate          int
+	CancellationPolicyID int
+	ICalToken            string
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
 }
 
 // Restriction is the restriction model
@@ -34,40 +38,351 @@ type Restriction struct {
 
 // Reservation is the reservation model
 type Reservation struct {
-	ID        int
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
-	StartDate time.Time
-	EndDate   time.Time
-	RoomID    int
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Room      Room
-	Processed int
+	ID                   int
+	FirstName            string
+	LastName             string
+	Email                string
+	Phone                string
+	StartDate            time.Time
+	EndDate              time.Time
+	RoomID               int
+	BookingID            int
+	Adults               int
+	Children             int
+	Subtotal             int
+	Discount             int
+	Taxes                int
+	TaxLines             []ReservationTax
+	PromoCodeID          int
+	PromoCode            string
+	CancellationPolicyID int
+	CancellationPenalty  int
+	CancellationRefund   int
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Room                 Room
+	Processed            int
+	CancelledAt          time.Time
+	Locale               string
+	CheckInTime          string
+	CheckOutTime         string
+}
+
+// Guests returns the number of people staying
+func (r Reservation) Guests() int {
+	return r.Adults + r.Children
+}
+
+// Nights returns the number of nights stayed
+func (r Reservation) Nights() int {
+	return int(r.EndDate.Sub(r.StartDate).Hours() / 24)
+}
+
+// Total returns the amount due for the stay, in cents, after any discount and with the
+// taxes and fees not already included in the price
+func (r Reservation) Total() int {
+	return r.Subtotal - r.Discount + r.Taxes
+}
+
+// Booking groups the reservations for several rooms made together by one guest under one confirmation code
+type Booking struct {
+	ID               int
+	ConfirmationCode string
+	FirstName        string
+	LastName         string
+	Email            string
+	Phone            string
+	CancelledAt      time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Reservations     []Reservation
+}
+
+// Active returns the booking's reservations that are not cancelled
+func (b Booking) Active() []Reservation {
+	var active []Reservation
+	for _, r := range b.Reservations {
+		if r.CancelledAt.IsZero() {
+			active = append(active, r)
+		}
+	}
+	return active
+}
+
+// WaitlistEntry is a guest waiting for fully booked dates, in any room or a specific one.
+// When dates free up the entry is offered a room through a time-limited booking link.
+type WaitlistEntry struct {
+	ID             int
+	Name           string
+	Email          string
+	RoomID         int
+	StartDate      time.Time
+	EndDate        time.Time
+	Adults         int
+	Children       int
+	OfferedRoomID  int
+	TokenHash      string
+	OfferedAt      time.Time
+	OfferExpiresAt time.Time
+	ClaimedAt      time.Time
+	Locale         string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Room           Room
+	OfferedRoom    Room
 }
 
 // RoomRestriction is the room restriction model
 type RoomRestriction struct {
+	ID                 int
+	StartDate          time.Time
+	EndDate            time.Time
+	RoomID             int
+	ReservationID      int
+	RestrictionID      int
+	ExternalCalendarID int
+	ExternalUID        string
+	ExpiresAt          time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Room               Room
+	Reservation        Reservation
+	Restriction        Restriction
+}
+
+// StayRule limits how a room can be booked for arrivals, or departures, between two dates
+type StayRule struct {
+	ID                int
+	RoomID            int
+	StartDate         time.Time
+	EndDate           time.Time
+	MinNights         int
+	MaxNights         int
+	ClosedToArrival   bool
+	ClosedToDeparture bool
+	MinAdvanceDays    int
+	MaxAdvanceDays    int
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	Room              Room
+}
+
+// CancellationPolicy sets what a guest is charged for cancelling. Cancelling at least
+// FreeDays days before arrival is free; later, or at any time when NonRefundable, the
+// penalty is a percentage of the total, the first night or the whole stay.
+type CancellationPolicy struct {
+	ID             int
+	Name           string
+	FreeDays       int
+	PenaltyType    string
+	PenaltyPercent int
+	NonRefundable  bool
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Payment is money taken from a guest's card for a reservation. Amount is what was
+// authorized, in cents; it is taken when the status is "captured", and Refunded of it has
+// been paid back.
+type Payment struct {
 	ID            int
-	StartDate     time.Time
-	EndDate       time.Time
-	RoomID        int
 	ReservationID int
-	RestrictionID int
+	Provider      string
+	Reference     string
+	Status        string
+	Amount        int
+	Refunded      int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// FolioItem is something posted to a reservation's folio by staff: a charge for an extra,
+// the tax on it, or a payment or refund made outside the payment provider. Amount is in
+// cents.
+type FolioItem struct {
+	ID            int
+	ReservationID int
+	Kind          string
+	Description   string
+	Amount        int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Invoice is the invoice issued for a reservation. Numbers come from a sequence without
+// gaps and are never reused. PDF is the invoice as issued.
+type Invoice struct {
+	ID            int
+	Number        int
+	ReservationID int
+	PDF           []byte
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// PromoCode is a discount code guests can enter on the reservation form. Amounts are in
+// cents, or a whole percentage when the discount type is "percent". Zero dates and limits
+// mean no restriction.
+type PromoCode struct {
+	ID              int
+	Code            string
+	Description     string
+	DiscountType    string
+	Amount          int
+	RoomID          int
+	ValidFrom       time.Time
+	ValidTo         time.Time
+	StayFrom        time.Time
+	StayTo          time.Time
+	MaxUses         int
+	MaxUsesPerGuest int
+	Active          bool
+	Uses            int
+	DiscountTotal   int
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Room            Room
+}
+
+// Tax is a tax or fee added to reservations. Amount is in cents when the basis is "flat",
+// or in hundredths of a percent when it is "percent", so 1250 is 12.5%. An inclusive tax is
+// already part of the room price and is only shown. Zero dates and room mean no restriction.
+type Tax struct {
+	ID            int
+	Name          string
+	Kind          string
+	Basis         string
+	Per           string
+	Amount        int
+	Inclusive     bool
+	RoomID        int
+	EffectiveFrom time.Time
+	EffectiveTo   time.Time
+	Active        bool
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room
-	Reservation   Reservation
-	Restriction   Restriction
+}
+
+// ReservationTax is a tax or fee as charged on a reservation when it was booked, so later
+// changes to the tax don't change what the guest was quoted. Amount is in cents.
+type ReservationTax struct {
+	ID            int
+	ReservationID int
+	TaxID         int
+	Name          string
+	Kind          string
+	Inclusive     bool
+	Amount        int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// ExchangeRate is how much of a currency one unit of the base currency buys, used to show
+// prices to guests in their own currency
+type ExchangeRate struct {
+	ID        int
+	Currency  string
+	Rate      float64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ExternalCalendar is an iCalendar feed from another booking site, imported as room blocks
+type ExternalCalendar struct {
+	ID           int
+	RoomID       int
+	Name         string
+	URL          string
+	LastSyncedAt time.Time
+	LastError    string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Room         Room
+}
+
+// Digest holds the reservation activity summarised in the staff digest email
+type Digest struct {
+	Since      time.Time
+	Day        time.Time
+	New        []Reservation
+	Modified   []Reservation
+	Cancelled  []Reservation
+	Arrivals   []Reservation
+	Departures []Reservation
+}
+
+// APIToken is a bearer token used by integrations to call the API
+type APIToken struct {
+	ID         int
+	Name       string
+	TokenHash  string
+	Scope      string
+	RateLimit  int
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// IdempotencyKey records the reservation created for a client supplied key,
+// so a repeated submission returns the original booking
+type IdempotencyKey struct {
+	ID            int
+	Key           string
+	RequestHash   string
+	ReservationID int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Webhook is an endpoint notified when subscribed events occur
+type Webhook struct {
+	ID        int
+	URL       string
+	Secret    string
+	Events    []string
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// WebhookDelivery is one attempt log entry for sending an event to a webhook
+type WebhookDelivery struct {
+	ID            int
+	WebhookID     int
+	Event         string
+	Payload       string
+	Attempts      int
+	StatusCode    int
+	Error         string
+	DeliveredAt   time.Time
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Webhook       Webhook
+}
+
+// WebhookEvent is something that happened which webhooks may subscribe to
+type WebhookEvent struct {
+	Event      string
+	Data       interface{}
+	OccurredAt time.Time
 }
 
 // MailData holds an email message
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To          string
+	From        string
+	Subject     string
+	Content     string
+	Template    string
+	Attachments []MailAttachment
+}
+
+// MailAttachment is a file sent with an email
+type MailAttachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
 }
@@ -4,6 +4,8 @@ import "github.com/tsawler/bookings-app/internal/forms"
 
 // TemplateData holds data sent from handlers to templates
 // IsAuth: Greater than 0, then login. Otherwise, unauthenticated
+// Currency: the currency prices are shown in, BaseCurrency the one they are charged in
+// Locale: the language the page is in, one of Locales
 type TemplateData struct {
 	StringMap map[string]string
 	IntMap    map[string]int
@@ -15,4 +17,10 @@ type TemplateData struct {
 	Error     string
 	Form      *forms.Form
 	IsAuth    int
+
+	Currency     string
+	BaseCurrency string
+	Currencies   []string
+	Locale       string
+	Locales      []string
 }
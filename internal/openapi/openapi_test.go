@@ -0,0 +1,64 @@
+package openapi
+
+import (
+	"testing"
+)
+
+var doc = &Document{
+	Components: Components{
+		Schemas: map[string]*Schema{
+			"Room": {
+				Type:     "object",
+				Required: []string{"id", "name"},
+				Properties: map[string]*Schema{
+					"id":   {Type: "integer"},
+					"name": {Type: "string"},
+				},
+			},
+			"Stay": {
+				Type:     "object",
+				Required: []string{"start_date", "rooms"},
+				Properties: map[string]*Schema{
+					"start_date": {Type: "string", Format: "date"},
+					"status":     {Type: "string", Enum: []string{"open", "closed"}},
+					"rooms":      {Type: "array", Items: Ref("Room")},
+					"fields":     {Type: "object", AdditionalProperties: &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+				},
+			},
+		},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		name  string
+		value interface{}
+		valid bool
+	}{
+		{"valid", map[string]interface{}{"start_date": "2050-01-01", "rooms": []interface{}{map[string]interface{}{"id": 1, "name": "Suite"}}}, true},
+		{"additional properties", map[string]interface{}{"start_date": "2050-01-01", "rooms": []interface{}{}, "fields": map[string][]string{"email": {"Invalid"}}}, true},
+		{"missing required", map[string]interface{}{"rooms": []interface{}{}}, false},
+		{"bad date", map[string]interface{}{"start_date": "01/01/2050", "rooms": []interface{}{}}, false},
+		{"bad enum", map[string]interface{}{"start_date": "2050-01-01", "rooms": []interface{}{}, "status": "pending"}, false},
+		{"bad nested type", map[string]interface{}{"start_date": "2050-01-01", "rooms": []interface{}{map[string]interface{}{"id": "1", "name": "Suite"}}}, false},
+		{"not an integer", map[string]interface{}{"start_date": "2050-01-01", "rooms": []interface{}{map[string]interface{}{"id": 1.5, "name": "Suite"}}}, false},
+		{"unexpected property", map[string]interface{}{"start_date": "2050-01-01", "rooms": []interface{}{}, "extra": true}, false},
+	}
+
+	for _, e := range tests {
+		err := doc.ValidateExample(Ref("Stay"), e.value)
+		if e.valid && err != nil {
+			t.Errorf("%s: expected valid but got %s", e.name, err)
+		}
+		if !e.valid && err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
+
+func TestResolveUnknownRef(t *testing.T) {
+	_, err := doc.Resolve(Ref("Missing"))
+	if err == nil {
+		t.Error("expected error for unknown reference")
+	}
+}
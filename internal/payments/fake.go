@@ -0,0 +1,126 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DeclineToken is the card token the fake provider always declines
+const DeclineToken = "tok_declined"
+
+// Fake is a provider that keeps payments in memory, for development and tests. It
+// authorizes every token except DeclineToken, and forgets everything on restart.
+type Fake struct {
+	mu       sync.Mutex
+	next     int
+	payments map[string]*fakePayment
+}
+
+type fakePayment struct {
+	authorized int
+	captured   int
+	refunded   int
+	voided     bool
+}
+
+// NewFake creates a fake provider
+func NewFake() *Fake {
+	return &Fake{
+		payments: make(map[string]*fakePayment),
+	}
+}
+
+// Name identifies the provider on payment records
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// Authorize reserves an amount unless the token is DeclineToken or empty
+func (f *Fake) Authorize(token string, amount int, description string) (string, error) {
+	if token == "" || token == DeclineToken {
+		return "", ErrDeclined
+	}
+	if amount < 1 {
+		return "", errors.New("nothing to authorize")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	ref := fmt.Sprintf("fake_%d", f.next)
+	f.payments[ref] = &fakePayment{authorized: amount}
+
+	return ref, nil
+}
+
+// Capture takes up to the authorized amount, once
+func (f *Fake) Capture(ref string, amount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.payment(ref)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.voided:
+		return errors.New("authorization was voided")
+	case p.captured > 0:
+		return errors.New("already captured")
+	case amount < 1 || amount > p.authorized:
+		return errors.New("capture amount is more than was authorized")
+	}
+
+	p.captured = amount
+
+	return nil
+}
+
+// Refund pays back up to what was captured and not yet refunded
+func (f *Fake) Refund(ref string, amount int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.payment(ref)
+	if err != nil {
+		return err
+	}
+
+	if amount < 1 || amount > p.captured-p.refunded {
+		return errors.New("refund amount is more than was captured")
+	}
+
+	p.refunded += amount
+
+	return nil
+}
+
+// Void releases an authorization that was not captured
+func (f *Fake) Void(ref string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	p, err := f.payment(ref)
+	if err != nil {
+		return err
+	}
+
+	if p.captured > 0 {
+		return errors.New("already captured")
+	}
+
+	p.voided = true
+
+	return nil
+}
+
+func (f *Fake) payment(ref string) (*fakePayment, error) {
+	p, ok := f.payments[ref]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment %q", ref)
+	}
+	return p, nil
+}
@@ -0,0 +1,75 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFake_Authorize(t *testing.T) {
+	f := NewFake()
+
+	if _, err := f.Authorize(DeclineToken, 1000, "declined"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("expected the decline token to be declined but got %v", err)
+	}
+	if _, err := f.Authorize("", 1000, "no card"); !errors.Is(err, ErrDeclined) {
+		t.Errorf("expected an empty token to be declined but got %v", err)
+	}
+
+	first, err := f.Authorize("tok_visa", 1000, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.Authorize("tok_visa", 1000, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Errorf("expected different references but got %s twice", first)
+	}
+}
+
+func TestFake_CaptureAndRefund(t *testing.T) {
+	f := NewFake()
+
+	ref, _ := f.Authorize("tok_visa", 1000, "deposit")
+
+	if err := f.Capture(ref, 1500); err == nil {
+		t.Error("expected capturing more than was authorized to fail")
+	}
+	if err := f.Capture(ref, 1000); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Capture(ref, 1000); err == nil {
+		t.Error("expected a second capture to fail")
+	}
+	if err := f.Void(ref); err == nil {
+		t.Error("expected voiding a captured payment to fail")
+	}
+
+	if err := f.Refund(ref, 400); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Refund(ref, 700); err == nil {
+		t.Error("expected refunding more than is left to fail")
+	}
+	if err := f.Refund(ref, 600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Capture("fake_99", 100); err == nil {
+		t.Error("expected an unknown payment to fail")
+	}
+}
+
+func TestFake_Void(t *testing.T) {
+	f := NewFake()
+
+	ref, _ := f.Authorize("tok_visa", 1000, "deposit")
+
+	if err := f.Void(ref); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Capture(ref, 1000); err == nil {
+		t.Error("expected capturing a voided payment to fail")
+	}
+}
@@ -0,0 +1,122 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tsawler/bookings-app/internal/currency"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Payment statuses
+const (
+	Authorized = "authorized"
+	Captured   = "captured"
+	Voided     = "voided"
+	Refunded   = "refunded"
+)
+
+// Deposit types
+const (
+	NoDeposit  = "none"
+	Fixed      = "fixed"
+	Percent    = "percent"
+	FirstNight = "first_night"
+)
+
+// ErrDeclined is returned when the guest's card is refused
+var ErrDeclined = errors.New("payment declined")
+
+// Provider takes payments through a card processor. Amounts are in cents and a payment is
+// identified by the reference the provider returns when authorizing it.
+type Provider interface {
+	// Name identifies the provider on payment records
+	Name() string
+	// Authorize reserves an amount on the card the token stands for
+	Authorize(token string, amount int, description string) (string, error)
+	// Capture takes an authorized amount
+	Capture(ref string, amount int) error
+	// Refund pays back part or all of a captured amount
+	Refund(ref string, amount int) error
+	// Void releases an authorization that was not captured
+	Void(ref string) error
+}
+
+// DepositRule decides what is taken when a reservation is made. Amount is in cents for
+// a fixed deposit and a whole percentage for a percentage deposit.
+type DepositRule struct {
+	Type   string
+	Amount int
+}
+
+// NewDepositRule checks a deposit type and amount
+func NewDepositRule(depositType string, amount int) (DepositRule, error) {
+	switch depositType {
+	case "", NoDeposit, FirstNight:
+	case Fixed:
+		if amount < 1 {
+			return DepositRule{}, errors.New("a fixed deposit needs an amount in cents")
+		}
+	case Percent:
+		if amount < 1 || amount > 100 {
+			return DepositRule{}, errors.New("a percentage deposit needs a percentage from 1 to 100")
+		}
+	default:
+		return DepositRule{}, fmt.Errorf("unknown deposit type %q", depositType)
+	}
+
+	return DepositRule{Type: depositType, Amount: amount}, nil
+}
+
+// For returns the deposit, in cents, due when the reservation is made. It is never more than
+// the reservation's total.
+func (d DepositRule) For(res models.Reservation) int {
+	total := res.Total()
+
+	var deposit int
+
+	switch d.Type {
+	case Fixed:
+		deposit = d.Amount
+	case Percent:
+		deposit = currency.Percent(total, d.Amount)
+	case FirstNight:
+		if nights := res.Nights(); nights > 0 {
+			deposit = total / nights
+		}
+	}
+
+	if deposit > total {
+		deposit = total
+	}
+	if deposit < 0 {
+		deposit = 0
+	}
+
+	return deposit
+}
+
+// Paid returns what the guest has paid through the provider, in cents: the payments captured,
+// less what was refunded of them
+func Paid(ps []models.Payment) int {
+	paid := 0
+	for _, p := range ps {
+		if p.Status == Captured || p.Status == Refunded {
+			paid += p.Amount - p.Refunded
+		}
+	}
+	return paid
+}
+
+// Describe explains the rule to guests
+func (d DepositRule) Describe() string {
+	switch d.Type {
+	case Fixed:
+		return "A fixed deposit is charged when you book."
+	case Percent:
+		return fmt.Sprintf("A deposit of %d%% of the price is charged when you book.", d.Amount)
+	case FirstNight:
+		return "The first night is charged as a deposit when you book."
+	}
+	return ""
+}
@@ -0,0 +1,82 @@
+package payments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// threeNights is a 3 night stay at $100 a night with $30 off
+var threeNights = models.Reservation{
+	StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+	EndDate:   time.Date(2050, 1, 4, 0, 0, 0, 0, time.UTC),
+	Subtotal:  30000,
+	Discount:  3000,
+}
+
+var depositTests = []struct {
+	name     string
+	rule     DepositRule
+	expected int
+}{
+	{"no deposit", DepositRule{Type: NoDeposit}, 0},
+	{"unset", DepositRule{}, 0},
+	{"fixed", DepositRule{Type: Fixed, Amount: 5000}, 5000},
+	{"fixed above total", DepositRule{Type: Fixed, Amount: 50000}, 27000},
+	{"percent", DepositRule{Type: Percent, Amount: 25}, 6750},
+	{"percent rounded", DepositRule{Type: Percent, Amount: 33}, 8910},
+	{"first night after discount", DepositRule{Type: FirstNight}, 9000},
+}
+
+func TestDepositRule_For(t *testing.T) {
+	for _, e := range depositTests {
+		if got := e.rule.For(threeNights); got != e.expected {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expected, got)
+		}
+	}
+
+	if got := (DepositRule{Type: FirstNight}).For(models.Reservation{}); got != 0 {
+		t.Errorf("expected no deposit without nights but got %d", got)
+	}
+}
+
+func TestNewDepositRule(t *testing.T) {
+	var tests = []struct {
+		depositType string
+		amount      int
+		valid       bool
+	}{
+		{"none", 0, true},
+		{"first_night", 0, true},
+		{"fixed", 5000, true},
+		{"fixed", 0, false},
+		{"percent", 30, true},
+		{"percent", 0, false},
+		{"percent", 101, false},
+		{"half", 0, false},
+	}
+
+	for _, e := range tests {
+		_, err := NewDepositRule(e.depositType, e.amount)
+		if e.valid && err != nil {
+			t.Errorf("expected %s %d to be valid but got %s", e.depositType, e.amount, err)
+		}
+		if !e.valid && err == nil {
+			t.Errorf("expected %s %d to be invalid", e.depositType, e.amount)
+		}
+	}
+}
+
+func TestPaid(t *testing.T) {
+	ps := []models.Payment{
+		{Status: Captured, Amount: 9000, Refunded: 2500},
+		{Status: Refunded, Amount: 5000, Refunded: 5000},
+		{Status: Authorized, Amount: 4000},
+		{Status: Voided, Amount: 3000},
+	}
+
+	if got := Paid(ps); got != 6500 {
+		t.Errorf("expected 6500 but got %d", got)
+	}
+}
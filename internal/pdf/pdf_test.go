@@ -0,0 +1,78 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestDocument_Bytes(t *testing.T) {
+	d := New("Invoice (draft)")
+	d.Text(50, 50, 12, true, "Hello (world)")
+	d.TextRight(545, 70, 10, false, "$1,250.00")
+	d.Line(50, 80, 545, 80)
+	d.AddPage()
+	d.Text(50, 50, 10, false, "Page two")
+
+	out := d.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("expected a PDF header and trailer")
+	}
+
+	for _, want := range []string{"/Count 2", `(Hello \(world\)) Tj`, "(Page two) Tj", `/Title (Invoice \(draft\))`} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("expected the document to contain %s", want)
+		}
+	}
+
+	// every object must start where the cross-reference table says it does
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("expected startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n`).FindAllSubmatch(out[xref:], -1)
+	if len(offsets) != 8 {
+		t.Fatalf("expected 8 objects but got %d", len(offsets))
+	}
+	for i, o := range offsets {
+		offset, _ := strconv.Atoi(string(o[1]))
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("expected object %d at offset %d", i+1, offset)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	var tests = []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{`a\b`, `a\\b`},
+		{"Café", `Caf\351`},
+		{"€5", `\2005`},
+		{"1\u202f250,00\u00a0€", `1\240250,00\240\200`},
+		{"5 ₹", "5 ?"},
+	}
+
+	for _, e := range tests {
+		if got := escape(e.input); got != e.expected {
+			t.Errorf("for %q expected %q but got %q", e.input, e.expected, got)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	if got := Width("10", 10); got != 11.12 {
+		t.Errorf("expected 11.12 but got %v", got)
+	}
+}
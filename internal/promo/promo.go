@@ -0,0 +1,66 @@
+package promo
+
+import (
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/currency"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Discount types
+const (
+	Percent = "percent"
+	Fixed   = "fixed"
+)
+
+// Check returns why a promo code can't be used for a reservation, or an empty
+// message when it can. guestUses is the number of reservations the guest already made with
+// the code; the code's own Uses counts every guest.
+func Check(p models.PromoCode, res models.Reservation, guestUses int, now time.Time) i18n.Message {
+	today := clock.Day(now)
+
+	switch {
+	case !p.Active:
+		return i18n.M("This promo code is no longer available")
+	case !p.ValidFrom.IsZero() && today.Before(clock.Day(p.ValidFrom)):
+		return i18n.M("This promo code can't be used until %s", p.ValidFrom)
+	case !p.ValidTo.IsZero() && today.After(clock.Day(p.ValidTo)):
+		return i18n.M("This promo code expired on %s", p.ValidTo)
+	case p.RoomID > 0 && p.RoomID != res.RoomID:
+		return i18n.M("This promo code can't be used for this room")
+	case !p.StayFrom.IsZero() && clock.Day(res.StartDate).Before(clock.Day(p.StayFrom)):
+		return i18n.M("This promo code is only for stays from %s", p.StayFrom)
+	case !p.StayTo.IsZero() && clock.Day(res.EndDate).After(clock.Day(p.StayTo)):
+		return i18n.M("This promo code is only for stays ending by %s", p.StayTo)
+	case p.MaxUses > 0 && p.Uses >= p.MaxUses:
+		return i18n.M("This promo code has been used up")
+	case p.MaxUsesPerGuest > 0 && guestUses >= p.MaxUsesPerGuest:
+		return i18n.M("You have already used this promo code")
+	}
+
+	return i18n.Message{}
+}
+
+// Discount returns the amount, in cents, a promo code takes off a subtotal.
+// The discount never exceeds the subtotal.
+func Discount(p models.PromoCode, subtotal int) int {
+	var discount int
+
+	switch p.DiscountType {
+	case Percent:
+		discount = currency.Percent(subtotal, p.Amount)
+	case Fixed:
+		discount = p.Amount
+	}
+
+	if discount > subtotal {
+		discount = subtotal
+	}
+	if discount < 0 {
+		discount = 0
+	}
+
+	return discount
+}
@@ -0,0 +1,92 @@
+package promo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var summer = models.PromoCode{
+	Code:            "SUMMER",
+	DiscountType:    Percent,
+	Amount:          10,
+	RoomID:          1,
+	ValidFrom:       date("2050-05-01"),
+	ValidTo:         date("2050-06-30"),
+	StayFrom:        date("2050-07-01"),
+	StayTo:          date("2050-08-31"),
+	MaxUses:         100,
+	MaxUsesPerGuest: 1,
+	Active:          true,
+}
+
+var checkTests = []struct {
+	name      string
+	change    func(p *models.PromoCode)
+	roomId    int
+	start     string
+	end       string
+	guestUses int
+	now       string
+	expected  string
+}{
+	{"allowed", nil, 1, "2050-07-01", "2050-07-04", 0, "2050-06-01", ""},
+	{"inactive", func(p *models.PromoCode) { p.Active = false }, 1, "2050-07-01", "2050-07-04", 0, "2050-06-01", "This promo code is no longer available"},
+	{"not yet valid", nil, 1, "2050-07-01", "2050-07-04", 0, "2050-04-30", "This promo code can't be used until 2050-05-01"},
+	{"last valid day", nil, 1, "2050-07-01", "2050-07-04", 0, "2050-06-30", ""},
+	{"expired", nil, 1, "2050-07-01", "2050-07-04", 0, "2050-07-01", "This promo code expired on 2050-06-30"},
+	{"other room", nil, 2, "2050-07-01", "2050-07-04", 0, "2050-06-01", "This promo code can't be used for this room"},
+	{"any room", func(p *models.PromoCode) { p.RoomID = 0 }, 2, "2050-07-01", "2050-07-04", 0, "2050-06-01", ""},
+	{"arriving too early", nil, 1, "2050-06-30", "2050-07-04", 0, "2050-06-01", "This promo code is only for stays from 2050-07-01"},
+	{"leaving on the last day", nil, 1, "2050-08-28", "2050-08-31", 0, "2050-06-01", ""},
+	{"leaving too late", nil, 1, "2050-08-28", "2050-09-01", 0, "2050-06-01", "This promo code is only for stays ending by 2050-08-31"},
+	{"used up", func(p *models.PromoCode) { p.Uses = 100 }, 1, "2050-07-01", "2050-07-04", 0, "2050-06-01", "This promo code has been used up"},
+	{"used by guest", nil, 1, "2050-07-01", "2050-07-04", 1, "2050-06-01", "You have already used this promo code"},
+	{"no limits", func(p *models.PromoCode) { p.MaxUses, p.MaxUsesPerGuest, p.Uses = 0, 0, 500 }, 1, "2050-07-01", "2050-07-04", 3, "2050-06-01", ""},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		p := summer
+		if e.change != nil {
+			e.change(&p)
+		}
+
+		res := models.Reservation{RoomID: e.roomId, StartDate: date(e.start), EndDate: date(e.end)}
+
+		got := Check(p, res, e.guestUses, date(e.now)).String()
+		if got != e.expected {
+			t.Errorf("for %s expected %q but got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+var discountTests = []struct {
+	name         string
+	discountType string
+	amount       int
+	subtotal     int
+	expected     int
+}{
+	{"percent", Percent, 10, 36000, 3600},
+	{"percent rounds to the nearest cent", Percent, 15, 9999, 1500},
+	{"full percent", Percent, 100, 36000, 36000},
+	{"fixed", Fixed, 2500, 36000, 2500},
+	{"fixed above the subtotal", Fixed, 50000, 36000, 36000},
+	{"unknown type", "other", 10, 36000, 0},
+}
+
+func TestDiscount(t *testing.T) {
+	for _, e := range discountTests {
+		got := Discount(models.PromoCode{DiscountType: e.discountType, Amount: e.amount}, e.subtotal)
+		if got != e.expected {
+			t.Errorf("for %s expected %d but got %d", e.name, e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts requests per key in fixed windows
+type Limiter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	now     func() time.Time
+	windows map[string]*window
+}
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// New creates a limiter that counts requests over the given window
+func New(w time.Duration) *Limiter {
+	return &Limiter{
+		window:  w,
+		now:     time.Now,
+		windows: make(map[string]*window),
+	}
+}
+
+// Allow records a request for key and reports whether it is within limit.
+// A limit of zero or less means the key is not limited.
+func (l *Limiter) Allow(key string, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		w = &window{start: now}
+		l.windows[key] = w
+		l.prune(now)
+	}
+
+	if w.count >= limit {
+		return false
+	}
+
+	w.count++
+	return true
+}
+
+// prune drops expired windows so the map does not grow forever
+func (l *Limiter) prune(now time.Time) {
+	for k, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, k)
+		}
+	}
+}
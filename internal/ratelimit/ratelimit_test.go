@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	l := New(time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !l.Allow("a", 3) {
+			t.Fatalf("request %d should have been allowed", i+1)
+		}
+	}
+
+	if l.Allow("a", 3) {
+		t.Error("request over the limit was allowed")
+	}
+
+	if !l.Allow("b", 3) {
+		t.Error("limit for one key affected another")
+	}
+
+	now = now.Add(time.Minute)
+
+	if !l.Allow("a", 3) {
+		t.Error("request in a new window was not allowed")
+	}
+}
+
+func TestAllowUnlimited(t *testing.T) {
+	l := New(time.Minute)
+
+	for i := 0; i < 100; i++ {
+		if !l.Allow("a", 0) {
+			t.Fatal("unlimited key was limited")
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/justinas/nosurf"
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
 )
 
@@ -20,6 +21,10 @@ var functions = template.FuncMap{
 	"formatDate": FormatDate,
 	"iterate":    Iterate,
 	"add":        Add,
+	"money":      BasePrice,
+	"price":      Price,
+	"t":          Translate,
+	"language":   i18n.Name,
 }
 
 var app *config.AppConfig
@@ -46,27 +51,71 @@ func NewRenderer(a *config.AppConfig) {
 	app = a
 }
 
-// HumanDate returns time in YYYY-MM-DD format
-func HumanDate(t time.Time) string {
+// HumanDate returns time in YYYY-MM-DD format, or the way a locale writes dates when given
+func HumanDate(t time.Time, locale ...string) string {
+	if len(locale) > 0 {
+		return i18n.Date(t, locale[0])
+	}
 	return t.Format("2006-01-02")
 }
 
-// FormatDate returns time in specific format
-func FormatDate(t time.Time, f string) string {
+// FormatDate returns time in specific format, with the names of months and days in a
+// locale when given
+func FormatDate(t time.Time, f string, locale ...string) string {
+	if len(locale) > 0 {
+		return i18n.FormatDate(t, f, locale[0])
+	}
 	return t.Format(f)
 }
 
+// Translate returns text in the language of the page, formatted with any arguments
+func Translate(td *models.TemplateData, text string, args ...interface{}) string {
+	return i18n.T(td.Locale, text, args...)
+}
+
+// Money writes an amount in cents of the base currency the way a locale writes it, e.g.
+// A$1,250.00 or 1.250,00 €
+func Money(cents int, locale string) string {
+	return app.Currencies.Format(cents, app.Currencies.Base(), locale)
+}
+
+// BasePrice shows an amount in cents in the base currency, as it is charged, in the language
+// of the page
+func BasePrice(cents int, td *models.TemplateData) string {
+	return Money(cents, td.Locale)
+}
+
+// Price shows an amount in cents in the currency the guest chose, for display only. Charges
+// are always made in the base currency.
+func Price(cents int, td *models.TemplateData) string {
+	return app.Currencies.Format(cents, td.Currency, td.Locale)
+}
+
 // AddDefaultData adds data for all templates
 func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateData {
-	td.Flash = app.Session.PopString(r.Context(), "flash")
-	td.Warning = app.Session.PopString(r.Context(), "warning")
-	td.Error = app.Session.PopString(r.Context(), "error")
+	if td.Locale == "" {
+		td.Locale = i18n.FromContext(r.Context())
+	}
+	td.Locales = i18n.Supported()
+
+	td.Flash = i18n.T(td.Locale, app.Session.PopString(r.Context(), "flash"))
+	td.Warning = i18n.T(td.Locale, app.Session.PopString(r.Context(), "warning"))
+	td.Error = i18n.T(td.Locale, app.Session.PopString(r.Context(), "error"))
 	td.CSRFToken = nosurf.Token(r)
 
 	if app.Session.Exists(r.Context(), "user_id") {
 		td.IsAuth = 1
 	}
 
+	if app.Currencies != nil {
+		td.BaseCurrency = app.Currencies.Base()
+		td.Currencies = app.Currencies.Codes()
+		td.Currency = td.BaseCurrency
+		if c := app.Session.GetString(r.Context(), "currency"); c != "" && app.Currencies.Has(c) {
+			td.Currency = c
+		}
+	}
+
 	return td
 }
 
@@ -76,3 +76,30 @@ func TestCreateTemplateCache(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestMoney(t *testing.T) {
+	var tests = []struct {
+		cents    int
+		locale   string
+		expected string
+	}{
+		{0, "en", "A$0.00"},
+		{5, "en", "A$0.05"},
+		{125050, "en", "A$1,250.50"},
+		{123456789, "en", "A$1,234,567.89"},
+		{-2500, "en", "-A$25.00"},
+		{125050, "de", "1.250,50\u00a0A$"},
+	}
+
+	for _, e := range tests {
+		if got := Money(e.cents, e.locale); got != e.expected {
+			t.Errorf("for %d in %s expected %s but got %s", e.cents, e.locale, e.expected, got)
+		}
+	}
+
+	// prices the guest sees in another currency are still charged in the base currency
+	td := &models.TemplateData{Locale: "en", Currency: "EUR"}
+	if got := BasePrice(12000, td); got != "A$120.00" {
+		t.Errorf("expected A$120.00 but got %s", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/gob"
 	"github.com/alexedwards/scs/v2"
 	"github.com/tsawler/bookings-app/internal/config"
+	"github.com/tsawler/bookings-app/internal/currency"
 	"github.com/tsawler/bookings-app/internal/models"
 	"log"
 	"net/http"
@@ -37,6 +38,8 @@ func TestMain(m *testing.M) {
 
 	testApp.Session = session
 
+	testApp.Currencies = currency.NewTable("AUD")
+
 	app = &testApp
 
 	os.Exit(m.Run())
@@ -2,11 +2,18 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/i18n"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,20 +21,88 @@ func (m *postgresDBRepo) AllUsers() bool {
 	return true
 }
 
-// InsertReservation inserts a reservation into the database
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
+// Ping checks that a connection to the database can be made before ctx is done
+func (m *postgresDBRepo) Ping(ctx context.Context) error {
+	return m.DB.PingContext(ctx)
+}
+
+// MigrationVersion returns the version of the newest migration run on the database
+func (m *postgresDBRepo) MigrationVersion(ctx context.Context) (string, error) {
+	var version string
+
+	query := `select coalesce(max(version), '') from schema_migration`
+
+	err := m.DB.QueryRowContext(ctx, query).Scan(&version)
+	if err != nil {
+		return "", err
+	}
+
+	return version, nil
+}
+
+// nullInt stores an optional id, where zero means none, as null
+func nullInt(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id > 0}
+}
+
+// locale stores the language of a guest, English when it isn't known
+func locale(l string) string {
+	if l == "" {
+		return i18n.Default
+	}
+	return l
+}
+
+// timeOfDay stores a check-in or check-out time, the property's current one when not given
+func timeOfDay(s string, t clock.TimeOfDay) string {
+	if s == "" {
+		return t.String()
+	}
+	return s
+}
+
+// InsertReservation inserts a reservation, with the taxes and fees charged on it, into the database
+func (m *postgresDBRepo) InsertReservation(res models.Reservation, holdId int) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var newId int
 
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	err = lockRoom(ctx, tx, res.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	taken, err := roomTaken(ctx, tx, res.RoomID, res.StartDate, res.EndDate, now, holdId)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	err = usePromoCode(ctx, tx, res.PromoCodeID, res.Email)
+	if err != nil {
+		return 0, err
+	}
+
 	stmt := `insert into reservations 
-		(first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
+		(first_name, last_name, email, phone, start_date, end_date, room_id, adults, children,
+			subtotal, discount, taxes, promo_code_id, cancellation_policy_id, locale,
+			check_in_time, check_out_time, created_at, updated_at)
 		values 
-		($1, $2, $3, $4, $5, $6, $7, $8, $9) 
+		($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) 
 		returning id`
 
-	err := m.DB.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		stmt,
 		res.FirstName,
@@ -37,6 +112,16 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		res.Adults,
+		res.Children,
+		res.Subtotal,
+		res.Discount,
+		res.Taxes,
+		nullInt(res.PromoCodeID),
+		nullInt(res.CancellationPolicyID),
+		locale(res.Locale),
+		timeOfDay(res.CheckInTime, m.App.CheckInTime),
+		timeOfDay(res.CheckOutTime, m.App.CheckOutTime),
 		time.Now(),
 		time.Now(),
 	).Scan(&newId)
@@ -45,9 +130,186 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		return 0, err
 	}
 
+	err = insertReservationTaxes(ctx, tx, newId, res.TaxLines)
+	if err != nil {
+		return 0, err
+	}
+
+	// the guest's hold becomes the reservation's restriction, or one is added when it is gone
+	converted := int64(0)
+	if holdId > 0 {
+		result, err := tx.ExecContext(ctx, `
+			update
+				room_restrictions
+			set
+				reservation_id = $1, restriction_id = 1, expires_at = null, updated_at = $2
+			where
+				id = $3 and restriction_id = 3 and room_id = $4 and start_date = $5 and end_date = $6
+		`, newId, now, holdId, res.RoomID, res.StartDate, res.EndDate)
+		if err != nil {
+			return 0, err
+		}
+
+		converted, err = result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if converted == 0 {
+		_, err = tx.ExecContext(ctx, `
+			insert into
+				room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			values
+				($1, $2, $3, $4, 1, $5, $6)
+		`, res.StartDate, res.EndDate, res.RoomID, newId, now, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
 	return newId, nil
 }
 
+// lockRoom locks the row of a room until the transaction ends. Everything that books or
+// holds a room locks it first, so they wait for each other.
+func lockRoom(ctx context.Context, tx *sql.Tx, roomId int) error {
+	_, err := tx.ExecContext(ctx, `select id from rooms where id = $1 for update`, roomId)
+	return err
+}
+
+// lockRooms locks the rows of several rooms, always in order of id so that two transactions
+// locking the same rooms can't each hold one the other is waiting for
+func lockRooms(ctx context.Context, tx *sql.Tx, roomIds []int) error {
+	ids := append([]int(nil), roomIds...)
+	sort.Ints(ids)
+
+	for i, id := range ids {
+		if i > 0 && id == ids[i-1] {
+			continue
+		}
+		err := lockRoom(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rowQuerier runs a query for one row, in a transaction or not
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// roomTaken reports whether a room has a restriction overlapping the dates, other than the
+// hold with id exceptId. Holds count until they expire at now, which is the application's
+// clock, as that is what their expiry was set from.
+func roomTaken(ctx context.Context, q rowQuerier, roomId int, start, end, now time.Time, exceptId int) (bool, error) {
+	var numRows int
+
+	query := `
+		select count(id)
+		from room_restrictions
+		where
+			room_id = $1
+			and
+			$2 < end_date and $3 > start_date
+			and
+			(expires_at is null or expires_at > $4)
+			and
+			id <> $5
+	`
+
+	err := q.QueryRowContext(ctx, query, roomId, start, end, now, exceptId).Scan(&numRows)
+	if err != nil {
+		return false, err
+	}
+
+	return numRows > 0, nil
+}
+
+// usePromoCode checks, within the transaction storing a reservation, that its promo code can
+// still be used by the guest. The code's row stays locked until the transaction ends, so
+// reservations made at the same time with the code are counted one after the other and can't
+// take it past its limits. It returns repository.ErrPromoCodeUsedUp when a limit is reached.
+func usePromoCode(ctx context.Context, tx *sql.Tx, id int, email string) error {
+	if id == 0 {
+		return nil
+	}
+
+	var maxUses, maxUsesPerGuest, uses, guestUses int
+
+	err := tx.QueryRowContext(ctx, `
+		select
+			max_uses, max_uses_per_guest
+		from
+			promo_codes
+		where
+			id = $1
+		for update
+	`, id).Scan(&maxUses, &maxUsesPerGuest)
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		select
+			count(id),
+			count(id) filter (where lower(email) = lower($2))
+		from
+			reservations
+		where
+			promo_code_id = $1
+			and
+			cancelled_at is null
+	`, id, email).Scan(&uses, &guestUses)
+	if err != nil {
+		return err
+	}
+
+	if (maxUses > 0 && uses >= maxUses) || (maxUsesPerGuest > 0 && guestUses >= maxUsesPerGuest) {
+		return repository.ErrPromoCodeUsedUp
+	}
+
+	return nil
+}
+
+// insertReservationTaxes stores the taxes and fees charged on a reservation
+func insertReservationTaxes(ctx context.Context, tx *sql.Tx, reservationId int, lines []models.ReservationTax) error {
+	query := `
+		insert into
+			reservation_taxes (reservation_id, tax_id, name, kind, inclusive, amount, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+
+	for _, line := range lines {
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			reservationId,
+			nullInt(line.TaxID),
+			line.Name,
+			line.Kind,
+			line.Inclusive,
+			line.Amount,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // InsertRoomRestriction inserts a room restriction into the database
 func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -90,7 +352,9 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time,
 		where
 			room_id = $1
 			and
-			$2 < end_date and $3 > start_date;
+			$2 < end_date and $3 > start_date
+			and
+			(expires_at is null or expires_at > $4);
 	`
 
 	row := m.DB.QueryRowContext(
@@ -99,6 +363,7 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time,
 		roomId,
 		start,
 		end,
+		time.Now(),
 	)
 
 	err := row.Scan(&numRows)
@@ -114,8 +379,23 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time,
 	return false, nil
 }
 
+// SearchAvailabilityExceptHold returns true if roomId is free for the dates, apart from the
+// guest's own hold
+func (m *postgresDBRepo) SearchAvailabilityExceptHold(start, end time.Time, roomId, holdId int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	taken, err := roomTaken(ctx, m.DB, roomId, start, end, time.Now(), holdId)
+	if err != nil {
+		return false, err
+	}
+
+	return !taken, nil
+}
+
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+// that sleep at least the given number of guests
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -123,10 +403,12 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 
 	query := `
 		select 
-			r.id, r.room_name
+			r.id, r.room_name, r.max_occupancy, r.nightly_rate, coalesce(r.cancellation_policy_id, 0)
 		from
 			rooms r
 		where 
+			(r.max_occupancy = 0 or r.max_occupancy >= $3)
+			and
 			r.id not in (
 				select 
 					rr.room_id
@@ -136,6 +418,8 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 					$1 < rr.end_date 
 					and 
 					$2 > rr.start_date
+					and
+					(rr.expires_at is null or rr.expires_at > $4)
 			)
 	`
 
@@ -144,6 +428,8 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 		query,
 		start,
 		end,
+		guests,
+		time.Now(),
 	)
 
 	if err != nil {
@@ -156,6 +442,9 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.MaxOccupancy,
+			&room.NightlyRate,
+			&room.CancellationPolicyID,
 		)
 		if err != nil {
 			return rooms, err
@@ -180,7 +469,7 @@ func (m *postgresDBRepo) GetRoomById(id int) (models.Room, error) {
 
 	query := `
 		select 
-			id, room_name, created_at, updated_at
+			id, room_name, max_occupancy, nightly_rate, coalesce(cancellation_policy_id, 0), ical_token, created_at, updated_at
 		from 
 			rooms
 		where 
@@ -194,6 +483,10 @@ func (m *postgresDBRepo) GetRoomById(id int) (models.Room, error) {
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
+		&room.MaxOccupancy,
+		&room.NightlyRate,
+		&room.CancellationPolicyID,
+		&room.ICalToken,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
@@ -328,11 +621,16 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 		select
 			r.id, r.first_name, r.last_name, r.email, r.phone, 
 			r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-			rm.id, rm.room_name
+			r.cancelled_at, r.adults, r.children, coalesce(r.booking_id, 0), r.subtotal, r.discount, r.taxes, r.locale,
+			r.check_in_time, r.check_out_time,
+			coalesce(r.promo_code_id, 0), coalesce(pc.code, ''), coalesce(r.cancellation_policy_id, 0),
+			r.cancellation_penalty, r.cancellation_refund, rm.id, rm.room_name, rm.max_occupancy, rm.nightly_rate
 		from
 			reservations r
 		left join
 			rooms rm on (r.room_id = rm.id)
+		left join
+			promo_codes pc on (r.promo_code_id = pc.id)
 		order by 
 			r.start_date asc
 	`
@@ -347,6 +645,7 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 
 	for rows.Next() {
 		var i models.Reservation
+		var cancelledAt sql.NullTime
 		err := rows.Scan(
 			&i.ID,
 			&i.FirstName,
@@ -359,12 +658,30 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Processed,
+			&cancelledAt,
+			&i.Adults,
+			&i.Children,
+			&i.BookingID,
+			&i.Subtotal,
+			&i.Discount,
+			&i.Taxes,
+			&i.Locale,
+			&i.CheckInTime,
+			&i.CheckOutTime,
+			&i.PromoCodeID,
+			&i.PromoCode,
+			&i.CancellationPolicyID,
+			&i.CancellationPenalty,
+			&i.CancellationRefund,
 			&i.Room.ID,
 			&i.Room.RoomName,
+			&i.Room.MaxOccupancy,
+			&i.Room.NightlyRate,
 		)
 		if err != nil {
 			return reservations, err
 		}
+		i.CancelledAt = cancelledAt.Time
 
 		reservations = append(reservations, i)
 	}
@@ -387,13 +704,15 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 		select
 			r.id, r.first_name, r.last_name, r.email, r.phone, 
 			r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at,
-			rm.id, rm.room_name
+			r.adults, r.children, coalesce(r.booking_id, 0), rm.id, rm.room_name
 		from
 			reservations r
 		left join
 			rooms rm on (r.room_id = rm.id)
 		where
 			processed = 0
+			and
+			r.cancelled_at is null
 		order by 
 			r.start_date asc
 	`
@@ -419,6 +738,9 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.RoomID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Adults,
+			&i.Children,
+			&i.BookingID,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
@@ -447,14 +769,21 @@ func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error)
 		select
 			r.id, r.first_name, r.last_name, r.email, r.phone, 
 			r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-			rm.id, rm.room_name
+			r.cancelled_at, r.adults, r.children, coalesce(r.booking_id, 0), r.subtotal, r.discount, r.taxes, r.locale,
+			r.check_in_time, r.check_out_time,
+			coalesce(r.promo_code_id, 0), coalesce(pc.code, ''), coalesce(r.cancellation_policy_id, 0),
+			r.cancellation_penalty, r.cancellation_refund, rm.id, rm.room_name, rm.max_occupancy, rm.nightly_rate
 		from
 			reservations r
 		left join
 			rooms rm on (r.room_id = rm.id)
+		left join
+			promo_codes pc on (r.promo_code_id = pc.id)
 		where r.id = $1
 	`
 
+	var cancelledAt sql.NullTime
+
 	row := m.DB.QueryRowContext(
 		ctx,
 		query,
@@ -472,12 +801,35 @@ func (m *postgresDBRepo) GetReservationById(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&cancelledAt,
+		&res.Adults,
+		&res.Children,
+		&res.BookingID,
+		&res.Subtotal,
+		&res.Discount,
+		&res.Taxes,
+		&res.Locale,
+		&res.CheckInTime,
+		&res.CheckOutTime,
+		&res.PromoCodeID,
+		&res.PromoCode,
+		&res.CancellationPolicyID,
+		&res.CancellationPenalty,
+		&res.CancellationRefund,
 		&res.Room.ID,
 		&res.Room.RoomName,
+		&res.Room.MaxOccupancy,
+		&res.Room.NightlyRate,
 	)
 	if err != nil {
 		return res, err
 	}
+	res.CancelledAt = cancelledAt.Time
+
+	res.TaxLines, err = m.reservationTaxesWhere("t.reservation_id = $1", id)
+	if err != nil {
+		return res, err
+	}
 
 	return res, nil
 }
@@ -495,9 +847,11 @@ func (m *postgresDBRepo) UpdateReservation(res models.Reservation) error {
 			last_name = $2,
 			email = $3,
 			phone = $4,
-			updated_at = $5
+			adults = $5,
+			children = $6,
+			updated_at = $7
 		where
-			id = $6
+			id = $8
 	`
 
 	_, err := m.DB.ExecContext(
@@ -507,6 +861,8 @@ func (m *postgresDBRepo) UpdateReservation(res models.Reservation) error {
 		res.LastName,
 		res.Email,
 		res.Phone,
+		res.Adults,
+		res.Children,
 		time.Now(),
 		res.ID,
 	)
@@ -517,11 +873,21 @@ func (m *postgresDBRepo) UpdateReservation(res models.Reservation) error {
 	return nil
 }
 
-// DeleteReservation deletes a reservation by id
+// DeleteReservation deletes a reservation by id. A reservation with an invoice is kept, and
+// repository.ErrReservationInvoiced returned.
 func (m *postgresDBRepo) DeleteReservation(id int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	var invoiced bool
+	err := m.DB.QueryRowContext(ctx, `select exists(select 1 from invoices where reservation_id = $1)`, id).Scan(&invoiced)
+	if err != nil {
+		return err
+	}
+	if invoiced {
+		return repository.ErrReservationInvoiced
+	}
+
 	query := `
 		delete from
 			reservations
@@ -529,7 +895,7 @@ func (m *postgresDBRepo) DeleteReservation(id int) error {
 			id = $1
 	`
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	_, err = m.DB.ExecContext(ctx, query, id)
 	if err != nil {
 		return err
 	}
@@ -559,113 +925,437 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 	return nil
 }
 
-// AllRooms get all rooms
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
+// CancelReservation marks a reservation as cancelled, recording the penalty charged and the
+// amount refunded, and releases its room restrictions. It returns repository.ErrAlreadyCancelled
+// when the reservation was cancelled before.
+func (m *postgresDBRepo) CancelReservation(id, penalty, refund int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	var rooms []models.Room
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
 	query := `
-		select
-			id, room_name, created_at, updated_at
-		from
-			rooms
-		order by
-			room_name
+		update
+			reservations
+		set
+			cancelled_at = $1,
+			cancellation_penalty = $2,
+			cancellation_refund = $3,
+			updated_at = $1
+		where
+			id = $4
+			and
+			cancelled_at is null
 	`
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	result, err := tx.ExecContext(ctx, query, time.Now(), penalty, refund, id)
 	if err != nil {
-		return rooms, err
+		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var rm models.Room
-		err := rows.Scan(
-			&rm.ID,
-			&rm.RoomName,
-			&rm.CreatedAt,
-			&rm.UpdatedAt,
-		)
-		if err != nil {
-			return rooms, err
-		}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrAlreadyCancelled
+	}
 
-		rooms = append(rooms, rm)
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, id)
+	if err != nil {
+		return err
 	}
 
-	if err = rows.Err(); err != nil {
-		return rooms, err
+	// a booking is cancelled along with its last room
+	query = `
+		update
+			bookings b
+		set
+			cancelled_at = $1,
+			updated_at = $1
+		where
+			b.id = (select booking_id from reservations where id = $2)
+			and
+			b.cancelled_at is null
+			and
+			not exists (select 1 from reservations r where r.booking_id = b.id and r.cancelled_at is null)
+	`
+
+	_, err = tx.ExecContext(ctx, query, time.Now(), id)
+	if err != nil {
+		return err
 	}
 
-	return rooms, nil
+	return tx.Commit()
 }
 
-// GetRestrictionsForRoomByDate returns restrictions for a room by date
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var restrictions []models.RoomRestriction
+// GetReservationDigest returns the reservation activity since a point in time,
+// along with the arrivals and departures for the given day
+func (m *postgresDBRepo) GetReservationDigest(since, day time.Time) (models.Digest, error) {
+	digest := models.Digest{
+		Since: since,
+		Day:   day,
+	}
 
-	// NULL is not appropriate in Go if the variable violates int type,
-	// so coalesce function can switch null to 0
-	query := `
-		select
-			id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
-		from
-			room_restrictions
-		where 
-			$1 < end_date and $2 >= start_date
-			and
-			room_id = $3
-	`
+	var err error
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end, roomId)
+	digest.New, err = m.reservationsWhere(`r.created_at >= $1 and r.cancelled_at is null`, since)
 	if err != nil {
-		return nil, err
+		return digest, err
 	}
 
-	defer rows.Close()
-
-	for rows.Next() {
-		var r models.RoomRestriction
+	digest.Modified, err = m.reservationsWhere(`r.updated_at >= $1 and r.created_at < $1 and r.cancelled_at is null`, since)
+	if err != nil {
+		return digest, err
+	}
 
-		err := rows.Scan(
-			&r.ID,
-			&r.ReservationID,
-			&r.RestrictionID,
-			&r.RoomID,
-			&r.StartDate,
-			&r.EndDate,
-		)
-		if err != nil {
-			return nil, err
-		}
+	digest.Cancelled, err = m.reservationsWhere(`r.cancelled_at >= $1`, since)
+	if err != nil {
+		return digest, err
+	}
 
-		restrictions = append(restrictions, r)
+	digest.Arrivals, err = m.reservationsWhere(`r.start_date = $1 and r.cancelled_at is null`, day)
+	if err != nil {
+		return digest, err
 	}
 
-	if err = rows.Err(); err != nil {
-		return nil, err
+	digest.Departures, err = m.reservationsWhere(`r.end_date = $1 and r.cancelled_at is null`, day)
+	if err != nil {
+		return digest, err
 	}
 
-	return restrictions, nil
+	return digest, nil
 }
 
-// InsertBlockForRoom inserts a room restriction
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+// reservationsWhere returns the reservations matching a where clause, ordered by arrival
+func (m *postgresDBRepo) reservationsWhere(where string, args ...interface{}) ([]models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `
-		insert into
-			room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
-		values
-			($1, $2, $3, $4, $5, $6)
-	`
+	var reservations []models.Reservation
+
+	query := fmt.Sprintf(`
+		select
+			r.id, r.first_name, r.last_name, r.email, r.phone,
+			r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
+			r.cancelled_at, r.adults, r.children, coalesce(r.booking_id, 0), r.subtotal, r.discount, r.taxes, r.locale,
+			r.check_in_time, r.check_out_time,
+			coalesce(r.promo_code_id, 0), coalesce(pc.code, ''), coalesce(r.cancellation_policy_id, 0),
+			r.cancellation_penalty, r.cancellation_refund, rm.id, rm.room_name, rm.max_occupancy, rm.nightly_rate
+		from
+			reservations r
+		left join
+			rooms rm on (r.room_id = rm.id)
+		left join
+			promo_codes pc on (r.promo_code_id = pc.id)
+		where
+			%s
+		order by
+			r.start_date asc
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var cancelledAt sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&cancelledAt,
+			&i.Adults,
+			&i.Children,
+			&i.BookingID,
+			&i.Subtotal,
+			&i.Discount,
+			&i.Taxes,
+			&i.Locale,
+			&i.CheckInTime,
+			&i.CheckOutTime,
+			&i.PromoCodeID,
+			&i.PromoCode,
+			&i.CancellationPolicyID,
+			&i.CancellationPenalty,
+			&i.CancellationRefund,
+			&i.Room.ID,
+			&i.Room.RoomName,
+			&i.Room.MaxOccupancy,
+			&i.Room.NightlyRate,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.CancelledAt = cancelledAt.Time
+
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// AllRooms get all rooms
+func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rooms []models.Room
+
+	query := `
+		select
+			id, room_name, max_occupancy, nightly_rate, coalesce(cancellation_policy_id, 0), ical_token, created_at, updated_at
+		from
+			rooms
+		order by
+			room_name
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rooms, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rm models.Room
+		err := rows.Scan(
+			&rm.ID,
+			&rm.RoomName,
+			&rm.MaxOccupancy,
+			&rm.NightlyRate,
+			&rm.CancellationPolicyID,
+			&rm.ICalToken,
+			&rm.CreatedAt,
+			&rm.UpdatedAt,
+		)
+		if err != nil {
+			return rooms, err
+		}
+
+		rooms = append(rooms, rm)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rooms, err
+	}
+
+	return rooms, nil
+}
+
+// GetRoomByICalToken gets the room whose calendar feed uses the given token
+func (m *postgresDBRepo) GetRoomByICalToken(token string) (models.Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var room models.Room
+
+	if token == "" {
+		return room, errors.New("empty calendar token")
+	}
+
+	query := `
+		select
+			id, room_name, max_occupancy, ical_token, created_at, updated_at
+		from
+			rooms
+		where
+			ical_token = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, token)
+	err := row.Scan(
+		&room.ID,
+		&room.RoomName,
+		&room.MaxOccupancy,
+		&room.ICalToken,
+		&room.CreatedAt,
+		&room.UpdatedAt,
+	)
+	if err != nil {
+		return room, err
+	}
+
+	return room, nil
+}
+
+// UpdateRoomICalToken sets the calendar feed token for a room
+func (m *postgresDBRepo) UpdateRoomICalToken(roomId int, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			rooms
+		set
+			ical_token = $1,
+			updated_at = $2
+		where
+			id = $3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, token, time.Now(), roomId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateRoomMaxOccupancy sets how many guests a room sleeps, where 0 means any number
+func (m *postgresDBRepo) UpdateRoomMaxOccupancy(roomId, maxOccupancy int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			rooms
+		set
+			max_occupancy = $1,
+			updated_at = $2
+		where
+			id = $3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, maxOccupancy, time.Now(), roomId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateRoomNightlyRate sets the price of a night in a room, in cents
+func (m *postgresDBRepo) UpdateRoomNightlyRate(roomId, rate int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			rooms
+		set
+			nightly_rate = $1,
+			updated_at = $2
+		where
+			id = $3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, rate, time.Now(), roomId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateRoomCancellationPolicy sets the cancellation policy for new reservations of a room;
+// a policy id of zero means cancelling is free
+func (m *postgresDBRepo) UpdateRoomCancellationPolicy(roomId, policyId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			rooms
+		set
+			cancellation_policy_id = $1,
+			updated_at = $2
+		where
+			id = $3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, nullInt(policyId), time.Now(), roomId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetRestrictionsForRoomByDate returns restrictions for a room by date
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	// NULL is not appropriate in Go if the variable violates int type,
+	// so coalesce function can switch null to 0
+	query := `
+		select
+			id, coalesce(reservation_id, 0), restriction_id, room_id, start_date, end_date
+		from
+			room_restrictions
+		where 
+			$1 < end_date and $2 >= start_date
+			and
+			room_id = $3
+			and
+			restriction_id <> 3
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// InsertBlockForRoom inserts a room restriction
+func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		insert into
+			room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6)
+	`
 
 	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
 	if err != nil {
@@ -696,3 +1386,2602 @@ func (m *postgresDBRepo) DeleteBlockById(id int) error {
 
 	return nil
 }
+
+// AllRestrictionsForRoom returns every restriction for a room, with its restriction type
+func (m *postgresDBRepo) AllRestrictionsForRoom(roomId int) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select
+			rr.id, coalesce(rr.reservation_id, 0), rr.restriction_id, rr.room_id,
+			rr.start_date, rr.end_date, rr.created_at, rr.updated_at,
+			r.id, r.restriction_name
+		from
+			room_restrictions rr
+		left join
+			restrictions r on (rr.restriction_id = r.id)
+		where
+			rr.room_id = $1
+			and
+			(rr.expires_at is null or rr.expires_at > $2)
+		order by
+			rr.start_date asc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomId, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+			&r.Restriction.ID,
+			&r.Restriction.RestrictionName,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// AllExternalCalendars returns all external calendar feeds with their room
+func (m *postgresDBRepo) AllExternalCalendars() ([]models.ExternalCalendar, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var calendars []models.ExternalCalendar
+
+	query := `
+		select
+			c.id, c.room_id, c.name, c.url, c.last_synced_at, c.last_error,
+			c.created_at, c.updated_at, r.id, r.room_name
+		from
+			external_calendars c
+		left join
+			rooms r on (c.room_id = r.id)
+		order by
+			r.room_name, c.name
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return calendars, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c models.ExternalCalendar
+		var syncedAt sql.NullTime
+
+		err := rows.Scan(
+			&c.ID,
+			&c.RoomID,
+			&c.Name,
+			&c.URL,
+			&syncedAt,
+			&c.LastError,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.Room.ID,
+			&c.Room.RoomName,
+		)
+		if err != nil {
+			return calendars, err
+		}
+		c.LastSyncedAt = syncedAt.Time
+
+		calendars = append(calendars, c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return calendars, err
+	}
+
+	return calendars, nil
+}
+
+// GetExternalCalendarById returns one external calendar feed by id
+func (m *postgresDBRepo) GetExternalCalendarById(id int) (models.ExternalCalendar, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c models.ExternalCalendar
+	var syncedAt sql.NullTime
+
+	query := `
+		select
+			c.id, c.room_id, c.name, c.url, c.last_synced_at, c.last_error,
+			c.created_at, c.updated_at, r.id, r.room_name
+		from
+			external_calendars c
+		left join
+			rooms r on (c.room_id = r.id)
+		where
+			c.id = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&c.ID,
+		&c.RoomID,
+		&c.Name,
+		&c.URL,
+		&syncedAt,
+		&c.LastError,
+		&c.CreatedAt,
+		&c.UpdatedAt,
+		&c.Room.ID,
+		&c.Room.RoomName,
+	)
+	if err != nil {
+		return c, err
+	}
+	c.LastSyncedAt = syncedAt.Time
+
+	return c, nil
+}
+
+// InsertExternalCalendar adds an external calendar feed for a room
+func (m *postgresDBRepo) InsertExternalCalendar(c models.ExternalCalendar) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		insert into
+			external_calendars (room_id, name, url, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5)
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, c.RoomID, c.Name, c.URL, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExternalCalendar deletes an external calendar feed and the blocks imported from it
+func (m *postgresDBRepo) DeleteExternalCalendar(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			external_calendars
+		where
+			id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateExternalCalendarSync records the outcome of the latest sync of an external calendar
+func (m *postgresDBRepo) UpdateExternalCalendarSync(id int, syncedAt time.Time, syncError string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			external_calendars
+		set
+			last_synced_at = $1,
+			last_error = $2,
+			updated_at = $3
+		where
+			id = $4
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, syncedAt, syncError, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetBlocksForExternalCalendar returns the room blocks imported from an external calendar
+func (m *postgresDBRepo) GetBlocksForExternalCalendar(calendarId int) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `
+		select
+			id, restriction_id, room_id, start_date, end_date, external_calendar_id, external_uid
+		from
+			room_restrictions
+		where
+			external_calendar_id = $1
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, calendarId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+
+		err := rows.Scan(
+			&r.ID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.ExternalCalendarID,
+			&r.ExternalUID,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// UpsertExternalBlock inserts a block imported from an external calendar,
+// or updates its dates when the event is already known
+func (m *postgresDBRepo) UpsertExternalBlock(r models.RoomRestriction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		insert into
+			room_restrictions (start_date, end_date, room_id, restriction_id,
+				external_calendar_id, external_uid, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $7)
+		on conflict (external_calendar_id, external_uid) do update
+		set
+			start_date = excluded.start_date,
+			end_date = excluded.end_date,
+			room_id = excluded.room_id,
+			updated_at = excluded.updated_at
+	`
+
+	_, err := m.DB.ExecContext(
+		ctx,
+		query,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		r.RestrictionID,
+		r.ExternalCalendarID,
+		r.ExternalUID,
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllAPITokens returns all api tokens, newest first
+func (m *postgresDBRepo) AllAPITokens() ([]models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tokens []models.APIToken
+
+	query := `
+		select
+			id, name, token_hash, scope, rate_limit, expires_at, last_used_at, created_at, updated_at
+		from
+			api_tokens
+		order by
+			created_at desc
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return tokens, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.APIToken
+		var expiresAt, lastUsedAt sql.NullTime
+
+		err := rows.Scan(
+			&t.ID,
+			&t.Name,
+			&t.TokenHash,
+			&t.Scope,
+			&t.RateLimit,
+			&expiresAt,
+			&lastUsedAt,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+		)
+		if err != nil {
+			return tokens, err
+		}
+		t.ExpiresAt = expiresAt.Time
+		t.LastUsedAt = lastUsedAt.Time
+
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tokens, err
+	}
+
+	return tokens, nil
+}
+
+// InsertAPIToken stores a new api token; only the hash of the token is saved
+func (m *postgresDBRepo) InsertAPIToken(t models.APIToken) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+	var expiresAt sql.NullTime
+	if !t.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: t.ExpiresAt, Valid: true}
+	}
+
+	query := `
+		insert into
+			api_tokens (name, token_hash, scope, rate_limit, expires_at, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		t.Name,
+		t.TokenHash,
+		t.Scope,
+		t.RateLimit,
+		expiresAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// DeleteAPIToken revokes an api token by id
+func (m *postgresDBRepo) DeleteAPIToken(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			api_tokens
+		where
+			id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetAPITokenByHash returns the api token with the given hash
+func (m *postgresDBRepo) GetAPITokenByHash(hash string) (models.APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var t models.APIToken
+	var expiresAt, lastUsedAt sql.NullTime
+
+	query := `
+		select
+			id, name, token_hash, scope, rate_limit, expires_at, last_used_at, created_at, updated_at
+		from
+			api_tokens
+		where
+			token_hash = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, hash)
+	err := row.Scan(
+		&t.ID,
+		&t.Name,
+		&t.TokenHash,
+		&t.Scope,
+		&t.RateLimit,
+		&expiresAt,
+		&lastUsedAt,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return t, err
+	}
+	t.ExpiresAt = expiresAt.Time
+	t.LastUsedAt = lastUsedAt.Time
+
+	return t, nil
+}
+
+// UpdateAPITokenLastUsed records when an api token was last used
+func (m *postgresDBRepo) UpdateAPITokenLastUsed(id int, usedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			api_tokens
+		set
+			last_used_at = $1
+		where
+			id = $2
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, usedAt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AllWebhooks returns all registered webhooks
+func (m *postgresDBRepo) AllWebhooks() ([]models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var webhooks []models.Webhook
+
+	query := `
+		select
+			id, url, secret, events, active, created_at, updated_at
+		from
+			webhooks
+		order by
+			created_at
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return webhooks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w models.Webhook
+		var events string
+
+		err := rows.Scan(
+			&w.ID,
+			&w.URL,
+			&w.Secret,
+			&events,
+			&w.Active,
+			&w.CreatedAt,
+			&w.UpdatedAt,
+		)
+		if err != nil {
+			return webhooks, err
+		}
+		w.Events = splitList(events)
+
+		webhooks = append(webhooks, w)
+	}
+
+	if err = rows.Err(); err != nil {
+		return webhooks, err
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhookById returns one webhook by id
+func (m *postgresDBRepo) GetWebhookById(id int) (models.Webhook, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var w models.Webhook
+	var events string
+
+	query := `
+		select
+			id, url, secret, events, active, created_at, updated_at
+		from
+			webhooks
+		where
+			id = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&w.ID,
+		&w.URL,
+		&w.Secret,
+		&events,
+		&w.Active,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+	if err != nil {
+		return w, err
+	}
+	w.Events = splitList(events)
+
+	return w, nil
+}
+
+// InsertWebhook registers a webhook
+func (m *postgresDBRepo) InsertWebhook(w models.Webhook) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	query := `
+		insert into
+			webhooks (url, secret, events, active, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		w.URL,
+		w.Secret,
+		strings.Join(w.Events, ","),
+		w.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (m *postgresDBRepo) DeleteWebhook(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			webhooks
+		where
+			id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertWebhookDelivery queues an event for delivery to a webhook
+func (m *postgresDBRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	query := `
+		insert into
+			webhook_deliveries (webhook_id, event, payload, next_attempt_at, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		d.WebhookID,
+		d.Event,
+		d.Payload,
+		d.NextAttemptAt,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt
+func (m *postgresDBRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deliveredAt, nextAttemptAt sql.NullTime
+	if !d.DeliveredAt.IsZero() {
+		deliveredAt = sql.NullTime{Time: d.DeliveredAt, Valid: true}
+	}
+	if !d.NextAttemptAt.IsZero() {
+		nextAttemptAt = sql.NullTime{Time: d.NextAttemptAt, Valid: true}
+	}
+
+	query := `
+		update
+			webhook_deliveries
+		set
+			attempts = $1,
+			status_code = $2,
+			error = $3,
+			delivered_at = $4,
+			next_attempt_at = $5,
+			updated_at = $6
+		where
+			id = $7
+	`
+
+	_, err := m.DB.ExecContext(
+		ctx,
+		query,
+		d.Attempts,
+		d.StatusCode,
+		d.Error,
+		deliveredAt,
+		nextAttemptAt,
+		time.Now(),
+		d.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetDueWebhookDeliveries returns the deliveries waiting to be attempted, oldest first
+func (m *postgresDBRepo) GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return m.webhookDeliveriesWhere(`d.next_attempt_at <= $1 and w.active = true order by d.next_attempt_at asc limit $2`, now, limit)
+}
+
+// GetWebhookDeliveries returns the most recent deliveries for a webhook
+func (m *postgresDBRepo) GetWebhookDeliveries(webhookId, limit int) ([]models.WebhookDelivery, error) {
+	return m.webhookDeliveriesWhere(`d.webhook_id = $1 order by d.created_at desc limit $2`, webhookId, limit)
+}
+
+// webhookDeliveriesWhere returns the deliveries, with their webhook, matching a where clause
+func (m *postgresDBRepo) webhookDeliveriesWhere(where string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var deliveries []models.WebhookDelivery
+
+	query := fmt.Sprintf(`
+		select
+			d.id, d.webhook_id, d.event, d.payload, d.attempts, d.status_code, d.error,
+			d.delivered_at, d.next_attempt_at, d.created_at, d.updated_at,
+			w.id, w.url, w.secret, w.active
+		from
+			webhook_deliveries d
+		left join
+			webhooks w on (d.webhook_id = w.id)
+		where
+			%s
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return deliveries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt, nextAttemptAt sql.NullTime
+
+		err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			&d.Payload,
+			&d.Attempts,
+			&d.StatusCode,
+			&d.Error,
+			&deliveredAt,
+			&nextAttemptAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+			&d.Webhook.ID,
+			&d.Webhook.URL,
+			&d.Webhook.Secret,
+			&d.Webhook.Active,
+		)
+		if err != nil {
+			return deliveries, err
+		}
+		d.DeliveredAt = deliveredAt.Time
+		d.NextAttemptAt = nextAttemptAt.Time
+
+		deliveries = append(deliveries, d)
+	}
+
+	if err = rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// splitList splits a comma separated column into its values
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ClaimIdempotencyKey records a key before its request is processed. It returns
+// true when the key is new, or false and the existing record when it was already used.
+func (m *postgresDBRepo) ClaimIdempotencyKey(key, requestHash string) (models.IdempotencyKey, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	k := models.IdempotencyKey{
+		Key:         key,
+		RequestHash: requestHash,
+	}
+
+	query := `
+		insert into
+			idempotency_keys (key, request_hash, created_at, updated_at)
+		values
+			($1, $2, $3, $4)
+		on conflict (key) do nothing
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, key, requestHash, time.Now(), time.Now()).Scan(&k.ID)
+	if err == sql.ErrNoRows {
+		existing, err := m.GetIdempotencyKey(key)
+		return existing, false, err
+	} else if err != nil {
+		return k, false, err
+	}
+
+	return k, true, nil
+}
+
+// GetIdempotencyKey returns a key record by key
+func (m *postgresDBRepo) GetIdempotencyKey(key string) (models.IdempotencyKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var k models.IdempotencyKey
+
+	query := `
+		select
+			id, key, request_hash, coalesce(reservation_id, 0), created_at, updated_at
+		from
+			idempotency_keys
+		where
+			key = $1
+	`
+
+	row := m.DB.QueryRowContext(ctx, query, key)
+	err := row.Scan(
+		&k.ID,
+		&k.Key,
+		&k.RequestHash,
+		&k.ReservationID,
+		&k.CreatedAt,
+		&k.UpdatedAt,
+	)
+	if err != nil {
+		return k, err
+	}
+
+	return k, nil
+}
+
+// CompleteIdempotencyKey stores the reservation created for a key
+func (m *postgresDBRepo) CompleteIdempotencyKey(key string, reservationId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			idempotency_keys
+		set
+			reservation_id = $1,
+			updated_at = $2
+		where
+			key = $3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, reservationId, time.Now(), key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a key whose request failed, so it may be retried
+func (m *postgresDBRepo) ReleaseIdempotencyKey(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			idempotency_keys
+		where
+			key = $1 and reservation_id is null
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, key)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertHold holds a room for a guest until the restriction expires. It returns
+// repository.ErrRoomUnavailable when the room is taken for the dates.
+func (m *postgresDBRepo) InsertHold(r models.RoomRestriction) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	err = lockRoom(ctx, tx, r.RoomID)
+	if err != nil {
+		return 0, err
+	}
+
+	taken, err := roomTaken(ctx, tx, r.RoomID, r.StartDate, r.EndDate, now, 0)
+	if err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, repository.ErrRoomUnavailable
+	}
+
+	query := `
+		insert into
+			room_restrictions (start_date, end_date, room_id, restriction_id, expires_at, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7)
+		returning id
+	`
+
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		r.StartDate,
+		r.EndDate,
+		r.RoomID,
+		r.RestrictionID,
+		r.ExpiresAt,
+		now,
+		now,
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// DeleteHold releases a hold
+func (m *postgresDBRepo) DeleteHold(holdId int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			room_restrictions
+		where
+			id = $1 and restriction_id = 3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, holdId)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeleteExpiredHolds removes the holds that expired before now, returning how many were removed
+func (m *postgresDBRepo) DeleteExpiredHolds(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			room_restrictions
+		where
+			restriction_id = 3 and expires_at <= $1
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), nil
+}
+
+// AllStayRules returns every stay rule with its room, newest dates first
+func (m *postgresDBRepo) AllStayRules() ([]models.StayRule, error) {
+	return m.stayRulesWhere("true order by s.start_date desc, r.room_name")
+}
+
+// GetStayRules returns the stay rules whose dates overlap the stay from start to end
+func (m *postgresDBRepo) GetStayRules(start, end time.Time) ([]models.StayRule, error) {
+	return m.stayRulesWhere("s.start_date <= $2 and s.end_date >= $1 order by s.start_date", start, end)
+}
+
+// stayRulesWhere returns the stay rules, with their room, matching a where clause
+func (m *postgresDBRepo) stayRulesWhere(where string, args ...interface{}) ([]models.StayRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.StayRule
+
+	query := fmt.Sprintf(`
+		select
+			s.id, s.room_id, s.start_date, s.end_date, s.min_nights, s.max_nights,
+			s.closed_to_arrival, s.closed_to_departure, s.min_advance_days, s.max_advance_days,
+			s.created_at, s.updated_at, r.id, r.room_name
+		from
+			stay_rules s
+		left join
+			rooms r on (s.room_id = r.id)
+		where
+			%s
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.StayRule
+
+		err := rows.Scan(
+			&s.ID,
+			&s.RoomID,
+			&s.StartDate,
+			&s.EndDate,
+			&s.MinNights,
+			&s.MaxNights,
+			&s.ClosedToArrival,
+			&s.ClosedToDeparture,
+			&s.MinAdvanceDays,
+			&s.MaxAdvanceDays,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+			&s.Room.ID,
+			&s.Room.RoomName,
+		)
+		if err != nil {
+			return rules, err
+		}
+
+		rules = append(rules, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// InsertStayRule adds a stay rule for a room and returns its id
+func (m *postgresDBRepo) InsertStayRule(s models.StayRule) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	query := `
+		insert into
+			stay_rules (room_id, start_date, end_date, min_nights, max_nights, closed_to_arrival,
+				closed_to_departure, min_advance_days, max_advance_days, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		s.RoomID,
+		s.StartDate,
+		s.EndDate,
+		s.MinNights,
+		s.MaxNights,
+		s.ClosedToArrival,
+		s.ClosedToDeparture,
+		s.MinAdvanceDays,
+		s.MaxAdvanceDays,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// DeleteStayRule deletes a stay rule
+func (m *postgresDBRepo) DeleteStayRule(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			stay_rules
+		where
+			id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// InsertBooking stores a booking with a reservation and a restriction for each of its rooms,
+// all or nothing. It returns repository.ErrRoomUnavailable when one of the rooms is taken.
+func (m *postgresDBRepo) InsertBooking(b models.Booking) (models.Booking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return b, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	roomIds := make([]int, 0, len(b.Reservations))
+	for _, res := range b.Reservations {
+		roomIds = append(roomIds, res.RoomID)
+	}
+	err = lockRooms(ctx, tx, roomIds)
+	if err != nil {
+		return b, err
+	}
+
+	for _, res := range b.Reservations {
+		taken, err := roomTaken(ctx, tx, res.RoomID, res.StartDate, res.EndDate, now, 0)
+		if err != nil {
+			return b, err
+		}
+		if taken {
+			return b, repository.ErrRoomUnavailable
+		}
+	}
+
+	query := `
+		insert into
+			bookings (confirmation_code, first_name, last_name, email, phone, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7)
+		returning id
+	`
+
+	err = tx.QueryRowContext(ctx, query, b.ConfirmationCode, b.FirstName, b.LastName, b.Email, b.Phone, now, now).Scan(&b.ID)
+	if err != nil {
+		return b, err
+	}
+	b.CreatedAt = now
+	b.UpdatedAt = now
+
+	for i, res := range b.Reservations {
+		query = `
+			insert into
+				reservations (first_name, last_name, email, phone, start_date, end_date, room_id,
+					adults, children, subtotal, taxes, cancellation_policy_id, booking_id, locale,
+					check_in_time, check_out_time, created_at, updated_at)
+			values
+				($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+			returning id
+		`
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			b.FirstName,
+			b.LastName,
+			b.Email,
+			b.Phone,
+			res.StartDate,
+			res.EndDate,
+			res.RoomID,
+			res.Adults,
+			res.Children,
+			res.Subtotal,
+			res.Taxes,
+			nullInt(res.CancellationPolicyID),
+			b.ID,
+			locale(res.Locale),
+			timeOfDay(res.CheckInTime, m.App.CheckInTime),
+			timeOfDay(res.CheckOutTime, m.App.CheckOutTime),
+			now,
+			now,
+		).Scan(&res.ID)
+		if err != nil {
+			return b, err
+		}
+
+		err = insertReservationTaxes(ctx, tx, res.ID, res.TaxLines)
+		if err != nil {
+			return b, err
+		}
+
+		query = `
+			insert into
+				room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
+			values
+				($1, $2, $3, $4, $5, $6, $7)
+		`
+
+		_, err = tx.ExecContext(ctx, query, res.StartDate, res.EndDate, res.RoomID, res.ID, 1, now, now)
+		if err != nil {
+			return b, err
+		}
+
+		res.BookingID = b.ID
+		res.FirstName = b.FirstName
+		res.LastName = b.LastName
+		res.Email = b.Email
+		res.Phone = b.Phone
+		b.Reservations[i] = res
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
+
+// GetBookingById returns a booking with all its reservations, cancelled ones included
+func (m *postgresDBRepo) GetBookingById(id int) (models.Booking, error) {
+	bookings, err := m.bookingsWhere("b.id = $1", id)
+	if err != nil {
+		return models.Booking{}, err
+	}
+
+	if len(bookings) == 0 {
+		return models.Booking{}, sql.ErrNoRows
+	}
+
+	return bookings[0], nil
+}
+
+// AllBookings returns every booking with its reservations, newest first
+func (m *postgresDBRepo) AllBookings() ([]models.Booking, error) {
+	return m.bookingsWhere("true")
+}
+
+// bookingsWhere returns the bookings matching a where clause, with their reservations, newest first
+func (m *postgresDBRepo) bookingsWhere(where string, args ...interface{}) ([]models.Booking, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var bookings []models.Booking
+
+	query := fmt.Sprintf(`
+		select
+			b.id, b.confirmation_code, b.first_name, b.last_name, b.email, b.phone,
+			b.cancelled_at, b.created_at, b.updated_at
+		from
+			bookings b
+		where
+			%s
+		order by
+			b.created_at desc
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return bookings, err
+	}
+	defer rows.Close()
+
+	index := make(map[int]int)
+
+	for rows.Next() {
+		var b models.Booking
+		var cancelledAt sql.NullTime
+
+		err := rows.Scan(
+			&b.ID,
+			&b.ConfirmationCode,
+			&b.FirstName,
+			&b.LastName,
+			&b.Email,
+			&b.Phone,
+			&cancelledAt,
+			&b.CreatedAt,
+			&b.UpdatedAt,
+		)
+		if err != nil {
+			return bookings, err
+		}
+		b.CancelledAt = cancelledAt.Time
+
+		index[b.ID] = len(bookings)
+		bookings = append(bookings, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return bookings, err
+	}
+
+	if len(bookings) == 0 {
+		return bookings, nil
+	}
+
+	reservations, err := m.reservationsWhere(
+		fmt.Sprintf("r.booking_id in (select b.id from bookings b where %s)", where), args...)
+	if err != nil {
+		return bookings, err
+	}
+
+	for _, res := range reservations {
+		if i, ok := index[res.BookingID]; ok {
+			bookings[i].Reservations = append(bookings[i].Reservations, res)
+		}
+	}
+
+	return bookings, nil
+}
+
+// CancelBooking cancels a booking and every room in it, freeing the rooms. lines are the
+// booking's rooms still booked, with the penalty charged and the amount refunded for each.
+func (m *postgresDBRepo) CancelBooking(id int, lines []models.Reservation) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	query := `
+		update
+			bookings
+		set
+			cancelled_at = $1,
+			updated_at = $1
+		where
+			id = $2
+			and
+			cancelled_at is null
+	`
+
+	_, err = tx.ExecContext(ctx, query, now, id)
+	if err != nil {
+		return err
+	}
+
+	for _, res := range lines {
+		query = `
+			update
+				reservations
+			set
+				cancellation_penalty = $1,
+				cancellation_refund = $2
+			where
+				id = $3
+				and
+				booking_id = $4
+				and
+				cancelled_at is null
+		`
+
+		_, err = tx.ExecContext(ctx, query, res.CancellationPenalty, res.CancellationRefund, res.ID, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	query = `
+		update
+			reservations
+		set
+			cancelled_at = $1,
+			updated_at = $1
+		where
+			booking_id = $2
+			and
+			cancelled_at is null
+	`
+
+	_, err = tx.ExecContext(ctx, query, now, id)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		delete from
+			room_restrictions
+		where
+			reservation_id in (select id from reservations where booking_id = $1)
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AllWaitlistEntries returns the waitlist, oldest entry first
+func (m *postgresDBRepo) AllWaitlistEntries() ([]models.WaitlistEntry, error) {
+	return m.waitlistEntriesWhere("true")
+}
+
+// GetWaitlistCandidates returns the entries, oldest first, that could use a room freed from
+// start to end: their dates overlap, they asked for that room or any room, and they were
+// never offered one
+func (m *postgresDBRepo) GetWaitlistCandidates(roomId int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	return m.waitlistEntriesWhere(`
+		w.offered_at is null
+		and
+		(w.room_id is null or w.room_id = $1)
+		and
+		w.start_date < $3 and w.end_date > $2
+	`, roomId, start, end)
+}
+
+// GetWaitlistEntryByTokenHash returns the entry offered a room with the given booking link token hash
+func (m *postgresDBRepo) GetWaitlistEntryByTokenHash(hash string) (models.WaitlistEntry, error) {
+	if hash == "" {
+		return models.WaitlistEntry{}, sql.ErrNoRows
+	}
+
+	entries, err := m.waitlistEntriesWhere("w.token_hash = $1", hash)
+	if err != nil {
+		return models.WaitlistEntry{}, err
+	}
+
+	if len(entries) == 0 {
+		return models.WaitlistEntry{}, sql.ErrNoRows
+	}
+
+	return entries[0], nil
+}
+
+// waitlistEntriesWhere returns the waitlist entries, with their rooms, matching a where clause
+func (m *postgresDBRepo) waitlistEntriesWhere(where string, args ...interface{}) ([]models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.WaitlistEntry
+
+	query := fmt.Sprintf(`
+		select
+			w.id, w.name, w.email, coalesce(w.room_id, 0), w.start_date, w.end_date, w.adults, w.children,
+			coalesce(w.offered_room_id, 0), w.token_hash, w.offered_at, w.offer_expires_at, w.claimed_at,
+			w.created_at, w.updated_at, w.locale, coalesce(r.room_name, ''), coalesce(o.room_name, '')
+		from
+			waitlist_entries w
+		left join
+			rooms r on (w.room_id = r.id)
+		left join
+			rooms o on (w.offered_room_id = o.id)
+		where
+			%s
+		order by
+			w.created_at, w.id
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.WaitlistEntry
+		var offeredAt, offerExpiresAt, claimedAt sql.NullTime
+
+		err := rows.Scan(
+			&e.ID,
+			&e.Name,
+			&e.Email,
+			&e.RoomID,
+			&e.StartDate,
+			&e.EndDate,
+			&e.Adults,
+			&e.Children,
+			&e.OfferedRoomID,
+			&e.TokenHash,
+			&offeredAt,
+			&offerExpiresAt,
+			&claimedAt,
+			&e.CreatedAt,
+			&e.UpdatedAt,
+			&e.Locale,
+			&e.Room.RoomName,
+			&e.OfferedRoom.RoomName,
+		)
+		if err != nil {
+			return entries, err
+		}
+		e.OfferedAt = offeredAt.Time
+		e.OfferExpiresAt = offerExpiresAt.Time
+		e.ClaimedAt = claimedAt.Time
+		e.Room.ID = e.RoomID
+		e.OfferedRoom.ID = e.OfferedRoomID
+
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// InsertWaitlistEntry adds a guest to the waitlist and returns the entry's id
+func (m *postgresDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+	var roomId sql.NullInt64
+	if e.RoomID > 0 {
+		roomId = sql.NullInt64{Int64: int64(e.RoomID), Valid: true}
+	}
+
+	query := `
+		insert into
+			waitlist_entries (name, email, room_id, start_date, end_date, adults, children, locale,
+				created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		e.Name,
+		e.Email,
+		roomId,
+		e.StartDate,
+		e.EndDate,
+		e.Adults,
+		e.Children,
+		locale(e.Locale),
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// DeleteWaitlistEntry removes a waitlist entry
+func (m *postgresDBRepo) DeleteWaitlistEntry(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		delete from
+			waitlist_entries
+		where
+			id = $1
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// OfferWaitlistEntry records that an entry was sent a booking link for a room, valid until expiresAt
+func (m *postgresDBRepo) OfferWaitlistEntry(id, roomId int, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			waitlist_entries
+		set
+			offered_room_id = $1,
+			token_hash = $2,
+			offered_at = $3,
+			offer_expires_at = $4,
+			updated_at = $3
+		where
+			id = $5
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, roomId, tokenHash, time.Now(), expiresAt, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ClaimWaitlistEntry marks an entry's offer as used by the reservation made with it. It
+// reports false when the offer was already used or the reservation isn't for the room and
+// dates offered. An offer that expired while the guest held the room can still be claimed.
+func (m *postgresDBRepo) ClaimWaitlistEntry(id int, res models.Reservation) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			waitlist_entries
+		set
+			claimed_at = $1,
+			updated_at = $1
+		where
+			id = $2
+			and
+			claimed_at is null
+			and
+			offered_room_id = $3 and start_date = $4 and end_date = $5
+	`
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now(), id, res.RoomID, res.StartDate, res.EndDate)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// ExpireWaitlistOffers voids the booking links that expired unclaimed by now and returns
+// their entries, each once, so the rooms they offered can go to the next guest
+func (m *postgresDBRepo) ExpireWaitlistOffers(now time.Time) ([]models.WaitlistEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var entries []models.WaitlistEntry
+
+	query := `
+		update
+			waitlist_entries
+		set
+			token_hash = '',
+			updated_at = $1
+		where
+			claimed_at is null
+			and
+			token_hash <> ''
+			and
+			offer_expires_at <= $1
+		returning
+			id, coalesce(offered_room_id, 0), start_date, end_date
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, now)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e models.WaitlistEntry
+		err := rows.Scan(&e.ID, &e.OfferedRoomID, &e.StartDate, &e.EndDate)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return entries, err
+	}
+
+	return entries, nil
+}
+
+// AllPromoCodes returns every promo code with how often it was used and the discount it gave,
+// newest first
+func (m *postgresDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	return m.promoCodesWhere("true")
+}
+
+// GetPromoCodeById returns a promo code with its usage
+func (m *postgresDBRepo) GetPromoCodeById(id int) (models.PromoCode, error) {
+	codes, err := m.promoCodesWhere("p.id = $1", id)
+	if err != nil {
+		return models.PromoCode{}, err
+	}
+
+	if len(codes) == 0 {
+		return models.PromoCode{}, sql.ErrNoRows
+	}
+
+	return codes[0], nil
+}
+
+// GetPromoCodeByCode returns the promo code a guest entered, ignoring case
+func (m *postgresDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	codes, err := m.promoCodesWhere("upper(p.code) = upper($1)", code)
+	if err != nil {
+		return models.PromoCode{}, err
+	}
+
+	if len(codes) == 0 {
+		return models.PromoCode{}, sql.ErrNoRows
+	}
+
+	return codes[0], nil
+}
+
+// promoCodesWhere returns the promo codes matching a where clause. Cancelled reservations
+// don't count towards a code's uses or discount total.
+func (m *postgresDBRepo) promoCodesWhere(where string, args ...interface{}) ([]models.PromoCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var codes []models.PromoCode
+
+	query := fmt.Sprintf(`
+		select
+			p.id, p.code, p.description, p.discount_type, p.amount, coalesce(p.room_id, 0),
+			p.valid_from, p.valid_to, p.stay_from, p.stay_to, p.max_uses, p.max_uses_per_guest,
+			p.active, p.created_at, p.updated_at, coalesce(rm.room_name, ''),
+			(select count(r.id) from reservations r where r.promo_code_id = p.id and r.cancelled_at is null),
+			(select coalesce(sum(r.discount), 0) from reservations r where r.promo_code_id = p.id and r.cancelled_at is null)
+		from
+			promo_codes p
+		left join
+			rooms rm on (p.room_id = rm.id)
+		where
+			%s
+		order by
+			p.created_at desc
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return codes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.PromoCode
+		var validFrom, validTo, stayFrom, stayTo sql.NullTime
+
+		err := rows.Scan(
+			&p.ID,
+			&p.Code,
+			&p.Description,
+			&p.DiscountType,
+			&p.Amount,
+			&p.RoomID,
+			&validFrom,
+			&validTo,
+			&stayFrom,
+			&stayTo,
+			&p.MaxUses,
+			&p.MaxUsesPerGuest,
+			&p.Active,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.Room.RoomName,
+			&p.Uses,
+			&p.DiscountTotal,
+		)
+		if err != nil {
+			return codes, err
+		}
+		p.ValidFrom = validFrom.Time
+		p.ValidTo = validTo.Time
+		p.StayFrom = stayFrom.Time
+		p.StayTo = stayTo.Time
+		p.Room.ID = p.RoomID
+
+		codes = append(codes, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return codes, err
+	}
+
+	return codes, nil
+}
+
+// InsertPromoCode adds a promo code and returns its id
+func (m *postgresDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	// zero values mean no restriction and are stored as null
+	nullTime := func(t time.Time) sql.NullTime {
+		return sql.NullTime{Time: t, Valid: !t.IsZero()}
+	}
+
+	var roomId sql.NullInt64
+	if p.RoomID > 0 {
+		roomId = sql.NullInt64{Int64: int64(p.RoomID), Valid: true}
+	}
+
+	query := `
+		insert into
+			promo_codes (code, description, discount_type, amount, room_id, valid_from, valid_to,
+				stay_from, stay_to, max_uses, max_uses_per_guest, active, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		p.Code,
+		p.Description,
+		p.DiscountType,
+		p.Amount,
+		roomId,
+		nullTime(p.ValidFrom),
+		nullTime(p.ValidTo),
+		nullTime(p.StayFrom),
+		nullTime(p.StayTo),
+		p.MaxUses,
+		p.MaxUsesPerGuest,
+		p.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// UpdatePromoCodeActive switches a promo code on or off
+func (m *postgresDBRepo) UpdatePromoCodeActive(id int, active bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			promo_codes
+		set
+			active = $1,
+			updated_at = $2
+		where
+			id = $3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CountPromoCodeUsesByEmail returns how many live reservations a guest made with a promo code
+func (m *postgresDBRepo) CountPromoCodeUsesByEmail(id int, email string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+
+	query := `
+		select
+			count(id)
+		from
+			reservations
+		where
+			promo_code_id = $1
+			and
+			lower(email) = lower($2)
+			and
+			cancelled_at is null
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, id, email).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// GetReservationsForPromoCode returns the reservations made with a promo code, cancelled ones included
+func (m *postgresDBRepo) GetReservationsForPromoCode(id int) ([]models.Reservation, error) {
+	return m.reservationsWhere("r.promo_code_id = $1", id)
+}
+
+// AllCancellationPolicies returns every cancellation policy, by name
+func (m *postgresDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	return m.cancellationPoliciesWhere("true")
+}
+
+// GetCancellationPolicyById returns a cancellation policy
+func (m *postgresDBRepo) GetCancellationPolicyById(id int) (models.CancellationPolicy, error) {
+	policies, err := m.cancellationPoliciesWhere("id = $1", id)
+	if err != nil {
+		return models.CancellationPolicy{}, err
+	}
+
+	if len(policies) == 0 {
+		return models.CancellationPolicy{}, sql.ErrNoRows
+	}
+
+	return policies[0], nil
+}
+
+// cancellationPoliciesWhere returns the cancellation policies matching a where clause
+func (m *postgresDBRepo) cancellationPoliciesWhere(where string, args ...interface{}) ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	query := fmt.Sprintf(`
+		select
+			id, name, free_days, penalty_type, penalty_percent, non_refundable, created_at, updated_at
+		from
+			cancellation_policies
+		where
+			%s
+		order by
+			name
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.CancellationPolicy
+
+		err := rows.Scan(
+			&p.ID,
+			&p.Name,
+			&p.FreeDays,
+			&p.PenaltyType,
+			&p.PenaltyPercent,
+			&p.NonRefundable,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return policies, err
+		}
+
+		policies = append(policies, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+// InsertCancellationPolicy adds a cancellation policy and returns its id
+func (m *postgresDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	query := `
+		insert into
+			cancellation_policies (name, free_days, penalty_type, penalty_percent, non_refundable, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		p.Name,
+		p.FreeDays,
+		p.PenaltyType,
+		p.PenaltyPercent,
+		p.NonRefundable,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// InsertPayment records a payment for a reservation and returns its id
+func (m *postgresDBRepo) InsertPayment(p models.Payment) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	query := `
+		insert into
+			payments (reservation_id, provider, reference, status, amount, refunded, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $8)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		p.ReservationID,
+		p.Provider,
+		p.Reference,
+		p.Status,
+		p.Amount,
+		p.Refunded,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// GetPaymentById returns a payment
+func (m *postgresDBRepo) GetPaymentById(id int) (models.Payment, error) {
+	payments, err := m.paymentsWhere("p.id = $1", id)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	if len(payments) == 0 {
+		return models.Payment{}, sql.ErrNoRows
+	}
+
+	return payments[0], nil
+}
+
+// GetPaymentsForReservation returns the payments for a reservation, oldest first
+func (m *postgresDBRepo) GetPaymentsForReservation(reservationId int) ([]models.Payment, error) {
+	return m.paymentsWhere("p.reservation_id = $1", reservationId)
+}
+
+// GetPaymentsDepartingBetween returns the payments for reservations departing between two dates
+func (m *postgresDBRepo) GetPaymentsDepartingBetween(start, end time.Time) ([]models.Payment, error) {
+	return m.paymentsWhere("r.end_date >= $1 and r.end_date <= $2", start, end)
+}
+
+// paymentsWhere returns the payments matching a where clause
+func (m *postgresDBRepo) paymentsWhere(where string, args ...interface{}) ([]models.Payment, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var payments []models.Payment
+
+	query := fmt.Sprintf(`
+		select
+			p.id, p.reservation_id, p.provider, p.reference, p.status, p.amount, p.refunded,
+			p.created_at, p.updated_at
+		from
+			payments p
+			left join reservations r on (r.id = p.reservation_id)
+		where
+			%s
+		order by
+			p.created_at, p.id
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Provider,
+			&p.Reference,
+			&p.Status,
+			&p.Amount,
+			&p.Refunded,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return payments, err
+		}
+
+		payments = append(payments, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return payments, err
+	}
+
+	return payments, nil
+}
+
+// UpdatePaymentStatus records what happened to a payment at the provider
+func (m *postgresDBRepo) UpdatePaymentStatus(id int, status string, refunded int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			payments
+		set
+			status = $1,
+			refunded = $2,
+			updated_at = $3
+		where
+			id = $4
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, status, refunded, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetReservationsDepartingBetween returns the reservations, cancelled or not, departing
+// between two dates
+func (m *postgresDBRepo) GetReservationsDepartingBetween(start, end time.Time) ([]models.Reservation, error) {
+	return m.reservationsWhere("r.end_date >= $1 and r.end_date <= $2", start, end)
+}
+
+// InsertFolioItem posts an item to a reservation's folio and returns its id
+func (m *postgresDBRepo) InsertFolioItem(item models.FolioItem) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	query := `
+		insert into
+			folio_items (reservation_id, kind, description, amount, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		item.ReservationID,
+		item.Kind,
+		item.Description,
+		item.Amount,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// GetFolioItemsForReservation returns the items posted to a reservation's folio, oldest first
+func (m *postgresDBRepo) GetFolioItemsForReservation(reservationId int) ([]models.FolioItem, error) {
+	return m.folioItemsWhere("f.reservation_id = $1", reservationId)
+}
+
+// GetFolioItemsDepartingBetween returns the folio items of reservations departing between two dates
+func (m *postgresDBRepo) GetFolioItemsDepartingBetween(start, end time.Time) ([]models.FolioItem, error) {
+	return m.folioItemsWhere("r.end_date >= $1 and r.end_date <= $2", start, end)
+}
+
+// folioItemsWhere returns the folio items matching a where clause
+func (m *postgresDBRepo) folioItemsWhere(where string, args ...interface{}) ([]models.FolioItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var items []models.FolioItem
+
+	query := fmt.Sprintf(`
+		select
+			f.id, f.reservation_id, f.kind, f.description, f.amount, f.created_at, f.updated_at
+		from
+			folio_items f
+			left join reservations r on (r.id = f.reservation_id)
+		where
+			%s
+		order by
+			f.created_at, f.id
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.FolioItem
+
+		err := rows.Scan(
+			&item.ID,
+			&item.ReservationID,
+			&item.Kind,
+			&item.Description,
+			&item.Amount,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+		)
+		if err != nil {
+			return items, err
+		}
+
+		items = append(items, item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return items, err
+	}
+
+	return items, nil
+}
+
+// GetOrCreateInvoice returns the invoice of a reservation, issuing it with the next invoice
+// number the first time. Only issuing locks the sequence row, which stays locked until the
+// invoice is stored, so numbers have no gaps. render draws the PDF of a new invoice, which is
+// stored with it so the invoice doesn't change when the folio does.
+func (m *postgresDBRepo) GetOrCreateInvoice(reservationId int, render func(inv models.Invoice) []byte) (models.Invoice, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	inv, err := invoiceForReservation(ctx, m.DB, reservationId)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return inv, err
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	var lastNumber int
+
+	err = tx.QueryRowContext(ctx, `select last_number from invoice_sequence for update`).Scan(&lastNumber)
+	if err != nil {
+		return inv, err
+	}
+
+	// another request may have issued the invoice while this one waited for the lock
+	inv, err = invoiceForReservation(ctx, tx, reservationId)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return inv, err
+	}
+
+	inv.Number = lastNumber + 1
+	inv.CreatedAt = time.Now()
+	inv.UpdatedAt = inv.CreatedAt
+	inv.PDF = render(inv)
+
+	_, err = tx.ExecContext(ctx, `update invoice_sequence set last_number = $1, updated_at = $2`, inv.Number, inv.CreatedAt)
+	if err != nil {
+		return inv, err
+	}
+
+	query := `
+		insert into
+			invoices (number, reservation_id, pdf, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5)
+		returning id
+	`
+
+	err = tx.QueryRowContext(ctx, query, inv.Number, reservationId, inv.PDF, inv.CreatedAt, inv.UpdatedAt).Scan(&inv.ID)
+	if err != nil {
+		return inv, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return inv, err
+	}
+
+	return inv, nil
+}
+
+// invoiceForReservation returns the invoice issued for a reservation, or sql.ErrNoRows
+func invoiceForReservation(ctx context.Context, q rowQuerier, reservationId int) (models.Invoice, error) {
+	inv := models.Invoice{ReservationID: reservationId}
+
+	query := `
+		select
+			id, number, pdf, created_at, updated_at
+		from
+			invoices
+		where
+			reservation_id = $1
+	`
+
+	err := q.QueryRowContext(ctx, query, reservationId).Scan(&inv.ID, &inv.Number, &inv.PDF, &inv.CreatedAt, &inv.UpdatedAt)
+	return inv, err
+}
+
+// AllTaxes returns every tax and fee, active or not, by name
+func (m *postgresDBRepo) AllTaxes() ([]models.Tax, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rules []models.Tax
+
+	query := `
+		select
+			t.id, t.name, t.kind, t.basis, t.per, t.amount, t.inclusive, coalesce(t.room_id, 0),
+			t.effective_from, t.effective_to, t.active, t.created_at, t.updated_at,
+			coalesce(rm.room_name, '')
+		from
+			taxes t
+		left join
+			rooms rm on (t.room_id = rm.id)
+		order by
+			t.name, t.id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rules, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.Tax
+		var effectiveFrom, effectiveTo sql.NullTime
+
+		err := rows.Scan(
+			&t.ID,
+			&t.Name,
+			&t.Kind,
+			&t.Basis,
+			&t.Per,
+			&t.Amount,
+			&t.Inclusive,
+			&t.RoomID,
+			&effectiveFrom,
+			&effectiveTo,
+			&t.Active,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+			&t.Room.RoomName,
+		)
+		if err != nil {
+			return rules, err
+		}
+		t.EffectiveFrom = effectiveFrom.Time
+		t.EffectiveTo = effectiveTo.Time
+		t.Room.ID = t.RoomID
+
+		rules = append(rules, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// InsertTax adds a tax or fee and returns its id
+func (m *postgresDBRepo) InsertTax(t models.Tax) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newId int
+
+	// zero dates mean no restriction and are stored as null
+	nullTime := func(t time.Time) sql.NullTime {
+		return sql.NullTime{Time: t, Valid: !t.IsZero()}
+	}
+
+	query := `
+		insert into
+			taxes (name, kind, basis, per, amount, inclusive, room_id, effective_from, effective_to,
+				active, created_at, updated_at)
+		values
+			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		returning id
+	`
+
+	err := m.DB.QueryRowContext(
+		ctx,
+		query,
+		t.Name,
+		t.Kind,
+		t.Basis,
+		t.Per,
+		t.Amount,
+		t.Inclusive,
+		nullInt(t.RoomID),
+		nullTime(t.EffectiveFrom),
+		nullTime(t.EffectiveTo),
+		t.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newId)
+	if err != nil {
+		return 0, err
+	}
+
+	return newId, nil
+}
+
+// UpdateTaxActive switches a tax or fee on or off for new reservations
+func (m *postgresDBRepo) UpdateTaxActive(id int, active bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+		update
+			taxes
+		set
+			active = $1,
+			updated_at = $2
+		where
+			id = $3
+	`
+
+	_, err := m.DB.ExecContext(ctx, query, active, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetReservationTaxesDepartingBetween returns the taxes and fees charged on reservations
+// departing between two dates, inclusive
+func (m *postgresDBRepo) GetReservationTaxesDepartingBetween(start, end time.Time) ([]models.ReservationTax, error) {
+	return m.reservationTaxesWhere("r.end_date >= $1 and r.end_date <= $2", start, end)
+}
+
+// reservationTaxesWhere returns the taxes and fees charged on the reservations matching a where clause
+func (m *postgresDBRepo) reservationTaxesWhere(where string, args ...interface{}) ([]models.ReservationTax, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var lines []models.ReservationTax
+
+	query := fmt.Sprintf(`
+		select
+			t.id, t.reservation_id, coalesce(t.tax_id, 0), t.name, t.kind, t.inclusive, t.amount,
+			t.created_at, t.updated_at
+		from
+			reservation_taxes t
+			left join reservations r on (r.id = t.reservation_id)
+		where
+			%s
+		order by
+			t.id
+	`, where)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return lines, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line models.ReservationTax
+
+		err := rows.Scan(
+			&line.ID,
+			&line.ReservationID,
+			&line.TaxID,
+			&line.Name,
+			&line.Kind,
+			&line.Inclusive,
+			&line.Amount,
+			&line.CreatedAt,
+			&line.UpdatedAt,
+		)
+		if err != nil {
+			return lines, err
+		}
+
+		lines = append(lines, line)
+	}
+
+	if err = rows.Err(); err != nil {
+		return lines, err
+	}
+
+	return lines, nil
+}
+
+// AllExchangeRates returns the exchange rates from the base currency, by currency
+func (m *postgresDBRepo) AllExchangeRates() ([]models.ExchangeRate, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var rates []models.ExchangeRate
+
+	query := `
+		select
+			id, currency, rate, created_at, updated_at
+		from
+			exchange_rates
+		order by
+			currency
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return rates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.ExchangeRate
+
+		err := rows.Scan(
+			&r.ID,
+			&r.Currency,
+			&r.Rate,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return rates, err
+		}
+
+		rates = append(rates, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return rates, err
+	}
+
+	return rates, nil
+}
+
+// SaveExchangeRates adds exchange rates, replacing any already held for the same currencies.
+// Either all of the rates are saved or none are.
+func (m *postgresDBRepo) SaveExchangeRates(rates []models.ExchangeRate) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		insert into
+			exchange_rates (currency, rate, created_at, updated_at)
+		values
+			($1, $2, $3, $3)
+		on conflict (currency) do update
+		set
+			rate = excluded.rate,
+			updated_at = excluded.updated_at
+	`
+
+	for _, r := range rates {
+		_, err = tx.ExecContext(ctx, query, r.Currency, r.Rate, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExchangeRate removes an exchange rate, so prices are no longer shown in its currency
+func (m *postgresDBRepo) DeleteExchangeRate(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `delete from exchange_rates where id = $1`
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
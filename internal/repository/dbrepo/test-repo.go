@@ -1,21 +1,45 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/tsawler/bookings-app/internal/helpers"
 	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
 )
 
 func (m *testDBRepo) AllUsers() bool {
 	return true
 }
 
+// Ping always reaches the database, unless ctx is done first
+func (m *testDBRepo) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// MigrationVersion returns the version of the newest migration when the tests were written
+func (m *testDBRepo) MigrationVersion(ctx context.Context) (string, error) {
+	return "20261020040000", nil
+}
+
 // InsertReservation inserts a reservation into the database
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(res models.Reservation, holdId int) (int, error) {
 	if res.FirstName == "Invalid" {
 		return 0, errors.New("wrong first_name")
 	}
+	// slow@guest.com is beaten to every room
+	if res.Email == "slow@guest.com" {
+		return 0, repository.ErrRoomUnavailable
+	}
+	// late@guest.com is beaten to the last use of every promo code
+	if res.PromoCodeID > 0 && res.Email == "late@guest.com" {
+		return 0, repository.ErrPromoCodeUsedUp
+	}
 	return 1, nil
 }
 
@@ -29,13 +53,33 @@ func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 
 // SearchAvailabilityByDatesByRoomId returns true if availability exists for roomId
 func (m *testDBRepo) SearchAvailabilityByDatesByRoomId(start, end time.Time, roomId int) (bool, error) {
+	if roomId == 1 {
+		return true, nil
+	}
 	return false, nil
 }
 
+// SearchAvailabilityExceptHold returns true if roomId is free apart from the guest's own hold.
+// Hold 1 is on room 2.
+func (m *testDBRepo) SearchAvailabilityExceptHold(start, end time.Time, roomId, holdId int) (bool, error) {
+	if roomId == 2 && holdId == 1 {
+		return true, nil
+	}
+	return m.SearchAvailabilityByDatesByRoomId(start, end, roomId)
+}
+
 // SearchAvailabilityForAllRooms returns a slice of available rooms, if any, for given date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, error) {
 	var rooms []models.Room
 
+	// both rooms are free in 2060, where the test stay rules apply
+	if start.Year() == 2060 {
+		rooms = append(rooms,
+			models.Room{ID: 1, RoomName: "General's Quarters", MaxOccupancy: 2},
+			models.Room{ID: 2, RoomName: "Major's Suite", MaxOccupancy: 4},
+		)
+	}
+
 	return rooms, nil
 }
 
@@ -47,6 +91,11 @@ func (m *testDBRepo) GetRoomById(id int) (models.Room, error) {
 		return room, errors.New("some error")
 	}
 
+	room.ID = id
+	room.MaxOccupancy = 2 * id
+	room.NightlyRate = 10000 * id
+	room.CancellationPolicyID = id
+
 	return room, nil
 }
 
@@ -88,6 +137,13 @@ func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
 func (m *testDBRepo) GetReservationById(id int) (models.Reservation, error) {
 	var res models.Reservation
 
+	if id > 2 {
+		return res, sql.ErrNoRows
+	}
+
+	res.ID = id
+	res.RoomID = 1
+
 	return res, nil
 }
 
@@ -98,6 +154,13 @@ func (m *testDBRepo) UpdateReservation(res models.Reservation) error {
 
 // DeleteReservation deletes a reservation by id
 func (m *testDBRepo) DeleteReservation(id int) error {
+	// reservation 1 has an invoice, and 4 fails
+	switch id {
+	case 1:
+		return repository.ErrReservationInvoiced
+	case 4:
+		return errors.New("some error")
+	}
 	return nil
 }
 
@@ -106,6 +169,29 @@ func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
 	return nil
 }
 
+// CancelReservation marks a reservation as cancelled and releases its room restrictions
+func (m *testDBRepo) CancelReservation(id, penalty, refund int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	// reservation 2 is always cancelled by someone else first
+	if id == 2 {
+		return repository.ErrAlreadyCancelled
+	}
+	return nil
+}
+
+// GetReservationDigest returns the reservation activity since a point in time,
+// along with the arrivals and departures for the given day
+func (m *testDBRepo) GetReservationDigest(since, day time.Time) (models.Digest, error) {
+	digest := models.Digest{
+		Since: since,
+		Day:   day,
+	}
+
+	return digest, nil
+}
+
 // AllRooms get all rooms
 func (m *testDBRepo) AllRooms() ([]models.Room, error) {
 	var rooms []models.Room
@@ -113,6 +199,53 @@ func (m *testDBRepo) AllRooms() ([]models.Room, error) {
 	return rooms, nil
 }
 
+// GetRoomByICalToken gets the room whose calendar feed uses the given token
+func (m *testDBRepo) GetRoomByICalToken(token string) (models.Room, error) {
+	var room models.Room
+
+	if token != "valid-token" {
+		return room, errors.New("no room for token")
+	}
+
+	room.ID = 1
+	room.RoomName = "General's Quarters"
+	room.ICalToken = token
+
+	return room, nil
+}
+
+// UpdateRoomICalToken sets the calendar feed token for a room
+func (m *testDBRepo) UpdateRoomICalToken(roomId int, token string) error {
+	if roomId > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// UpdateRoomMaxOccupancy sets how many guests a room sleeps
+func (m *testDBRepo) UpdateRoomMaxOccupancy(roomId, maxOccupancy int) error {
+	if roomId > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// UpdateRoomNightlyRate sets the price of a night in a room
+func (m *testDBRepo) UpdateRoomNightlyRate(roomId, rate int) error {
+	if roomId > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// UpdateRoomCancellationPolicy sets the cancellation policy for a room
+func (m *testDBRepo) UpdateRoomCancellationPolicy(roomId, policyId int) error {
+	if roomId > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
 // GetRestrictionsForRoomByDate returns restrictions for a room by date
 func (m *testDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
 	var restrictions []models.RoomRestriction
@@ -129,3 +262,739 @@ func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 func (m *testDBRepo) DeleteBlockById(id int) error {
 	return nil
 }
+
+// AllRestrictionsForRoom returns every restriction for a room, with its restriction type
+func (m *testDBRepo) AllRestrictionsForRoom(roomId int) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+
+	sd, _ := time.Parse("2006-01-02", "2050-01-01")
+	ed, _ := time.Parse("2006-01-02", "2050-01-03")
+
+	restrictions = append(restrictions, models.RoomRestriction{
+		ID:            1,
+		RoomID:        roomId,
+		ReservationID: 1,
+		RestrictionID: 1,
+		StartDate:     sd,
+		EndDate:       ed,
+		Restriction:   models.Restriction{ID: 1, RestrictionName: "Reservation"},
+	})
+
+	return restrictions, nil
+}
+
+// AllExternalCalendars returns all external calendar feeds with their room
+func (m *testDBRepo) AllExternalCalendars() ([]models.ExternalCalendar, error) {
+	var calendars []models.ExternalCalendar
+
+	return calendars, nil
+}
+
+// GetExternalCalendarById returns one external calendar feed by id
+func (m *testDBRepo) GetExternalCalendarById(id int) (models.ExternalCalendar, error) {
+	var c models.ExternalCalendar
+
+	if id > 2 {
+		return c, errors.New("some error")
+	}
+
+	c.ID = id
+	c.RoomID = 1
+
+	return c, nil
+}
+
+// InsertExternalCalendar adds an external calendar feed for a room
+func (m *testDBRepo) InsertExternalCalendar(c models.ExternalCalendar) error {
+	if c.RoomID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// DeleteExternalCalendar deletes an external calendar feed and the blocks imported from it
+func (m *testDBRepo) DeleteExternalCalendar(id int) error {
+	return nil
+}
+
+// UpdateExternalCalendarSync records the outcome of the latest sync of an external calendar
+func (m *testDBRepo) UpdateExternalCalendarSync(id int, syncedAt time.Time, syncError string) error {
+	return nil
+}
+
+// GetBlocksForExternalCalendar returns the room blocks imported from an external calendar
+func (m *testDBRepo) GetBlocksForExternalCalendar(calendarId int) ([]models.RoomRestriction, error) {
+	var restrictions []models.RoomRestriction
+
+	return restrictions, nil
+}
+
+// UpsertExternalBlock inserts a block imported from an external calendar,
+// or updates its dates when the event is already known
+func (m *testDBRepo) UpsertExternalBlock(r models.RoomRestriction) error {
+	return nil
+}
+
+// AllAPITokens returns all api tokens, newest first
+func (m *testDBRepo) AllAPITokens() ([]models.APIToken, error) {
+	var tokens []models.APIToken
+
+	return tokens, nil
+}
+
+// InsertAPIToken stores a new api token; only the hash of the token is saved
+func (m *testDBRepo) InsertAPIToken(t models.APIToken) (int, error) {
+	if t.Name == "Invalid" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// DeleteAPIToken revokes an api token by id
+func (m *testDBRepo) DeleteAPIToken(id int) error {
+	return nil
+}
+
+// GetAPITokenByHash returns the api token with the given hash. The test
+// tokens are "read-token", "write-token", "expired-token" and "limited-token".
+func (m *testDBRepo) GetAPITokenByHash(hash string) (models.APIToken, error) {
+	tokens := map[string]models.APIToken{
+		"read-token":    {ID: 1, Name: "read", Scope: "read"},
+		"write-token":   {ID: 2, Name: "write", Scope: "write"},
+		"expired-token": {ID: 3, Name: "expired", Scope: "write", ExpiresAt: time.Now().Add(-time.Hour)},
+		"limited-token": {ID: 4, Name: "limited", Scope: "read", RateLimit: 1},
+	}
+
+	for token, t := range tokens {
+		if helpers.HashToken(token) == hash {
+			t.TokenHash = hash
+			return t, nil
+		}
+	}
+
+	return models.APIToken{}, sql.ErrNoRows
+}
+
+// UpdateAPITokenLastUsed records when an api token was last used
+func (m *testDBRepo) UpdateAPITokenLastUsed(id int, usedAt time.Time) error {
+	return nil
+}
+
+// AllWebhooks returns all registered webhooks
+func (m *testDBRepo) AllWebhooks() ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+
+	return webhooks, nil
+}
+
+// GetWebhookById returns one webhook by id
+func (m *testDBRepo) GetWebhookById(id int) (models.Webhook, error) {
+	var w models.Webhook
+
+	if id > 2 {
+		return w, sql.ErrNoRows
+	}
+
+	w.ID = id
+
+	return w, nil
+}
+
+// InsertWebhook registers a webhook
+func (m *testDBRepo) InsertWebhook(w models.Webhook) (int, error) {
+	return 1, nil
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (m *testDBRepo) DeleteWebhook(id int) error {
+	return nil
+}
+
+// InsertWebhookDelivery queues an event for delivery to a webhook
+func (m *testDBRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	return 1, nil
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt
+func (m *testDBRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	return nil
+}
+
+// GetDueWebhookDeliveries returns the deliveries waiting to be attempted, oldest first
+func (m *testDBRepo) GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	return deliveries, nil
+}
+
+// GetWebhookDeliveries returns the most recent deliveries for a webhook
+func (m *testDBRepo) GetWebhookDeliveries(webhookId, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	return deliveries, nil
+}
+
+// ClaimIdempotencyKey records a key before its request is processed. Keys
+// ending in "used" were already completed for reservation 1, keys ending in
+// "pending" are still being processed and keys ending in "other" were used
+// for a different request.
+func (m *testDBRepo) ClaimIdempotencyKey(key, requestHash string) (models.IdempotencyKey, bool, error) {
+	k := models.IdempotencyKey{
+		Key:         key,
+		RequestHash: requestHash,
+	}
+
+	switch {
+	case strings.HasSuffix(key, "used"):
+		k.ReservationID = 1
+		return k, false, nil
+	case strings.HasSuffix(key, "pending"):
+		return k, false, nil
+	case strings.HasSuffix(key, "other"):
+		k.RequestHash = "different"
+		k.ReservationID = 1
+		return k, false, nil
+	case strings.HasSuffix(key, "error"):
+		return k, false, errors.New("some error")
+	}
+
+	return k, true, nil
+}
+
+// GetIdempotencyKey returns a key record by key
+func (m *testDBRepo) GetIdempotencyKey(key string) (models.IdempotencyKey, error) {
+	k, _, err := m.ClaimIdempotencyKey(key, "")
+	return k, err
+}
+
+// CompleteIdempotencyKey stores the reservation created for a key
+func (m *testDBRepo) CompleteIdempotencyKey(key string, reservationId int) error {
+	return nil
+}
+
+// ReleaseIdempotencyKey removes a key whose request failed, so it may be retried
+func (m *testDBRepo) ReleaseIdempotencyKey(key string) error {
+	return nil
+}
+
+// InsertHold holds a room for a guest until the restriction expires
+func (m *testDBRepo) InsertHold(r models.RoomRestriction) (int, error) {
+	if r.RoomID > 2 {
+		return 0, errors.New("room_id > 2")
+	}
+	if r.RoomID == 2 {
+		return 0, repository.ErrRoomUnavailable
+	}
+	return 1, nil
+}
+
+// DeleteHold releases a hold
+func (m *testDBRepo) DeleteHold(holdId int) error {
+	return nil
+}
+
+// DeleteExpiredHolds removes the holds that expired before now
+func (m *testDBRepo) DeleteExpiredHolds(now time.Time) (int, error) {
+	return 0, nil
+}
+
+// AllStayRules returns every stay rule with its room
+func (m *testDBRepo) AllStayRules() ([]models.StayRule, error) {
+	return testStayRules, nil
+}
+
+// testStayRules are the rules the test repo knows about; they only apply in 2060
+var testStayRules = []models.StayRule{
+	{
+		ID:        1,
+		RoomID:    1,
+		StartDate: time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2060, 1, 31, 0, 0, 0, 0, time.UTC),
+		MinNights: 3,
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+	},
+	{
+		ID:              2,
+		RoomID:          2,
+		StartDate:       time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:         time.Date(2060, 1, 1, 0, 0, 0, 0, time.UTC),
+		ClosedToArrival: true,
+		Room:            models.Room{ID: 2, RoomName: "Major's Suite"},
+	},
+}
+
+// GetStayRules returns the stay rules whose dates overlap the stay from start to end
+func (m *testDBRepo) GetStayRules(start, end time.Time) ([]models.StayRule, error) {
+	var rules []models.StayRule
+
+	if start.Year() == 2070 {
+		return rules, errors.New("some error")
+	}
+
+	for _, s := range testStayRules {
+		if !s.StartDate.After(end) && !s.EndDate.Before(start) {
+			rules = append(rules, s)
+		}
+	}
+
+	return rules, nil
+}
+
+// InsertStayRule adds a stay rule for a room
+func (m *testDBRepo) InsertStayRule(s models.StayRule) (int, error) {
+	if s.RoomID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// DeleteStayRule deletes a stay rule
+func (m *testDBRepo) DeleteStayRule(id int) error {
+	return nil
+}
+
+// InsertBooking stores a booking with a reservation and a restriction for each of its rooms
+func (m *testDBRepo) InsertBooking(b models.Booking) (models.Booking, error) {
+	for i, res := range b.Reservations {
+		if res.RoomID > 2 {
+			return b, errors.New("some error")
+		}
+
+		// room 2 is only free in 2060, as in SearchAvailabilityForAllRooms
+		if res.RoomID == 2 && res.StartDate.Year() != 2060 {
+			return b, repository.ErrRoomUnavailable
+		}
+
+		b.Reservations[i].ID = i + 1
+		b.Reservations[i].BookingID = 1
+	}
+
+	b.ID = 1
+
+	return b, nil
+}
+
+// GetBookingById returns a booking with all its reservations; the second room of booking 2 is cancelled
+func (m *testDBRepo) GetBookingById(id int) (models.Booking, error) {
+	var b models.Booking
+
+	if id > 2 {
+		return b, sql.ErrNoRows
+	}
+
+	b.ID = id
+	b.ConfirmationCode = "K7QM2XPA"
+	b.FirstName = "John"
+	b.LastName = "Smith"
+	b.Email = "john@smith.com"
+
+	for roomId := 1; roomId <= 2; roomId++ {
+		res := models.Reservation{
+			ID:        roomId,
+			BookingID: id,
+			RoomID:    roomId,
+			FirstName: b.FirstName,
+			LastName:  b.LastName,
+			Email:     b.Email,
+			StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+			Adults:    1,
+			Room:      models.Room{ID: roomId},
+		}
+		if id == 2 && roomId == 2 {
+			res.CancelledAt = time.Now()
+		}
+		b.Reservations = append(b.Reservations, res)
+	}
+
+	return b, nil
+}
+
+// AllBookings returns every booking with its reservations
+func (m *testDBRepo) AllBookings() ([]models.Booking, error) {
+	b, _ := m.GetBookingById(1)
+
+	return []models.Booking{b}, nil
+}
+
+// CancelBooking cancels a booking and every room in it
+func (m *testDBRepo) CancelBooking(id int, lines []models.Reservation) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// AllWaitlistEntries returns the waitlist
+func (m *testDBRepo) AllWaitlistEntries() ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+
+	return entries, nil
+}
+
+// GetWaitlistCandidates returns the entries that could use a freed room; room 1 has two waiting guests,
+// the first of them too many for the room
+func (m *testDBRepo) GetWaitlistCandidates(roomId int, start, end time.Time) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+
+	if roomId == 1 {
+		entries = append(entries,
+			models.WaitlistEntry{ID: 1, Email: "big@family.com", StartDate: start, EndDate: end, Adults: 4, Children: 2},
+			models.WaitlistEntry{ID: 2, Email: "john@smith.com", StartDate: start, EndDate: end, Adults: 2},
+		)
+	}
+
+	return entries, nil
+}
+
+// GetWaitlistEntryByTokenHash returns the entry offered a room with the given booking link token hash
+func (m *testDBRepo) GetWaitlistEntryByTokenHash(hash string) (models.WaitlistEntry, error) {
+	e := models.WaitlistEntry{
+		ID:             1,
+		Email:          "john@smith.com",
+		StartDate:      time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:        time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+		Adults:         2,
+		OfferedRoomID:  1,
+		OfferExpiresAt: time.Now().Add(time.Hour),
+		OfferedRoom:    models.Room{ID: 1, RoomName: "General's Quarters"},
+	}
+
+	switch hash {
+	case helpers.HashToken("valid-offer"):
+		return e, nil
+	case helpers.HashToken("taken-offer"):
+		e.OfferedRoomID = 2
+		e.OfferedRoom = models.Room{ID: 2, RoomName: "Major's Suite"}
+		return e, nil
+	case helpers.HashToken("expired-offer"):
+		e.OfferExpiresAt = time.Now().Add(-time.Hour)
+		return e, nil
+	}
+
+	return e, sql.ErrNoRows
+}
+
+// InsertWaitlistEntry adds a guest to the waitlist
+func (m *testDBRepo) InsertWaitlistEntry(e models.WaitlistEntry) (int, error) {
+	if e.RoomID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// DeleteWaitlistEntry removes a waitlist entry
+func (m *testDBRepo) DeleteWaitlistEntry(id int) error {
+	return nil
+}
+
+// OfferWaitlistEntry records that an entry was sent a booking link for a room
+func (m *testDBRepo) OfferWaitlistEntry(id, roomId int, tokenHash string, expiresAt time.Time) error {
+	return nil
+}
+
+// ClaimWaitlistEntry marks an entry's offer as used; every offer is of room 1
+func (m *testDBRepo) ClaimWaitlistEntry(id int, res models.Reservation) (bool, error) {
+	return res.RoomID == 1, nil
+}
+
+// ExpireWaitlistOffers returns one expired offer of room 1
+func (m *testDBRepo) ExpireWaitlistOffers(now time.Time) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+
+	entries = append(entries, models.WaitlistEntry{
+		ID:            3,
+		OfferedRoomID: 1,
+		StartDate:     time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:       time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+	})
+
+	return entries, nil
+}
+
+// AllTaxes returns GST of 10% included in the price, a cleaning fee on room 2 for stays from
+// 2055 and an old levy no longer charged
+func (m *testDBRepo) AllTaxes() ([]models.Tax, error) {
+	var rules []models.Tax
+
+	rules = append(rules,
+		models.Tax{ID: 1, Name: "GST", Kind: "tax", Basis: "percent", Per: "night", Amount: 1000, Inclusive: true, Active: true},
+		models.Tax{ID: 2, Name: "Cleaning", Kind: "fee", Basis: "flat", Per: "stay", Amount: 4000, RoomID: 2,
+			EffectiveFrom: time.Date(2055, 1, 1, 0, 0, 0, 0, time.UTC), Active: true},
+		models.Tax{ID: 3, Name: "Old levy", Kind: "tax", Basis: "flat", Per: "stay", Amount: 500},
+	)
+
+	return rules, nil
+}
+
+// InsertTax adds a tax or fee; one for a room above 2 fails
+func (m *testDBRepo) InsertTax(t models.Tax) (int, error) {
+	if t.RoomID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// UpdateTaxActive switches a tax or fee on or off; tax 3 fails
+func (m *testDBRepo) UpdateTaxActive(id int, active bool) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetReservationTaxesDepartingBetween returns the GST included in reservation 1's price
+func (m *testDBRepo) GetReservationTaxesDepartingBetween(start, end time.Time) ([]models.ReservationTax, error) {
+	var lines []models.ReservationTax
+
+	lines = append(lines, models.ReservationTax{ID: 1, ReservationID: 1, TaxID: 1, Name: "GST", Kind: "tax", Inclusive: true, Amount: 1818})
+
+	return lines, nil
+}
+
+// AllExchangeRates returns rates for euros and US dollars
+func (m *testDBRepo) AllExchangeRates() ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+
+	rates = append(rates,
+		models.ExchangeRate{ID: 1, Currency: "EUR", Rate: 0.6},
+		models.ExchangeRate{ID: 2, Currency: "USD", Rate: 0.65},
+	)
+
+	return rates, nil
+}
+
+// SaveExchangeRates adds or replaces exchange rates; a rate for pounds fails
+func (m *testDBRepo) SaveExchangeRates(rates []models.ExchangeRate) error {
+	for _, r := range rates {
+		if r.Currency == "GBP" {
+			return errors.New("some error")
+		}
+	}
+	return nil
+}
+
+// DeleteExchangeRate removes an exchange rate; one above 2 fails
+func (m *testDBRepo) DeleteExchangeRate(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// AllPromoCodes returns every promo code with its usage
+func (m *testDBRepo) AllPromoCodes() ([]models.PromoCode, error) {
+	var codes []models.PromoCode
+
+	return codes, nil
+}
+
+// GetPromoCodeById returns a promo code with its usage; only code 1 exists
+func (m *testDBRepo) GetPromoCodeById(id int) (models.PromoCode, error) {
+	if id != 1 {
+		return models.PromoCode{}, sql.ErrNoRows
+	}
+
+	return models.PromoCode{ID: 1, Code: "SAVE10", DiscountType: "percent", Amount: 10, Active: true}, nil
+}
+
+// GetPromoCodeByCode returns the promo code a guest entered: SAVE10 takes 10% off, TAKE25 takes
+// 25.00 off, USEDUP has no uses left, ONCE may be used once per guest and BROKEN fails to load
+func (m *testDBRepo) GetPromoCodeByCode(code string) (models.PromoCode, error) {
+	switch strings.ToUpper(code) {
+	case "SAVE10":
+		return models.PromoCode{ID: 1, Code: "SAVE10", DiscountType: "percent", Amount: 10, Active: true}, nil
+	case "TAKE25":
+		return models.PromoCode{ID: 2, Code: "TAKE25", DiscountType: "fixed", Amount: 2500, Active: true}, nil
+	case "USEDUP":
+		return models.PromoCode{ID: 3, Code: "USEDUP", DiscountType: "percent", Amount: 10, MaxUses: 1, Uses: 1, Active: true}, nil
+	case "ONCE":
+		return models.PromoCode{ID: 4, Code: "ONCE", DiscountType: "percent", Amount: 10, MaxUsesPerGuest: 1, Active: true}, nil
+	case "BROKEN":
+		return models.PromoCode{}, errors.New("some error")
+	}
+
+	return models.PromoCode{}, sql.ErrNoRows
+}
+
+// InsertPromoCode adds a promo code
+func (m *testDBRepo) InsertPromoCode(p models.PromoCode) (int, error) {
+	if p.RoomID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// UpdatePromoCodeActive switches a promo code on or off
+func (m *testDBRepo) UpdatePromoCodeActive(id int, active bool) error {
+	return nil
+}
+
+// CountPromoCodeUsesByEmail returns how many reservations a guest made with a promo code;
+// repeat@guest.com has used every code once
+func (m *testDBRepo) CountPromoCodeUsesByEmail(id int, email string) (int, error) {
+	if email == "repeat@guest.com" {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// GetReservationsForPromoCode returns the reservations made with a promo code
+func (m *testDBRepo) GetReservationsForPromoCode(id int) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	return reservations, nil
+}
+
+// testCancellationPolicies are the policies of room 1, free until 7 days out then half the
+// price, and room 2, non-refundable
+var testCancellationPolicies = []models.CancellationPolicy{
+	{ID: 1, Name: "Flexible", FreeDays: 7, PenaltyType: "percent", PenaltyPercent: 50},
+	{ID: 2, Name: "Non-refundable", PenaltyType: "full", NonRefundable: true},
+}
+
+// AllCancellationPolicies returns every cancellation policy
+func (m *testDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	return testCancellationPolicies, nil
+}
+
+// GetCancellationPolicyById returns a cancellation policy; policy 3 fails to load
+func (m *testDBRepo) GetCancellationPolicyById(id int) (models.CancellationPolicy, error) {
+	if id == 3 {
+		return models.CancellationPolicy{}, errors.New("some error")
+	}
+
+	for _, p := range testCancellationPolicies {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+
+	return models.CancellationPolicy{}, sql.ErrNoRows
+}
+
+// InsertCancellationPolicy adds a cancellation policy
+func (m *testDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	if p.Name == "Invalid" {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// InsertPayment records a payment
+func (m *testDBRepo) InsertPayment(p models.Payment) (int, error) {
+	return 1, nil
+}
+
+// GetPaymentById returns a payment: 1 is authorized, 2 is captured with part refunded,
+// 3 is voided and 4 fails to update
+func (m *testDBRepo) GetPaymentById(id int) (models.Payment, error) {
+	p := models.Payment{
+		ID:            id,
+		ReservationID: 1,
+		Provider:      "fake",
+		Reference:     fmt.Sprintf("fake_%d", id),
+		Amount:        10000,
+	}
+
+	switch id {
+	case 1, 4:
+		p.Status = "authorized"
+	case 2:
+		p.Status = "captured"
+		p.Refunded = 2500
+	case 3:
+		p.Status = "voided"
+	default:
+		return models.Payment{}, sql.ErrNoRows
+	}
+
+	return p, nil
+}
+
+// GetPaymentsForReservation returns the payments for a reservation
+func (m *testDBRepo) GetPaymentsForReservation(reservationId int) ([]models.Payment, error) {
+	var payments []models.Payment
+
+	if reservationId == 1 {
+		p, _ := m.GetPaymentById(2)
+		payments = append(payments, p)
+	}
+
+	return payments, nil
+}
+
+// UpdatePaymentStatus records what happened to a payment
+func (m *testDBRepo) UpdatePaymentStatus(id int, status string, refunded int) error {
+	if id == 4 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetPaymentsDepartingBetween returns the payments for reservations departing between two dates
+func (m *testDBRepo) GetPaymentsDepartingBetween(start, end time.Time) ([]models.Payment, error) {
+	return m.GetPaymentsForReservation(1)
+}
+
+// InsertFolioItem posts an item to a folio; posting to reservation 2 fails
+func (m *testDBRepo) InsertFolioItem(item models.FolioItem) (int, error) {
+	if item.ReservationID == 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// GetFolioItemsForReservation returns the items posted to reservation 1's folio
+func (m *testDBRepo) GetFolioItemsForReservation(reservationId int) ([]models.FolioItem, error) {
+	var items []models.FolioItem
+
+	if reservationId == 1 {
+		items = append(items,
+			models.FolioItem{ID: 1, ReservationID: 1, Kind: "charge", Description: "Breakfast", Amount: 2500},
+			models.FolioItem{ID: 2, ReservationID: 1, Kind: "tax", Description: "Tax on Breakfast", Amount: 250},
+		)
+	}
+
+	return items, nil
+}
+
+// GetFolioItemsDepartingBetween returns the folio items of reservations departing between two dates
+func (m *testDBRepo) GetFolioItemsDepartingBetween(start, end time.Time) ([]models.FolioItem, error) {
+	return m.GetFolioItemsForReservation(1)
+}
+
+// GetReservationsDepartingBetween returns reservation 1, departing on the last day asked for
+func (m *testDBRepo) GetReservationsDepartingBetween(start, end time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	reservations = append(reservations, models.Reservation{
+		ID:        1,
+		RoomID:    1,
+		FirstName: "John",
+		LastName:  "Smith",
+		StartDate: end.AddDate(0, 0, -2),
+		EndDate:   end,
+		Subtotal:  20000,
+		Room:      models.Room{ID: 1, RoomName: "General's Quarters"},
+	})
+
+	return reservations, nil
+}
+
+// GetOrCreateInvoice returns the invoice of a reservation; reservation 2's fails
+func (m *testDBRepo) GetOrCreateInvoice(reservationId int, render func(inv models.Invoice) []byte) (models.Invoice, error) {
+	if reservationId == 2 {
+		return models.Invoice{}, errors.New("some error")
+	}
+
+	inv := models.Invoice{
+		ID:            reservationId,
+		Number:        41 + reservationId,
+		ReservationID: reservationId,
+		CreatedAt:     time.Date(2050, 1, 4, 11, 0, 0, 0, time.UTC),
+	}
+	inv.PDF = render(inv)
+
+	return inv, nil
+}
@@ -1,21 +1,48 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/tsawler/bookings-app/internal/models"
 )
 
+// ErrRoomUnavailable is returned when a room in a booking was taken before it could be stored
+var ErrRoomUnavailable = errors.New("room is not available for the requested dates")
+
+// ErrPromoCodeUsedUp is returned when a reservation's promo code reached its limit before the
+// reservation could be stored
+var ErrPromoCodeUsedUp = errors.New("promo code has been used up")
+
+// ErrReservationInvoiced is returned when deleting a reservation that was invoiced, as the
+// invoice has to be kept
+var ErrReservationInvoiced = errors.New("reservation has an invoice")
+
+// ErrAlreadyCancelled is returned when cancelling a reservation that was cancelled in the
+// meantime, so the refund and notifications for it are not repeated
+var ErrAlreadyCancelled = errors.New("reservation is already cancelled")
+
 type DatabaseRepo interface {
 	AllUsers() bool
 
+	// Health
+	Ping(ctx context.Context) error
+	MigrationVersion(ctx context.Context) (string, error)
+
 	// Room
-	InsertReservation(res models.Reservation) (int, error)
+	InsertReservation(res models.Reservation, holdId int) (int, error)
 	InsertRoomRestriction(r models.RoomRestriction) error
 	SearchAvailabilityByDatesByRoomId(start, end time.Time, roomId int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
+	SearchAvailabilityExceptHold(start, end time.Time, roomId, holdId int) (bool, error)
+	SearchAvailabilityForAllRooms(start, end time.Time, guests int) ([]models.Room, error)
 	GetRoomById(id int) (models.Room, error)
 	AllRooms() ([]models.Room, error)
+	GetRoomByICalToken(token string) (models.Room, error)
+	UpdateRoomICalToken(roomId int, token string) error
+	UpdateRoomNightlyRate(roomId, rate int) error
+	UpdateRoomMaxOccupancy(roomId, maxOccupancy int) error
+	UpdateRoomCancellationPolicy(roomId, policyId int) error
 
 	// User
 	GetUserById(id int) (models.User, error)
@@ -29,9 +56,112 @@ type DatabaseRepo interface {
 	UpdateReservation(res models.Reservation) error
 	DeleteReservation(id int) error
 	UpdateProcessedForReservation(id, processed int) error
+	CancelReservation(id, penalty, refund int) error
+	GetReservationDigest(since, day time.Time) (models.Digest, error)
+
+	// Bookings
+	InsertBooking(b models.Booking) (models.Booking, error)
+	GetBookingById(id int) (models.Booking, error)
+	AllBookings() ([]models.Booking, error)
+	CancelBooking(id int, lines []models.Reservation) error
+
+	// Waitlist
+	AllWaitlistEntries() ([]models.WaitlistEntry, error)
+	InsertWaitlistEntry(e models.WaitlistEntry) (int, error)
+	DeleteWaitlistEntry(id int) error
+	GetWaitlistCandidates(roomId int, start, end time.Time) ([]models.WaitlistEntry, error)
+	OfferWaitlistEntry(id, roomId int, tokenHash string, expiresAt time.Time) error
+	GetWaitlistEntryByTokenHash(hash string) (models.WaitlistEntry, error)
+	ClaimWaitlistEntry(id int, res models.Reservation) (bool, error)
+	ExpireWaitlistOffers(now time.Time) ([]models.WaitlistEntry, error)
+
+	// Cancellation policies
+	AllCancellationPolicies() ([]models.CancellationPolicy, error)
+	GetCancellationPolicyById(id int) (models.CancellationPolicy, error)
+	InsertCancellationPolicy(p models.CancellationPolicy) (int, error)
+
+	// Payments
+	InsertPayment(p models.Payment) (int, error)
+	GetPaymentById(id int) (models.Payment, error)
+	GetPaymentsForReservation(reservationId int) ([]models.Payment, error)
+	UpdatePaymentStatus(id int, status string, refunded int) error
+	GetPaymentsDepartingBetween(start, end time.Time) ([]models.Payment, error)
+
+	// Folios
+	InsertFolioItem(item models.FolioItem) (int, error)
+	GetFolioItemsForReservation(reservationId int) ([]models.FolioItem, error)
+	GetFolioItemsDepartingBetween(start, end time.Time) ([]models.FolioItem, error)
+	GetReservationsDepartingBetween(start, end time.Time) ([]models.Reservation, error)
+
+	// Invoices
+	GetOrCreateInvoice(reservationId int, render func(inv models.Invoice) []byte) (models.Invoice, error)
+
+	// Taxes and fees
+	AllTaxes() ([]models.Tax, error)
+	InsertTax(t models.Tax) (int, error)
+	UpdateTaxActive(id int, active bool) error
+	GetReservationTaxesDepartingBetween(start, end time.Time) ([]models.ReservationTax, error)
+
+	// Exchange rates
+	AllExchangeRates() ([]models.ExchangeRate, error)
+	SaveExchangeRates(rates []models.ExchangeRate) error
+	DeleteExchangeRate(id int) error
+
+	// Promo codes
+	AllPromoCodes() ([]models.PromoCode, error)
+	GetPromoCodeById(id int) (models.PromoCode, error)
+	GetPromoCodeByCode(code string) (models.PromoCode, error)
+	InsertPromoCode(p models.PromoCode) (int, error)
+	UpdatePromoCodeActive(id int, active bool) error
+	CountPromoCodeUsesByEmail(id int, email string) (int, error)
+	GetReservationsForPromoCode(id int) ([]models.Reservation, error)
 
 	// Restrictions
 	GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error)
 	InsertBlockForRoom(id int, startDate time.Time) error
 	DeleteBlockById(id int) error
+	AllRestrictionsForRoom(roomId int) ([]models.RoomRestriction, error)
+
+	// Room holds
+	InsertHold(r models.RoomRestriction) (int, error)
+	DeleteHold(holdId int) error
+	DeleteExpiredHolds(now time.Time) (int, error)
+
+	// Stay rules
+	AllStayRules() ([]models.StayRule, error)
+	GetStayRules(start, end time.Time) ([]models.StayRule, error)
+	InsertStayRule(s models.StayRule) (int, error)
+	DeleteStayRule(id int) error
+
+	// External calendars
+	AllExternalCalendars() ([]models.ExternalCalendar, error)
+	GetExternalCalendarById(id int) (models.ExternalCalendar, error)
+	InsertExternalCalendar(c models.ExternalCalendar) error
+	DeleteExternalCalendar(id int) error
+	UpdateExternalCalendarSync(id int, syncedAt time.Time, syncError string) error
+	GetBlocksForExternalCalendar(calendarId int) ([]models.RoomRestriction, error)
+	UpsertExternalBlock(r models.RoomRestriction) error
+
+	// API tokens
+	AllAPITokens() ([]models.APIToken, error)
+	InsertAPIToken(t models.APIToken) (int, error)
+	DeleteAPIToken(id int) error
+	GetAPITokenByHash(hash string) (models.APIToken, error)
+	UpdateAPITokenLastUsed(id int, usedAt time.Time) error
+
+	// Webhooks
+	AllWebhooks() ([]models.Webhook, error)
+	GetWebhookById(id int) (models.Webhook, error)
+	InsertWebhook(w models.Webhook) (int, error)
+	DeleteWebhook(id int) error
+	InsertWebhookDelivery(d models.WebhookDelivery) (int, error)
+	UpdateWebhookDelivery(d models.WebhookDelivery) error
+	GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error)
+	GetWebhookDeliveries(webhookId, limit int) ([]models.WebhookDelivery, error)
+
+	// Idempotency keys
+	ClaimIdempotencyKey(key, requestHash string) (models.IdempotencyKey, bool, error)
+	GetIdempotencyKey(key string) (models.IdempotencyKey, error)
+	CompleteIdempotencyKey(key string, reservationId int) error
+	ReleaseIdempotencyKey(key string) error
 }
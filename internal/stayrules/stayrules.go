@@ -0,0 +1,66 @@
+package stayrules
+
+import (
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Check returns the reasons a room can't be booked from start to end under
+// the given rules, or nil when the stay is allowed. Rules for other rooms
+// are ignored. Length of stay, arrival and advance window rules apply when
+// the arrival date is in their range, departure rules when the departure
+// date is.
+func Check(rules []models.StayRule, roomId int, start, end, now time.Time) []i18n.Message {
+	var reasons []i18n.Message
+	seen := make(map[string]bool)
+
+	add := func(format string, args ...interface{}) {
+		reason := i18n.M(format, args...)
+		if !seen[reason.String()] {
+			seen[reason.String()] = true
+			reasons = append(reasons, reason)
+		}
+	}
+
+	start, end = clock.Day(start), clock.Day(end)
+	nights := clock.DaysBetween(start, end)
+	advance := clock.DaysBetween(now, start)
+
+	for _, rule := range rules {
+		if rule.RoomID != roomId {
+			continue
+		}
+
+		if covers(rule, start) {
+			if rule.MinNights > 0 && nights < rule.MinNights {
+				add("Minimum stay is %d nights for arrivals on %s", rule.MinNights, start)
+			}
+			if rule.MaxNights > 0 && nights > rule.MaxNights {
+				add("Maximum stay is %d nights for arrivals on %s", rule.MaxNights, start)
+			}
+			if rule.ClosedToArrival {
+				add("No arrivals on %s", start)
+			}
+			if rule.MinAdvanceDays > 0 && advance < rule.MinAdvanceDays {
+				add("Must be booked at least %d days before arrival", rule.MinAdvanceDays)
+			}
+			if rule.MaxAdvanceDays > 0 && advance > rule.MaxAdvanceDays {
+				add("Can be booked at most %d days before arrival", rule.MaxAdvanceDays)
+			}
+		}
+
+		if rule.ClosedToDeparture && covers(rule, end) {
+			add("No departures on %s", end)
+		}
+	}
+
+	return reasons
+}
+
+// covers reports whether d falls within the rule's dates, both inclusive
+func covers(rule models.StayRule, d time.Time) bool {
+	return !d.Before(clock.Day(rule.StartDate)) && !d.After(clock.Day(rule.EndDate))
+}
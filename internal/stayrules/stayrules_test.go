@@ -0,0 +1,69 @@
+package stayrules
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var rules = []models.StayRule{
+	{RoomID: 1, StartDate: date("2050-07-01"), EndDate: date("2050-07-31"), MinNights: 3, MaxNights: 7},
+	{RoomID: 1, StartDate: date("2050-07-05"), EndDate: date("2050-07-05"), ClosedToArrival: true},
+	{RoomID: 1, StartDate: date("2050-07-12"), EndDate: date("2050-07-12"), ClosedToDeparture: true},
+	{RoomID: 1, StartDate: date("2050-08-01"), EndDate: date("2050-08-31"), MinAdvanceDays: 14, MaxAdvanceDays: 60},
+	{RoomID: 2, StartDate: date("2050-07-01"), EndDate: date("2050-07-31"), MinNights: 10},
+}
+
+var checkTests = []struct {
+	name     string
+	roomId   int
+	start    string
+	end      string
+	now      string
+	expected []string
+}{
+	{"allowed", 1, "2050-07-01", "2050-07-04", "2050-06-01", nil},
+	{"too short", 1, "2050-07-01", "2050-07-02", "2050-06-01", []string{"Minimum stay is 3 nights for arrivals on 2050-07-01"}},
+	{"too long", 1, "2050-07-01", "2050-07-10", "2050-06-01", []string{"Maximum stay is 7 nights for arrivals on 2050-07-01"}},
+	{"departing after the range", 1, "2050-07-30", "2050-08-02", "2050-06-01", nil},
+	{"arriving before the range", 1, "2050-06-29", "2050-07-01", "2050-06-01", nil},
+	{"closed to arrival", 1, "2050-07-05", "2050-07-08", "2050-06-01", []string{"No arrivals on 2050-07-05"}},
+	{"closed to departure", 1, "2050-07-09", "2050-07-12", "2050-06-01", []string{"No departures on 2050-07-12"}},
+	{"several reasons", 1, "2050-07-05", "2050-07-06", "2050-06-01", []string{
+		"Minimum stay is 3 nights for arrivals on 2050-07-05",
+		"No arrivals on 2050-07-05",
+	}},
+	{"too late to book", 1, "2050-08-10", "2050-08-12", "2050-08-01", []string{"Must be booked at least 14 days before arrival"}},
+	{"too early to book", 1, "2050-08-10", "2050-08-12", "2050-01-01", []string{"Can be booked at most 60 days before arrival"}},
+	{"within the window", 1, "2050-08-10", "2050-08-12", "2050-07-01", nil},
+	{"other room's rules", 2, "2050-07-05", "2050-07-06", "2050-06-01", []string{"Minimum stay is 10 nights for arrivals on 2050-07-05"}},
+	{"room without rules", 3, "2050-07-05", "2050-07-06", "2050-06-01", nil},
+}
+
+func TestCheck(t *testing.T) {
+	for _, e := range checkTests {
+		var got []string
+		for _, reason := range Check(rules, e.roomId, date(e.start), date(e.end), date(e.now)) {
+			got = append(got, reason.String())
+		}
+		if !reflect.DeepEqual(got, e.expected) {
+			t.Errorf("for %s expected %v but got %v", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestCheckIgnoresTimeOfDay(t *testing.T) {
+	now := time.Date(2050, 7, 27, 23, 59, 0, 0, time.UTC)
+
+	got := Check(rules, 1, date("2050-08-10"), date("2050-08-12"), now)
+	if got != nil {
+		t.Errorf("expected a booking 14 days ahead to be allowed but got %v", got)
+	}
+}
@@ -0,0 +1,197 @@
+// Package taxes works out the taxes and fees staff set up, such as GST, occupancy tax or a
+// cleaning fee, on a reservation.
+package taxes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/clock"
+	"github.com/tsawler/bookings-app/internal/currency"
+	"github.com/tsawler/bookings-app/internal/i18n"
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+// Kinds
+const (
+	Tax = "tax"
+	Fee = "fee"
+)
+
+// Bases
+const (
+	Percent = "percent"
+	Flat    = "flat"
+)
+
+// What a flat amount is charged for. A percentage is of the room price of each night, or
+// of the whole stay.
+const (
+	PerNight = "night"
+	PerStay  = "stay"
+	PerGuest = "guest"
+)
+
+const dateLayout = "2006-01-02"
+
+// Apply works out the taxes and fees on a reservation from the rules in force, setting
+// its tax lines and the taxes added to its total
+func Apply(rules []models.Tax, res *models.Reservation) {
+	res.TaxLines = Compute(rules, *res)
+	res.Taxes = Added(res.TaxLines)
+}
+
+// Compute returns the taxes and fees the rules charge on a reservation, leaving out those
+// charging nothing. Percentages are of the room price after any discount. Nightly amounts
+// are only charged for the nights within a rule's dates, and amounts per stay only when the
+// guest arrives within them.
+func Compute(rules []models.Tax, res models.Reservation) []models.ReservationTax {
+	var lines []models.ReservationTax
+
+	for _, t := range rules {
+		if !t.Active || (t.RoomID > 0 && t.RoomID != res.RoomID) {
+			continue
+		}
+
+		amount := charge(t, res)
+		if amount <= 0 {
+			continue
+		}
+
+		lines = append(lines, models.ReservationTax{
+			TaxID:     t.ID,
+			Name:      t.Name,
+			Kind:      t.Kind,
+			Inclusive: t.Inclusive,
+			Amount:    amount,
+		})
+	}
+
+	return lines
+}
+
+// charge returns what one rule charges on a reservation, in cents
+func charge(t models.Tax, res models.Reservation) int {
+	nights := res.Nights()
+	price := res.Subtotal - res.Discount
+
+	if t.Per == PerStay {
+		if !effective(t, res.StartDate) {
+			return 0
+		}
+		if t.Basis == Percent {
+			return percentOf(t, price)
+		}
+		return t.Amount
+	}
+
+	// nightly: the price is spread evenly over the nights, with any odd cents on the last
+	counted, base := 0, 0
+	for i := 0; i < nights; i++ {
+		if !effective(t, res.StartDate.AddDate(0, 0, i)) {
+			continue
+		}
+
+		counted++
+		base += price / nights
+		if i == nights-1 {
+			base += price % nights
+		}
+	}
+
+	switch {
+	case t.Basis == Percent:
+		return percentOf(t, base)
+	case t.Per == PerGuest:
+		return t.Amount * res.Guests() * counted
+	default:
+		return t.Amount * counted
+	}
+}
+
+// percentOf returns a rule's percentage of an amount, rounded to the nearest cent. For an
+// inclusive tax the amount already contains the tax, so it is the part of the amount that
+// is tax.
+func percentOf(t models.Tax, amount int) int {
+	if t.Inclusive {
+		return (amount*t.Amount*2 + 10000 + t.Amount) / (2 * (10000 + t.Amount))
+	}
+	return (amount*t.Amount + 5000) / 10000
+}
+
+// effective reports whether a rule is in force on a date
+func effective(t models.Tax, date time.Time) bool {
+	d := clock.Day(date)
+	if !t.EffectiveFrom.IsZero() && d.Before(clock.Day(t.EffectiveFrom)) {
+		return false
+	}
+	if !t.EffectiveTo.IsZero() && d.After(clock.Day(t.EffectiveTo)) {
+		return false
+	}
+	return true
+}
+
+// Added returns the taxes and fees added on top of the price, in cents
+func Added(lines []models.ReservationTax) int {
+	total := 0
+	for _, line := range lines {
+		if !line.Inclusive {
+			total += line.Amount
+		}
+	}
+	return total
+}
+
+// Included returns the taxes and fees already part of the price, in cents
+func Included(lines []models.ReservationTax) int {
+	total := 0
+	for _, line := range lines {
+		if line.Inclusive {
+			total += line.Amount
+		}
+	}
+	return total
+}
+
+// Describe explains a rule to staff, with amounts in the given currency, such as "10% of the
+// room price, included" or "A$2.50 per guest per night from 2050-01-01"
+func Describe(t models.Tax, code string) string {
+	money := currency.Format(t.Amount, code, i18n.Default)
+
+	var s string
+
+	switch {
+	case t.Basis == Percent && t.Per == PerStay:
+		s = FormatRate(t.Amount) + " of the stay"
+	case t.Basis == Percent:
+		s = FormatRate(t.Amount) + " of the room price"
+	case t.Per == PerStay:
+		s = money + " per stay"
+	case t.Per == PerGuest:
+		s = money + " per guest per night"
+	default:
+		s = money + " per night"
+	}
+
+	if t.Inclusive {
+		s += ", included"
+	}
+
+	switch {
+	case !t.EffectiveFrom.IsZero() && !t.EffectiveTo.IsZero():
+		s += fmt.Sprintf(" from %s to %s", t.EffectiveFrom.Format(dateLayout), t.EffectiveTo.Format(dateLayout))
+	case !t.EffectiveFrom.IsZero():
+		s += " from " + t.EffectiveFrom.Format(dateLayout)
+	case !t.EffectiveTo.IsZero():
+		s += " until " + t.EffectiveTo.Format(dateLayout)
+	}
+
+	return s
+}
+
+// FormatRate shows a rate in hundredths of a percent, such as 12.5%
+func FormatRate(rate int) string {
+	s := fmt.Sprintf("%d.%02d", rate/100, rate%100)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".") + "%"
+}
@@ -0,0 +1,114 @@
+package taxes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+)
+
+func date(day int) time.Time {
+	return time.Date(2050, 1, day, 0, 0, 0, 0, time.UTC)
+}
+
+// stay is 3 nights in room 1 for 2 adults and a child at $100 a night, with $30 off
+var stay = models.Reservation{
+	RoomID:    1,
+	StartDate: date(10),
+	EndDate:   date(13),
+	Adults:    2,
+	Children:  1,
+	Subtotal:  30000,
+	Discount:  3000,
+}
+
+func TestCompute(t *testing.T) {
+	var tests = []struct {
+		name     string
+		tax      models.Tax
+		expected int
+	}{
+		{"percent", models.Tax{Basis: Percent, Per: PerNight, Amount: 1000}, 2700},
+		{"fractional percent", models.Tax{Basis: Percent, Per: PerNight, Amount: 1250}, 3375},
+		{"percent of stay", models.Tax{Basis: Percent, Per: PerStay, Amount: 500}, 1350},
+		{"inclusive percent", models.Tax{Basis: Percent, Per: PerNight, Amount: 1000, Inclusive: true}, 2455},
+		{"per night", models.Tax{Basis: Flat, Per: PerNight, Amount: 250}, 750},
+		{"per stay", models.Tax{Basis: Flat, Per: PerStay, Amount: 5000}, 5000},
+		{"per guest", models.Tax{Basis: Flat, Per: PerGuest, Amount: 200}, 1800},
+		{"nights in effect", models.Tax{Basis: Flat, Per: PerNight, Amount: 250, EffectiveFrom: date(11)}, 500},
+		{"percent of nights in effect", models.Tax{Basis: Percent, Per: PerNight, Amount: 1000, EffectiveTo: date(10)}, 900},
+		{"stay before effect", models.Tax{Basis: Flat, Per: PerStay, Amount: 5000, EffectiveFrom: date(11)}, 0},
+		{"stay after effect", models.Tax{Basis: Flat, Per: PerStay, Amount: 5000, EffectiveTo: date(9)}, 0},
+		{"other room", models.Tax{Basis: Flat, Per: PerStay, Amount: 5000, RoomID: 2}, 0},
+		{"this room", models.Tax{Basis: Flat, Per: PerStay, Amount: 5000, RoomID: 1}, 5000},
+	}
+
+	for _, e := range tests {
+		e.tax.Name = e.name
+		e.tax.Active = true
+
+		lines := Compute([]models.Tax{e.tax}, stay)
+
+		if e.expected == 0 {
+			if len(lines) != 0 {
+				t.Errorf("%s: expected no charge but got %d", e.name, lines[0].Amount)
+			}
+			continue
+		}
+
+		if len(lines) != 1 || lines[0].Amount != e.expected {
+			t.Errorf("%s: expected %d but got %v", e.name, e.expected, lines)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	rules := []models.Tax{
+		{ID: 1, Name: "GST", Kind: Tax, Basis: Percent, Per: PerNight, Amount: 1000, Inclusive: true, Active: true},
+		{ID: 2, Name: "Cleaning", Kind: Fee, Basis: Flat, Per: PerStay, Amount: 4000, Active: true},
+		{ID: 3, Name: "City tax", Kind: Tax, Basis: Flat, Per: PerGuest, Amount: 100, Active: true},
+		{ID: 4, Name: "Old levy", Kind: Tax, Basis: Flat, Per: PerStay, Amount: 999},
+	}
+
+	res := stay
+	Apply(rules, &res)
+
+	if len(res.TaxLines) != 3 {
+		t.Fatalf("expected 3 lines but got %d", len(res.TaxLines))
+	}
+
+	if res.TaxLines[1].Name != "Cleaning" || res.TaxLines[1].Kind != Fee || res.TaxLines[1].TaxID != 2 {
+		t.Errorf("expected the cleaning fee second but got %v", res.TaxLines[1])
+	}
+
+	if res.Taxes != 4900 {
+		t.Errorf("expected 4900 added but got %d", res.Taxes)
+	}
+
+	if Included(res.TaxLines) != 2455 {
+		t.Errorf("expected 2455 included but got %d", Included(res.TaxLines))
+	}
+
+	if res.Total() != 31900 {
+		t.Errorf("expected a total of 31900 but got %d", res.Total())
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	var tests = []struct {
+		tax      models.Tax
+		expected string
+	}{
+		{models.Tax{Basis: Percent, Per: PerNight, Amount: 1000, Inclusive: true}, "10% of the room price, included"},
+		{models.Tax{Basis: Percent, Per: PerStay, Amount: 1250}, "12.5% of the stay"},
+		{models.Tax{Basis: Flat, Per: PerGuest, Amount: 250, EffectiveFrom: date(1)}, "A$2.50 per guest per night from 2050-01-01"},
+		{models.Tax{Basis: Flat, Per: PerStay, Amount: 4000, EffectiveTo: date(31)}, "A$40.00 per stay until 2050-01-31"},
+		{models.Tax{Basis: Flat, Per: PerNight, Amount: 300, EffectiveFrom: date(1), EffectiveTo: date(31)}, "A$3.00 per night from 2050-01-01 to 2050-01-31"},
+	}
+
+	for _, e := range tests {
+		if got := Describe(e.tax, "AUD"); got != e.expected {
+			t.Errorf("expected %q but got %q", e.expected, got)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// Events are the event names a webhook may subscribe to
+var Events = []string{
+	"reservation.created",
+	"reservation.modified",
+	"reservation.cancelled",
+	"reservation.processed",
+	"block.created",
+	"block.deleted",
+}
+
+// backoff is the wait before each retry; the last value repeats until MaxAttempts
+var backoff = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+}
+
+// Dispatcher queues events for subscribed webhooks and delivers them
+type Dispatcher struct {
+	DB          repository.DatabaseRepo
+	Client      *http.Client
+	MaxAttempts int
+}
+
+// payload is the JSON body posted to a webhook
+type payload struct {
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// New creates a dispatcher with a default http client
+func New(db repository.DatabaseRepo) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+	}
+}
+
+// Sign returns the signature header value for a body signed with a webhook secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Subscribed reports whether a webhook wants an event
+func Subscribed(w models.Webhook, event string) bool {
+	for _, e := range w.Events {
+		if e == event || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Enqueue records a pending delivery of the event for every active subscribed webhook
+func (d *Dispatcher) Enqueue(e models.WebhookEvent) error {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+
+	body, err := json.Marshal(payload{
+		Event:      e.Event,
+		OccurredAt: e.OccurredAt.UTC(),
+		Data:       e.Data,
+	})
+	if err != nil {
+		return err
+	}
+
+	webhooks, err := d.DB.AllWebhooks()
+	if err != nil {
+		return err
+	}
+
+	for _, w := range webhooks {
+		if !w.Active || !Subscribed(w, e.Event) {
+			continue
+		}
+
+		_, err := d.DB.InsertWebhookDelivery(models.WebhookDelivery{
+			WebhookID:     w.ID,
+			Event:         e.Event,
+			Payload:       string(body),
+			NextAttemptAt: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeliverDue attempts every delivery that is due, recording the outcome of each
+func (d *Dispatcher) DeliverDue() error {
+	deliveries, err := d.DB.GetDueWebhookDeliveries(time.Now(), 100)
+	if err != nil {
+		return err
+	}
+
+	for _, x := range deliveries {
+		err := d.DB.UpdateWebhookDelivery(d.attempt(x))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// attempt posts a delivery once and returns it updated with the result
+func (d *Dispatcher) attempt(x models.WebhookDelivery) models.WebhookDelivery {
+	x.Attempts++
+	x.StatusCode = 0
+	x.Error = ""
+
+	err := d.post(&x)
+	if err == nil {
+		x.DeliveredAt = time.Now()
+		x.NextAttemptAt = time.Time{}
+		return x
+	}
+
+	x.Error = err.Error()
+	if x.Attempts >= d.MaxAttempts {
+		// give up; the delivery stays in the log as failed
+		x.NextAttemptAt = time.Time{}
+		return x
+	}
+
+	wait := backoff[len(backoff)-1]
+	if x.Attempts-1 < len(backoff) {
+		wait = backoff[x.Attempts-1]
+	}
+	x.NextAttemptAt = time.Now().Add(wait)
+
+	return x
+}
+
+func (d *Dispatcher) post(x *models.WebhookDelivery) error {
+	body := []byte(x.Payload)
+
+	req, err := http.NewRequest("POST", x.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Bookings-Webhooks/1.0")
+	req.Header.Set("X-Bookings-Event", x.Event)
+	req.Header.Set("X-Bookings-Delivery", strconv.Itoa(x.ID))
+	req.Header.Set("X-Bookings-Signature", Sign(x.Webhook.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	x.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+
+	return nil
+}
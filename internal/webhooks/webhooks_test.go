@@ -0,0 +1,157 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tsawler/bookings-app/internal/models"
+	"github.com/tsawler/bookings-app/internal/repository"
+)
+
+// fakeRepo keeps webhooks and deliveries in memory
+type fakeRepo struct {
+	repository.DatabaseRepo
+	webhooks   []models.Webhook
+	deliveries []models.WebhookDelivery
+}
+
+func (f *fakeRepo) AllWebhooks() ([]models.Webhook, error) {
+	return f.webhooks, nil
+}
+
+func (f *fakeRepo) InsertWebhookDelivery(d models.WebhookDelivery) (int, error) {
+	d.ID = len(f.deliveries) + 1
+	for _, w := range f.webhooks {
+		if w.ID == d.WebhookID {
+			d.Webhook = w
+		}
+	}
+	f.deliveries = append(f.deliveries, d)
+	return d.ID, nil
+}
+
+func (f *fakeRepo) UpdateWebhookDelivery(d models.WebhookDelivery) error {
+	f.deliveries[d.ID-1] = d
+	return nil
+}
+
+func (f *fakeRepo) GetDueWebhookDeliveries(now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	var due []models.WebhookDelivery
+	for _, d := range f.deliveries {
+		if !d.NextAttemptAt.IsZero() && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func TestSign(t *testing.T) {
+	got := Sign("secret", []byte(`{"event":"reservation.created"}`))
+	if got != Sign("secret", []byte(`{"event":"reservation.created"}`)) {
+		t.Error("signature is not deterministic")
+	}
+	if got == Sign("other", []byte(`{"event":"reservation.created"}`)) {
+		t.Error("signature does not depend on the secret")
+	}
+	if len(got) != len("sha256=")+64 {
+		t.Errorf("unexpected signature %q", got)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var received *http.Request
+	var body []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{
+		webhooks: []models.Webhook{
+			{ID: 1, URL: srv.URL, Secret: "s3cret", Events: []string{"reservation.created"}, Active: true},
+			{ID: 2, URL: srv.URL, Secret: "s3cret", Events: []string{"block.created"}, Active: true},
+			{ID: 3, URL: srv.URL, Secret: "s3cret", Events: []string{"reservation.created"}, Active: false},
+		},
+	}
+	d := New(repo)
+
+	err := d.Enqueue(models.WebhookEvent{Event: "reservation.created", Data: map[string]int{"id": 7}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repo.deliveries) != 1 {
+		t.Fatalf("expected 1 queued delivery but got %d", len(repo.deliveries))
+	}
+
+	if err := d.DeliverDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	if received == nil {
+		t.Fatal("webhook was not called")
+	}
+
+	if received.Header.Get("X-Bookings-Signature") != Sign("s3cret", body) {
+		t.Error("signature header does not match body")
+	}
+
+	if received.Header.Get("X-Bookings-Event") != "reservation.created" {
+		t.Errorf("unexpected event header %q", received.Header.Get("X-Bookings-Event"))
+	}
+
+	var p map[string]interface{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p["event"] != "reservation.created" || p["data"] == nil {
+		t.Errorf("unexpected payload %s", body)
+	}
+
+	x := repo.deliveries[0]
+	if x.DeliveredAt.IsZero() || x.Attempts != 1 || x.StatusCode != http.StatusOK {
+		t.Errorf("delivery not recorded as delivered: %+v", x)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{
+		webhooks: []models.Webhook{
+			{ID: 1, URL: srv.URL, Secret: "s3cret", Events: []string{"*"}, Active: true},
+		},
+	}
+	d := New(repo)
+	d.MaxAttempts = 2
+
+	if err := d.Enqueue(models.WebhookEvent{Event: "block.deleted"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeliverDue(); err != nil {
+		t.Fatal(err)
+	}
+
+	x := repo.deliveries[0]
+	if x.StatusCode != http.StatusInternalServerError || x.Error == "" {
+		t.Errorf("failure not recorded: %+v", x)
+	}
+	if x.NextAttemptAt.Before(time.Now().Add(50 * time.Second)) {
+		t.Errorf("retry not backed off, next attempt at %s", x.NextAttemptAt)
+	}
+
+	// final attempt gives up
+	x = d.attempt(x)
+	if !x.NextAttemptAt.IsZero() || x.Attempts != 2 {
+		t.Errorf("expected delivery to be abandoned: %+v", x)
+	}
+}
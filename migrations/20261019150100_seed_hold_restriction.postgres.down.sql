@@ -0,0 +1,2 @@
+delete from room_restrictions where restriction_id = 3;
+delete from restrictions where id = 3;
\ No newline at end of file
@@ -0,0 +1 @@
+insert into restrictions (id, restriction_name, created_at, updated_at) values (3, 'Hold', now(), now()) on conflict (id) do nothing;
\ No newline at end of file
@@ -0,0 +1 @@
+update rooms set nightly_rate = 0;
\ No newline at end of file
@@ -0,0 +1,2 @@
+update rooms set nightly_rate = 12000 where room_name = 'General''s Quarters';
+update rooms set nightly_rate = 15000 where room_name = 'Major''s Suite';
\ No newline at end of file
@@ -174,7 +174,7 @@ function checkAvailability(id) {
                                 });
                             } else {
                                 attention.error({
-                                    msg: "No availability",
+                                    msg: data.message || "No availability",
                                 });
                             }
                         });